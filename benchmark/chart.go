@@ -3,7 +3,10 @@ package benchmark
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/danielkennedy1/sieve/problems/grammar"
 	"github.com/go-echarts/go-echarts/v2/charts"
@@ -48,6 +51,12 @@ func GenerateCharts(dataFile, outputDir string) error {
 		fmt.Println("✓ Order flow chart created")
 	}
 
+	if err := createCoverageChart(history, outputDir); err != nil {
+		fmt.Printf("Error creating coverage chart: %v\n", err)
+	} else {
+		fmt.Println("✓ Coverage chart created")
+	}
+
 	if err := createCombinedDashboard(history, outputDir); err != nil {
 		fmt.Printf("Error creating dashboard: %v\n", err)
 	} else {
@@ -248,6 +257,65 @@ func createOrderFlowChart(history *grammar.MarketHistory, outputDir string) erro
 	return bar.Render(f)
 }
 
+// createCoverageChart plots, per generation, the share of the population and
+// of the best individuals using each production that reads an indicator
+// ($PRICE, $RSI, ...).
+func createCoverageChart(history *grammar.MarketHistory, outputDir string) error {
+	line := charts.NewLine()
+	line.SetGlobalOptions(
+		charts.WithInitializationOpts(opts.Initialization{
+			Theme:  types.ThemeWesteros,
+			Width:  "1400px",
+			Height: "600px",
+		}),
+		charts.WithTitleOpts(opts.Title{
+			Title:    "Indicator Coverage",
+			Subtitle: "Share of the population (solid) and best individuals (dashed) using each indicator",
+		}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: opts.Bool(true)}),
+		charts.WithLegendOpts(opts.Legend{Show: opts.Bool(true), Type: "scroll"}),
+		charts.WithYAxisOpts(opts.YAxis{Min: 0, Max: 1}),
+	)
+
+	indicators := map[string]bool{}
+	for _, gen := range history.Generations {
+		for feature := range gen.Coverage {
+			if strings.Contains(feature, "$") {
+				indicators[feature] = true
+			}
+		}
+	}
+	if len(indicators) == 0 {
+		return fmt.Errorf("no coverage recorded (set coverage_best)")
+	}
+
+	xAxis := make([]string, len(history.Generations))
+	for i, gen := range history.Generations {
+		xAxis[i] = fmt.Sprintf("%d", gen.Generation)
+	}
+	line.SetXAxis(xAxis)
+
+	for _, feature := range slices.Sorted(maps.Keys(indicators)) {
+		population := make([]opts.LineData, len(history.Generations))
+		best := make([]opts.LineData, len(history.Generations))
+		for i, gen := range history.Generations {
+			population[i] = opts.LineData{Value: gen.Coverage[feature]}
+			best[i] = opts.LineData{Value: gen.BestCoverage[feature]}
+		}
+		line.AddSeries(feature, population).
+			AddSeries(feature+" (best)", best,
+				charts.WithLineStyleOpts(opts.LineStyle{Type: "dashed"}))
+	}
+
+	f, err := os.Create(fmt.Sprintf("%s/coverage_chart.html", outputDir))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return line.Render(f)
+}
+
 func createCombinedDashboard(history *grammar.MarketHistory, outputDir string) error {
 	html := `<!DOCTYPE html>
 <html>
@@ -359,6 +427,10 @@ func createCombinedDashboard(history *grammar.MarketHistory, outputDir string) e
     <div class="chart-container">
         <iframe src="order_flow_chart.html" height="650"></iframe>
     </div>
+    
+    <div class="chart-container">
+        <iframe src="coverage_chart.html" height="650"></iframe>
+    </div>
 </body>
 </html>`
 
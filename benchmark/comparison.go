@@ -1,7 +1,6 @@
 package benchmark
 
 import (
-	"bufio"
 	"fmt"
 	"math"
 	"math/rand/v2"
@@ -30,15 +29,11 @@ func RunComparison() {
 		os.Exit(1)
 	}
 
-	f, err := os.Open(config.BNFFilePath)
+	gr, err := grammar.ParseFile(config.BNFFilePath)
 	if err != nil {
-		fmt.Printf("File not found: %s\n", config.BNFFilePath)
+		fmt.Printf("Error loading grammar: %v\n", err)
 		os.Exit(1)
 	}
-	defer f.Close()
-
-	s := bufio.NewScanner(f)
-	gr := grammar.Parse(*s)
 	gr.BuildRuleMap()
 	r := rand.New(rand.NewPCG(5, 5))
 
@@ -0,0 +1,386 @@
+package benchmark
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/danielkennedy1/sieve/ea"
+	"github.com/danielkennedy1/sieve/genomes"
+	"github.com/danielkennedy1/sieve/problems/expression_tree"
+	"github.com/danielkennedy1/sieve/problems/grammar"
+	"github.com/danielkennedy1/sieve/problems/regression"
+)
+
+// Constants shared by both pipelines, matching Problem.BNF
+var regressionConstants = []float64{0.5, 1, 2, 3}
+
+type RegressionOptions struct {
+	// Operators and functions both pipelines build models from; GE's grammar
+	// is generated from them, so functions must be unary
+	Primitives     []string
+	Seeds          int
+	Generations    int
+	PopulationSize int
+	MutationRate   float64
+	CrossoverRate  float64
+	TournamentSize int
+	EliteCount     int
+	MaxDepth       int
+	// Tree GP's initial population: Initialisation from MinDepth to
+	// MaxDepth, retrying duplicates up to DistinctAttempts times
+	Initialisation   genomes.Initialisation
+	MinDepth         int
+	DistinctAttempts int
+	// Tree GP's variation operators, each picked in proportion to its rate.
+	// Mutants are limited to twice MaxDepth like crossover's children
+	TreeMutation        genomes.TreeMutationRates
+	TreeMutationOptions genomes.TreeMutationOptions
+	TreeCrossover       genomes.TreeCrossoverRates
+	// ERC, when set, draws tree GP's constants from its range. Each
+	// generation LocalSearchCount trees (all if 0) have their constants
+	// tuned with up to LocalSearchEvaluations fitness evaluations, if any
+	ERC                    *genomes.ERC
+	LocalSearchEvaluations int
+	LocalSearchCount       int
+	GeneLength             int
+	MaxReproductions       int
+	// Both pipelines evolve against Metric, after fitting each model's
+	// slope and intercept if LinearScaling is set. The fitted slope and
+	// intercept are folded into the best model before it is tested
+	Metric        regression.Metric
+	LinearScaling bool
+	// ValidationFraction of the training samples is held out to choose each
+	// run's final model
+	ValidationFraction float64
+	// SuccessThreshold is the test RMSE at or below which a run counts as
+	// solving the problem
+	SuccessThreshold float64
+}
+
+func DefaultRegressionOptions() RegressionOptions {
+	return RegressionOptions{
+		Primitives:       []string{"+", "-", "*", "/", "sin", "cos", "exp", "log"},
+		Seeds:            10,
+		Generations:      50,
+		PopulationSize:   500,
+		MutationRate:     0.1,
+		CrossoverRate:    0.9,
+		TournamentSize:   7,
+		EliteCount:       1,
+		MaxDepth:         6,
+		Initialisation:   genomes.RampedHalfAndHalf,
+		MinDepth:         2,
+		DistinctAttempts: 10,
+		TreeMutation:     genomes.TreeMutationRates{Point: 1},
+		TreeMutationOptions: genomes.TreeMutationOptions{
+			SwapRate:      genomes.DefaultSwapRate,
+			SubtreeDepth:  2,
+			ConstantSigma: 0.1,
+		},
+		TreeCrossover:      genomes.TreeCrossoverRates{Subtree: 1},
+		GeneLength:         100,
+		MaxReproductions:   100,
+		Metric:             regression.RMSE,
+		ValidationFraction: 0.2,
+		SuccessThreshold:   0.01,
+	}
+}
+
+// RegressionResult summarises one pipeline's runs on one problem.
+type RegressionResult struct {
+	Problem   string
+	Pipeline  string
+	Runs      int
+	Successes int
+	// MedianTestRMSE is the median over runs of the test RMSE of the model
+	// chosen on validation
+	MedianTestRMSE float64
+}
+
+func (r RegressionResult) SuccessRate() float64 {
+	return float64(r.Successes) / float64(r.Runs)
+}
+
+// RunRegressionSuite evolves each problem once per seed with tree-based GP
+// ("gp") and grammatical evolution ("ge"), on the same samples for both. Each
+// run reports the test RMSE of the model that scored best on the validation
+// samples held out of training.
+func RunRegressionSuite(problems []regression.Problem, o RegressionOptions) ([]RegressionResult, error) {
+	set, err := genomes.ParsePrimitiveSet(o.Primitives)
+	if err != nil {
+		return nil, err
+	}
+	fitness := regression.NewFitness(o.Metric, o.LinearScaling)
+	var results []RegressionResult
+	for _, p := range problems {
+		gr, err := regressionGrammar(p, set)
+		if err != nil {
+			return nil, fmt.Errorf("%s grammar: %w", p.Name, err)
+		}
+
+		gp := RegressionResult{Problem: p.Name, Pipeline: "gp", Runs: o.Seeds}
+		ge := RegressionResult{Problem: p.Name, Pipeline: "ge", Runs: o.Seeds}
+		var gpErrors, geErrors []float64
+		for seed := range o.Seeds {
+			train, test := p.Generate(rand.New(rand.NewPCG(uint64(seed), 0)))
+			split, err := regression.NewSplit(train, o.ValidationFraction, 0, rand.New(rand.NewPCG(uint64(seed), 3)))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", p.Name, err)
+			}
+
+			gpErrors = append(gpErrors, runTreeGP(p, set, fitness, split, test, uint64(seed), o))
+
+			geErrors = append(geErrors, runGE(gr, fitness, split, test, uint64(seed), o))
+		}
+
+		gp.Successes, gp.MedianTestRMSE = summarise(gpErrors, o.SuccessThreshold)
+		ge.Successes, ge.MedianTestRMSE = summarise(geErrors, o.SuccessThreshold)
+		results = append(results, gp, ge)
+	}
+	return results, nil
+}
+
+// regressionGrammar is p's grammar over the operators and functions in set.
+func regressionGrammar(p regression.Problem, set genomes.PrimitiveSet) (genomes.Grammar, error) {
+	operators := make([]string, len(set.Operators))
+	for i, op := range set.Operators {
+		operators[i] = op.String()
+	}
+	var functions []string
+	for _, f := range set.Functions {
+		if f.Arity != 1 {
+			return genomes.Grammar{}, fmt.Errorf("GE only takes unary functions, not %q", f.Name)
+		}
+		functions = append(functions, f.Name)
+	}
+
+	gr, err := grammar.Parse(*bufio.NewScanner(strings.NewReader(p.BNF(operators, functions))))
+	if err != nil {
+		return gr, err
+	}
+	gr.BuildRuleMap()
+	return gr, nil
+}
+
+// runTreeGP returns the test RMSE of the expression tree that scored best on
+// validation.
+func runTreeGP(p regression.Problem, set genomes.PrimitiveSet, fitness func(predictions, targets []float64) float64, split regression.Split[regression.Sample], test []regression.Sample, seed uint64, o RegressionOptions) float64 {
+	r := rand.New(rand.NewPCG(seed, 1))
+	set.ERC = o.ERC
+	trainSamples, validationSamples, testSamples := treeSamples(split.Train), treeSamples(split.Validation), treeSamples(test)
+	evaluate := expression_tree.NewRegressionFitness(&trainSamples, fitness)
+	constants := slices.Clone(regressionConstants)
+	// Variation may double the initial depth, as for crossover
+	mutation := o.TreeMutationOptions
+	mutation.MaxDepth = 2 * o.MaxDepth
+
+	// The model is scaled on the training samples before it is tested
+	model := func(e genomes.Expression) genomes.Expression {
+		if !o.LinearScaling {
+			return e
+		}
+		predictions := make([]float64, len(trainSamples))
+		genomes.Compile(e).EvalBatch(expression_tree.Columns(trainSamples), predictions)
+		slope, intercept := regression.LinearScaling(predictions, targets(split.Train))
+		return genomes.NonTerminal{
+			Operator: genomes.Add,
+			Left:     genomes.Primitive{Value: intercept},
+			Right:    genomes.NonTerminal{Operator: genomes.Multiply, Left: genomes.Primitive{Value: slope}, Right: e},
+		}
+	}
+	// Validation scores the same model as the test, with the metric alone so
+	// nothing is fitted on the validation samples
+	validate := expression_tree.NewRegressionFitness(&validationSamples, o.Metric.Fitness)
+	testRMSE := expression_tree.NewCompiledRootMeanSquaredError(&testSamples)
+	validation := ea.NewValidation(
+		func(e genomes.Expression) float64 { return validate(model(e)) },
+		func(e genomes.Expression) float64 { return testRMSE(model(e)) },
+	)
+
+	population := ea.NewPopulation(
+		o.PopulationSize,
+		o.MutationRate,
+		o.CrossoverRate,
+		o.EliteCount,
+		genomes.NewDistinctExpression(
+			genomes.NewCreateExpression(o.Initialisation, set, o.MinDepth, o.MaxDepth, &constants, p.NumVars, r),
+			o.DistinctAttempts,
+		),
+		evaluate,
+		genomes.NewTreeCrossover(o.TreeCrossover, 2*o.MaxDepth, r),
+		genomes.NewTreeMutation(set, constants, p.NumVars, o.TreeMutation, mutation, r),
+		ea.SeededTournament(o.TournamentSize, r),
+		genomes.Expression.String,
+		true,
+	)
+	if o.LocalSearchEvaluations > 0 {
+		population.LocalSearch = expression_tree.NewConstantOptimiser(evaluate, o.LocalSearchEvaluations)
+		population.LocalSearchCount = o.LocalSearchCount
+	}
+	// Variation draws from r, so it must run sequentially to be reproducible
+	population.Rand = r
+	population.AfterEvaluateGenomes = recordValidation(validation)
+	// Report the initial population's shapes before it is first evaluated
+	initial := true
+	population.BeforeEvaluate = func(trees *[]genomes.Expression) {
+		if initial {
+			fmt.Print(genomes.ExpressionShapes(*trees))
+			initial = false
+		}
+	}
+	population.Evolve(o.Generations)
+
+	if len(validation.History) == 0 {
+		return math.Inf(1)
+	}
+	fmt.Printf("\t\tBest model: %s\n", model(validation.Best))
+	return -validation.BestTest
+}
+
+// runGE returns the test RMSE of the genotype mapped through gr that scored
+// best on validation.
+func runGE(gr genomes.Grammar, fitness func(predictions, targets []float64) float64, split regression.Split[regression.Sample], test []regression.Sample, seed uint64, o RegressionOptions) float64 {
+	r := rand.New(rand.NewPCG(seed, 2))
+	trainSamples, validationSamples, testSamples := grammarSamples(split.Train), grammarSamples(split.Validation), grammarSamples(test)
+
+	// model is the phenotype scaled on the training samples, or "" if it
+	// does not map or run
+	model := func(g genomes.Genotype) string {
+		tree := g.MapToGrammar(gr, o.MaxReproductions)
+		if !tree.Valid() {
+			return ""
+		}
+		phenotype := tree.String()
+		if !o.LinearScaling {
+			return phenotype
+		}
+		predictions, ok := grammar.Predict(phenotype, trainSamples, gr)
+		if !ok {
+			return ""
+		}
+		slope, intercept := regression.LinearScaling(predictions, targets(split.Train))
+		return fmt.Sprintf("%s + %s * (%s)", formatConstant(intercept), formatConstant(slope), phenotype)
+	}
+	// score rates the model on samples as the tree pipeline does
+	score := func(g genomes.Genotype, samples []grammar.Sample, metric regression.Metric, targets []float64) float64 {
+		predictions, ok := grammar.Predict(model(g), samples, gr)
+		if !ok {
+			return math.Inf(-1)
+		}
+		return metric.Fitness(predictions, targets)
+	}
+	validationTargets, testTargets := targets(split.Validation), targets(test)
+	validation := ea.NewValidation(
+		func(g genomes.Genotype) float64 { return score(g, validationSamples, o.Metric, validationTargets) },
+		func(g genomes.Genotype) float64 { return score(g, testSamples, regression.RMSE, testTargets) },
+	)
+
+	population := ea.NewPopulation(
+		o.PopulationSize,
+		o.MutationRate,
+		o.CrossoverRate,
+		o.EliteCount,
+		genomes.NewCreateGenotype(o.GeneLength, r),
+		grammar.NewRegressionFitness(trainSamples, gr, fitness, 0, o.MaxReproductions),
+		genomes.NewCrossoverGenotype(r),
+		genomes.NewMutateGenotype(r, o.MutationRate),
+		ea.SeededTournament(o.TournamentSize, r),
+		func(g genomes.Genotype) string {
+			return g.MapToGrammar(gr, o.MaxReproductions).String()
+		},
+		true,
+	)
+	// Variation draws from r, so it must run sequentially to be reproducible
+	population.Rand = r
+	population.AfterEvaluateGenomes = recordValidation(validation)
+	population.Evolve(o.Generations)
+
+	if len(validation.History) == 0 {
+		return math.Inf(1)
+	}
+	fmt.Printf("\t\tBest model: %s\n", model(validation.Best))
+	return -validation.BestTest
+}
+
+// recordValidation records each generation in v and prints its scores.
+func recordValidation[G any](v *ea.Validation[G]) func([]G, []float64) {
+	return func(genomes []G, fitnesses []float64) {
+		n := len(v.History)
+		v.Record(genomes, fitnesses)
+		if len(v.History) > n {
+			r := v.History[n]
+			fmt.Printf("\t\tValidation fitness: %0.4f, Test fitness: %0.4f\n", r.Validation, r.Test)
+		}
+	}
+}
+
+func targets(samples []regression.Sample) []float64 {
+	outputs := make([]float64, len(samples))
+	for i, s := range samples {
+		outputs[i] = s.Output
+	}
+	return outputs
+}
+
+// formatConstant writes x as an expr-lang literal, bracketing negatives.
+func formatConstant(x float64) string {
+	s := strconv.FormatFloat(x, 'f', -1, 64)
+	if x < 0 {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+func treeSamples(samples []regression.Sample) []expression_tree.Sample {
+	converted := make([]expression_tree.Sample, len(samples))
+	for i, s := range samples {
+		converted[i] = expression_tree.Sample(s)
+	}
+	return converted
+}
+
+func grammarSamples(samples []regression.Sample) []grammar.Sample {
+	converted := make([]grammar.Sample, len(samples))
+	for i, s := range samples {
+		converted[i] = grammar.Sample(s)
+	}
+	return converted
+}
+
+// summarise counts runs at or under threshold and takes the median error,
+// NaN counting as the worst.
+func summarise(errors []float64, threshold float64) (int, float64) {
+	successes := 0
+	sorted := make([]float64, len(errors))
+	for i, e := range errors {
+		if e <= threshold {
+			successes++
+		}
+		if math.IsNaN(e) {
+			e = math.Inf(1)
+		}
+		sorted[i] = e
+	}
+	slices.Sort(sorted)
+	if len(sorted) == 0 {
+		return 0, math.NaN()
+	}
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return successes, (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return successes, sorted[mid]
+}
+
+func PrintRegressionResults(results []RegressionResult) {
+	fmt.Printf("%-18s %-8s %-12s %s\n", "Problem", "Pipeline", "Success", "Median test RMSE")
+	for _, r := range results {
+		fmt.Printf("%-18s %-8s %3d/%-3d %3.0f%% %.4g\n",
+			r.Problem, r.Pipeline, r.Successes, r.Runs, 100*r.SuccessRate(), r.MedianTestRMSE)
+	}
+}
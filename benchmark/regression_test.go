@@ -0,0 +1,51 @@
+package benchmark_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/benchmark"
+	"github.com/danielkennedy1/sieve/problems/regression"
+)
+
+func TestRegressionSuiteIsReproducible(t *testing.T) {
+	p, err := regression.Benchmark("nguyen-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := benchmark.DefaultRegressionOptions()
+	o.Seeds, o.Generations, o.PopulationSize = 2, 2, 20
+
+	first, err := benchmark.RunRegressionSuite([]regression.Problem{p}, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := benchmark.RunRegressionSuite([]regression.Problem{p}, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("runs with the same seeds differ:\n%+v\n%+v", first, second)
+	}
+
+	if len(first) != 2 || first[0].Pipeline != "gp" || first[1].Pipeline != "ge" {
+		t.Fatalf("expected a gp and a ge result, got %+v", first)
+	}
+	for _, r := range first {
+		if r.Runs != o.Seeds || r.SuccessRate() < 0 || r.SuccessRate() > 1 {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+}
+
+func TestRegressionSuiteRejectsNonUnaryFunctions(t *testing.T) {
+	p, err := regression.Benchmark("nguyen-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := benchmark.DefaultRegressionOptions()
+	o.Primitives = []string{"+", "if"}
+	if _, err := benchmark.RunRegressionSuite([]regression.Problem{p}, o); err == nil {
+		t.Error("expected an error for a function GE cannot take")
+	}
+}
@@ -0,0 +1,17 @@
+package benchmark
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSummarise(t *testing.T) {
+	// NaN counts as the worst error, so the median is the mean of 0.5 and 2
+	successes, median := summarise([]float64{0.005, math.NaN(), 2, 0.5}, 0.01)
+	if successes != 1 || median != 1.25 {
+		t.Errorf("got %d successes and median %v, want 1 and 1.25", successes, median)
+	}
+	if _, median := summarise(nil, 0.01); !math.IsNaN(median) {
+		t.Errorf("expected a NaN median without runs, got %v", median)
+	}
+}
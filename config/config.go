@@ -27,9 +27,97 @@ type PopulationConfig struct {
 	CrossoverRate  float64 `mapstructure:"crossover_rate"`
 	MaxDepth       int     `mapstructure:"max_depth"`
 	GeneLength     int     `mapstructure:"gene_length"`
+	CodonBits      int     `mapstructure:"codon_bits"`
 	TournamentSize int     `mapstructure:"tournament_size"`
 	EliteCount     int     `mapstructure:"elite_count"`
 	CacheBoolean   bool    `mapstructure:"cache_boolean"`
+	// Key the fitness cache by simplified phenotype instead of by codons
+	SimplifiedCacheKey bool `mapstructure:"simplified_cache_key"`
+
+	// Variable-length genomes: two-point crossover with independent cut
+	// points plus duplication, insertion and deletion mutations
+	VariableLength  bool    `mapstructure:"variable_length"`
+	MinGeneLength   int     `mapstructure:"min_gene_length"`
+	MaxGeneLength   int     `mapstructure:"max_gene_length"`
+	DuplicationRate float64 `mapstructure:"duplication_rate"`
+	InsertionRate   float64 `mapstructure:"insertion_rate"`
+	DeletionRate    float64 `mapstructure:"deletion_rate"`
+}
+
+type BloatConfig struct {
+	// "none", "tarpeian", "double_tournament", "lexicographic",
+	// "dynamic_depth" or "covariant"
+	Method       string  `mapstructure:"method"`
+	TarpeianRate float64 `mapstructure:"tarpeian_rate"`
+	Parsimony    float64 `mapstructure:"parsimony"`
+	DepthLimit   int     `mapstructure:"depth_limit"`
+}
+
+// TreeConfig sets up expression tree GP
+type TreeConfig struct {
+	// Operators and functions trees are built from, e.g. ["+", "*", "sin"];
+	// see genomes.ParsePrimitiveSet
+	Primitives []string `mapstructure:"primitives"`
+	// "grow", "full" or "ramped" (half-and-half from min_depth to the
+	// population's max_depth)
+	Initialisation string `mapstructure:"initialisation"`
+	MinDepth       int    `mapstructure:"min_depth"`
+	// Times to retry creating a tree already in the initial population; 0
+	// allows duplicates
+	DistinctAttempts int `mapstructure:"distinct_attempts"`
+
+	Mutation    TreeMutationConfig    `mapstructure:"mutation"`
+	Crossover   TreeCrossoverConfig   `mapstructure:"crossover"`
+	ERC         TreeERCConfig         `mapstructure:"erc"`
+	LocalSearch TreeLocalSearchConfig `mapstructure:"local_search"`
+}
+
+// TreeMutationConfig weights the tree mutation operators; one is picked per
+// mutation in proportion to its weight
+type TreeMutationConfig struct {
+	Point       float64 `mapstructure:"point"`
+	Subtree     float64 `mapstructure:"subtree"`
+	Hoist       float64 `mapstructure:"hoist"`
+	Shrink      float64 `mapstructure:"shrink"`
+	Permutation float64 `mapstructure:"permutation"`
+	Constant    float64 `mapstructure:"constant"`
+
+	// Chance point mutation swaps an operator rather than descending past it
+	SwapRate float64 `mapstructure:"swap_rate"`
+	// Depth of the trees subtree mutation grows
+	SubtreeDepth int `mapstructure:"subtree_depth"`
+	// Standard deviation of constant perturbation
+	ConstantSigma float64 `mapstructure:"constant_sigma"`
+}
+
+// TreeCrossoverConfig weights the tree crossover operators like
+// TreeMutationConfig
+type TreeCrossoverConfig struct {
+	Subtree   float64 `mapstructure:"subtree"`
+	SizeFair  float64 `mapstructure:"size_fair"`
+	DepthFair float64 `mapstructure:"depth_fair"`
+	Uniform   float64 `mapstructure:"uniform"`
+}
+
+// TreeERCConfig draws ephemeral random constants from [Min, Max) instead of
+// the constants list; it is off while Min is not below Max
+type TreeERCConfig struct {
+	Min float64 `mapstructure:"min"`
+	Max float64 `mapstructure:"max"`
+}
+
+// TreeLocalSearchConfig tunes constants with Nelder–Mead each generation
+type TreeLocalSearchConfig struct {
+	// Fitness evaluations per individual; 0 turns local search off
+	Evaluations int `mapstructure:"evaluations"`
+	// Number of fittest individuals optimised; 0 optimises all of them
+	Count int `mapstructure:"count"`
+}
+
+type PGEConfig struct {
+	LearningRate float64 `mapstructure:"learning_rate"`
+	BestCount    int     `mapstructure:"best_count"`
+	OutputPath   string  `mapstructure:"output_path"`
 }
 
 type Config struct {
@@ -49,11 +137,34 @@ type Config struct {
 	// Fitness Settings (Top level)
 	ParsiomonyPenalty float64 `mapstructure:"parsimony_penalty"`
 	MaxReproductions  int     `mapstructure:"max_reproductions"`
+	// Symbolic regression error: "rmse", "mse", "mae", "r2" or "nrmse",
+	// optionally after fitting the output's slope and intercept
+	Metric        string `mapstructure:"metric"`
+	LinearScaling bool   `mapstructure:"linear_scaling"`
 
 	// General Settings (Top level)
 	BNFFilePath string `mapstructure:"bnf_file_path"`
 
+	// Genome representation: "ge" (codons mapped through the grammar) or
+	// "cfggp" (derivation trees evolved directly)
+	Representation string `mapstructure:"representation"`
+
+	// Grammar mapping: "standard", "pge" or "pige"
+	Mapping string    `mapstructure:"mapping"`
+	PGE     PGEConfig `mapstructure:"pge"`
+
+	Bloat BloatConfig `mapstructure:"bloat"`
+
+	Tree TreeConfig `mapstructure:"tree"`
+
 	BestStrategy string `mapstructure:"best_strategy"`
+
+	// Number of best individuals grammar coverage is reported for; 0 turns
+	// coverage reporting off
+	CoverageBest int `mapstructure:"coverage_best"`
+
+	// Hand-written phenotypes parsed into genotypes to seed the population
+	SeedStrategies []string `mapstructure:"seed_strategies"`
 }
 
 func DefaultConfig() Config {
@@ -70,8 +181,29 @@ func DefaultConfig() Config {
 		},
 
 		Generations: 100,
+		Metric:      "rmse",
 
 		BNFFilePath: "data/lecture.bnf",
+
+		Tree: TreeConfig{
+			Primitives:       []string{"+", "-", "*", "/", "sin", "cos", "exp", "log"},
+			Initialisation:   "ramped",
+			MinDepth:         2,
+			DistinctAttempts: 10,
+			Mutation: TreeMutationConfig{
+				Point:         1,
+				SwapRate:      0.1,
+				SubtreeDepth:  2,
+				ConstantSigma: 0.1,
+			},
+			Crossover: TreeCrossoverConfig{Subtree: 1},
+		},
+
+		Mapping: "standard",
+		PGE: PGEConfig{
+			LearningRate: 0.01,
+			BestCount:    1,
+		},
 	}
 }
 
@@ -19,6 +19,7 @@ func TestDefaultConfig(t *testing.T) {
 		assert.Equal(t, expectedTarget, cfg.TargetExpressionString, "TargetExpressionString should match default")
 		assert.Equal(t, expectedGenerations, cfg.Generations, "Generations should match default")
 		assert.Equal(t, 1, cfg.NumVars, "NumVars should match default")
+		assert.Equal(t, "rmse", cfg.Metric, "Metric should match default")
 	})
 
 	t.Run("NestedPopulationDefaults", func(t *testing.T) {
@@ -26,17 +27,45 @@ func TestDefaultConfig(t *testing.T) {
 		assert.Equal(t, 0.1, cfg.Population.MutationRate, "Population.MutationRate should match default")
 		assert.Equal(t, 5, cfg.Population.MaxDepth, "Population.MaxDepth should match default")
 	})
+
+	t.Run("NestedTreeDefaults", func(t *testing.T) {
+		assert.Equal(t, []string{"+", "-", "*", "/", "sin", "cos", "exp", "log"}, cfg.Tree.Primitives, "Tree.Primitives should match default")
+		assert.Equal(t, "ramped", cfg.Tree.Initialisation, "Tree.Initialisation should match default")
+		assert.Equal(t, 2, cfg.Tree.MinDepth, "Tree.MinDepth should match default")
+		assert.Equal(t, 1.0, cfg.Tree.Mutation.Point, "Tree.Mutation.Point should match default")
+		assert.Equal(t, 0.1, cfg.Tree.Mutation.SwapRate, "Tree.Mutation.SwapRate should match default")
+		assert.Equal(t, 1.0, cfg.Tree.Crossover.Subtree, "Tree.Crossover.Subtree should match default")
+	})
 }
 
 func TestLoadConfig_FromFileOverride(t *testing.T) {
 	tomlContent := `
 target_expression_string = "x + y"
 generations = 500
+metric = "r2"
+linear_scaling = true
 
 [population]
 size = 100
 mutation_rate = 0.5
 gene_length = 30
+
+[tree]
+primitives = ["+", "*", "sqrt"]
+initialisation = "grow"
+
+[tree.mutation]
+hoist = 0.5
+
+[tree.crossover]
+size_fair = 2
+
+[tree.erc]
+min = -5
+max = 5
+
+[tree.local_search]
+evaluations = 200
 `
 	originalWd, _ := os.Getwd()
 
@@ -73,6 +102,8 @@ gene_length = 30
 		assert.Equal(t, expectedTarget, cfg.TargetExpressionString, "TargetExpressionString should be overridden by file")
 		assert.Equal(t, expectedGenerations, cfg.Generations, "Generations should be overridden by file")
 		assert.Equal(t, expectedNumSamples, cfg.NumSamplesToGenerate, "NumSamplesToGenerate should use default")
+		assert.Equal(t, "r2", cfg.Metric, "Metric should be overridden by file")
+		assert.True(t, cfg.LinearScaling, "LinearScaling should be overridden by file")
 	})
 
 	t.Run("NestedPopulationOverrides", func(t *testing.T) {
@@ -81,4 +112,16 @@ gene_length = 30
 		assert.Equal(t, expectedMaxDepth, cfg.Population.MaxDepth, "Population.MaxDepth should use default")
 		assert.Equal(t, 30, cfg.Population.GeneLength, "Population.GeneLength should be overridden by file")
 	})
+
+	t.Run("NestedTreeOverrides", func(t *testing.T) {
+		assert.Equal(t, []string{"+", "*", "sqrt"}, cfg.Tree.Primitives, "Tree.Primitives should be overridden by file")
+		assert.Equal(t, "grow", cfg.Tree.Initialisation, "Tree.Initialisation should be overridden by file")
+		assert.Equal(t, 2, cfg.Tree.MinDepth, "Tree.MinDepth should use default")
+		assert.Equal(t, 0.5, cfg.Tree.Mutation.Hoist, "Tree.Mutation.Hoist should be overridden by file")
+		assert.Equal(t, 1.0, cfg.Tree.Mutation.Point, "Tree.Mutation.Point should use default")
+		assert.Equal(t, 2.0, cfg.Tree.Crossover.SizeFair, "Tree.Crossover.SizeFair should be overridden by file")
+		assert.Equal(t, TreeERCConfig{Min: -5, Max: 5}, cfg.Tree.ERC, "Tree.ERC should be overridden by file")
+		assert.Equal(t, 200, cfg.Tree.LocalSearch.Evaluations, "Tree.LocalSearch.Evaluations should be overridden by file")
+		assert.Equal(t, 0, cfg.Tree.LocalSearch.Count, "Tree.LocalSearch.Count should use default")
+	})
 }
@@ -0,0 +1,212 @@
+package ea
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+)
+
+// SizedSelector picks n parent indices using each genome's fitness and size,
+// where size is whatever the population's Size function measures (node count
+// or depth).
+type SizedSelector func(fitnesses []float64, sizes []int, n int) []int
+
+// BloatMethod selects how selection is biased against large genomes.
+type BloatMethod int
+
+const (
+	NoBloatControl BloatMethod = iota
+	// TarpeianBloat gives a random share of above-average size genomes the
+	// worst possible fitness
+	TarpeianBloat
+	// DoubleTournamentBloat runs a size tournament between winners of
+	// fitness tournaments
+	DoubleTournamentBloat
+	// LexicographicBloat breaks fitness ties in tournaments by size
+	LexicographicBloat
+	// DynamicDepthBloat rejects genomes deeper than a limit that only rises
+	// for new best-of-run genomes
+	DynamicDepthBloat
+	// CovariantBloat subtracts a size penalty whose coefficient keeps the
+	// mean size from growing
+	CovariantBloat
+)
+
+func ParseBloatMethod(name string) (BloatMethod, error) {
+	switch name {
+	case "", "none":
+		return NoBloatControl, nil
+	case "tarpeian":
+		return TarpeianBloat, nil
+	case "double_tournament":
+		return DoubleTournamentBloat, nil
+	case "lexicographic":
+		return LexicographicBloat, nil
+	case "dynamic_depth":
+		return DynamicDepthBloat, nil
+	case "covariant":
+		return CovariantBloat, nil
+	default:
+		return NoBloatControl, fmt.Errorf("unknown bloat control method %q", name)
+	}
+}
+
+// UsesDepth reports whether the method expects sizes to be tree depths
+// rather than node counts.
+func (m BloatMethod) UsesDepth() bool {
+	return m == DynamicDepthBloat
+}
+
+type BloatOptions struct {
+	TournamentSize int
+	// TarpeianRate is the share of above-average size genomes killed
+	TarpeianRate float64
+	// Parsimony is the double tournament's D in [1, 2]: the smaller genome
+	// wins the size tournament with probability D/2
+	Parsimony float64
+	// DepthLimit is the dynamic depth limit's starting value
+	DepthLimit int
+}
+
+// NewBloatControl returns the sized selector for method, built around
+// selector where the method only adjusts fitnesses, and drawing from rng. It
+// returns nil for NoBloatControl.
+func NewBloatControl(method BloatMethod, selector func([]float64, int) []int, o BloatOptions, rng *rand.Rand) SizedSelector {
+	switch method {
+	case TarpeianBloat:
+		return Tarpeian(o.TarpeianRate, selector, rng)
+	case DoubleTournamentBloat:
+		return DoubleTournament(o.TournamentSize, o.Parsimony, rng)
+	case LexicographicBloat:
+		return LexicographicTournament(o.TournamentSize, rng)
+	case DynamicDepthBloat:
+		return DynamicDepthLimit(o.DepthLimit, selector)
+	case CovariantBloat:
+		return CovariantParsimony(selector)
+	}
+	return nil
+}
+
+func Tarpeian(rate float64, selector func([]float64, int) []int, rng *rand.Rand) SizedSelector {
+	return func(fitnesses []float64, sizes []int, n int) []int {
+		mean := 0.0
+		for _, s := range sizes {
+			mean += float64(s)
+		}
+		mean /= float64(len(sizes))
+
+		adjusted := make([]float64, len(fitnesses))
+		for i, f := range fitnesses {
+			if float64(sizes[i]) > mean && rng.Float64() < rate {
+				f = math.Inf(-1)
+			}
+			adjusted[i] = f
+		}
+		return selector(adjusted, n)
+	}
+}
+
+func DoubleTournament(k int, parsimony float64, rng *rand.Rand) SizedSelector {
+	fitness := SeededTournament(k, rng)
+	return func(fitnesses []float64, sizes []int, n int) []int {
+		selected := make([]int, n)
+		for i := range n {
+			pair := fitness(fitnesses, 2)
+			small, large := pair[0], pair[1]
+			if sizes[large] < sizes[small] {
+				small, large = large, small
+			}
+
+			selected[i] = small
+			if sizes[small] != sizes[large] && rng.Float64() >= parsimony/2 {
+				selected[i] = large
+			}
+		}
+		return selected
+	}
+}
+
+func LexicographicTournament(k int, rng *rand.Rand) SizedSelector {
+	return func(fitnesses []float64, sizes []int, n int) []int {
+		selected := make([]int, n)
+		for i := range n {
+			best := rng.IntN(len(fitnesses))
+			for j := 1; j < k; j++ {
+				candidate := rng.IntN(len(fitnesses))
+				if fitnesses[candidate] > fitnesses[best] ||
+					fitnesses[candidate] == fitnesses[best] && sizes[candidate] < sizes[best] {
+					best = candidate
+				}
+			}
+			selected[i] = best
+		}
+		return selected
+	}
+}
+
+// DynamicDepthLimit keeps genomes deeper than the limit out of selection
+// unless they beat the best fitness seen so far, in which case the limit
+// rises to their depth. sizes must be depths.
+func DynamicDepthLimit(limit int, selector func([]float64, int) []int) SizedSelector {
+	best := math.Inf(-1)
+	return func(fitnesses []float64, sizes []int, n int) []int {
+		for i, f := range fitnesses {
+			if sizes[i] <= limit && f > best {
+				best = f
+			}
+		}
+
+		adjusted := make([]float64, len(fitnesses))
+		for i, f := range fitnesses {
+			if sizes[i] > limit {
+				if f > best {
+					best, limit = f, sizes[i]
+				} else {
+					f = math.Inf(-1)
+				}
+			}
+			adjusted[i] = f
+		}
+		return selector(adjusted, n)
+	}
+}
+
+// CovariantParsimony subtracts c * size from each fitness, with c =
+// Cov(size, fitness) / Var(size) so that selection alone leaves the mean
+// size unchanged.
+func CovariantParsimony(selector func([]float64, int) []int) SizedSelector {
+	return func(fitnesses []float64, sizes []int, n int) []int {
+		var count, meanSize, meanFitness float64
+		for i, f := range fitnesses {
+			if !math.IsInf(f, 0) && !math.IsNaN(f) {
+				count++
+				meanSize += float64(sizes[i])
+				meanFitness += f
+			}
+		}
+		if count == 0 {
+			return selector(fitnesses, n)
+		}
+		meanSize /= count
+		meanFitness /= count
+
+		var covariance, variance float64
+		for i, f := range fitnesses {
+			if !math.IsInf(f, 0) && !math.IsNaN(f) {
+				d := float64(sizes[i]) - meanSize
+				covariance += d * (f - meanFitness)
+				variance += d * d
+			}
+		}
+		if variance == 0 {
+			return selector(fitnesses, n)
+		}
+
+		c := covariance / variance
+		adjusted := make([]float64, len(fitnesses))
+		for i, f := range fitnesses {
+			adjusted[i] = f - c*float64(sizes[i])
+		}
+		return selector(adjusted, n)
+	}
+}
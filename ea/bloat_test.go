@@ -0,0 +1,122 @@
+package ea
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+func countSelected(selected []int, idx int) int {
+	count := 0
+	for _, s := range selected {
+		if s == idx {
+			count++
+		}
+	}
+	return count
+}
+
+func TestParseBloatMethod(t *testing.T) {
+	m, err := ParseBloatMethod("dynamic_depth")
+	if err != nil || m != DynamicDepthBloat || !m.UsesDepth() {
+		t.Errorf("Expected dynamic depth method using depths, got %d, %v", m, err)
+	}
+	if _, err := ParseBloatMethod("prune"); err == nil {
+		t.Errorf("Expected an error for an unknown method")
+	}
+	if NewBloatControl(NoBloatControl, Tournament(2), BloatOptions{}, rand.New(rand.NewPCG(1, 1))) != nil {
+		t.Errorf("Expected no sized selector without bloat control")
+	}
+}
+
+func TestLexicographicTournamentPrefersSmaller(t *testing.T) {
+	fitnesses := []float64{1, 1, 1, 0}
+	sizes := []int{9, 3, 7, 1}
+
+	selected := LexicographicTournament(len(fitnesses)*4, rand.New(rand.NewPCG(2, 2)))(fitnesses, sizes, 200)
+	if n := countSelected(selected, 1); n < 190 {
+		t.Errorf("Expected the smallest of the fittest (1) to win almost every tournament, won %d/200", n)
+	}
+	if n := countSelected(selected, 3); n != 0 {
+		t.Errorf("Expected the less fit smallest genome never to win, won %d", n)
+	}
+}
+
+func TestDoubleTournamentPrefersSmaller(t *testing.T) {
+	fitnesses := []float64{1, 1}
+	sizes := []int{10, 2}
+
+	// With parsimony 2 the larger genome only wins when it takes both
+	// fitness tournaments
+	selected := DoubleTournament(1, 2, rand.New(rand.NewPCG(3, 3)))(fitnesses, sizes, 2000)
+	if n := countSelected(selected, 0); n < 400 || n > 600 {
+		t.Errorf("Expected the larger genome to win about a quarter of the time, won %d/2000", n)
+	}
+
+	selected = DoubleTournament(1, 1, rand.New(rand.NewPCG(4, 4)))(fitnesses, sizes, 2000)
+	if n := countSelected(selected, 0); n < 850 || n > 1150 {
+		t.Errorf("Expected no size pressure with parsimony 1, larger genome won %d/2000", n)
+	}
+}
+
+func TestTarpeianKillsLargeGenomes(t *testing.T) {
+	fitnesses := []float64{5, 1, 1}
+	sizes := []int{30, 1, 2}
+
+	var seen []float64
+	selector := func(f []float64, n int) []int {
+		seen = slices.Clone(f)
+		return make([]int, n)
+	}
+	Tarpeian(1, selector, rand.New(rand.NewPCG(5, 5)))(fitnesses, sizes, 3)
+
+	if !math.IsInf(seen[0], -1) || seen[1] != 1 || seen[2] != 1 {
+		t.Errorf("Expected only the above-average size genome killed, got %v", seen)
+	}
+	if fitnesses[0] != 5 {
+		t.Errorf("Tarpeian must not modify the population's fitnesses")
+	}
+}
+
+func TestDynamicDepthLimit(t *testing.T) {
+	var seen []float64
+	selector := func(f []float64, n int) []int {
+		seen = slices.Clone(f)
+		return make([]int, n)
+	}
+	limit := DynamicDepthLimit(5, selector)
+
+	limit([]float64{1, 2, 3}, []int{4, 6, 8}, 3)
+	if seen[0] != 1 || seen[1] != 2 || seen[2] != 3 {
+		t.Errorf("Expected new best-of-run genomes to pass and raise the limit, got %v", seen)
+	}
+
+	// The limit is now 8 and the best fitness 3
+	limit([]float64{1, 2, 4}, []int{7, 9, 10}, 3)
+	if seen[0] != 1 || !math.IsInf(seen[1], -1) || seen[2] != 4 {
+		t.Errorf("Expected the deeper, worse genome rejected, got %v", seen)
+	}
+}
+
+func TestCovariantParsimony(t *testing.T) {
+	// Fitness grows with size, so the penalty should cancel it out exactly
+	fitnesses := []float64{1, 2, 3, math.Inf(-1)}
+	sizes := []int{10, 20, 30, 40}
+
+	var seen []float64
+	selector := func(f []float64, n int) []int {
+		seen = slices.Clone(f)
+		return make([]int, n)
+	}
+	CovariantParsimony(selector)(fitnesses, sizes, 4)
+
+	for i := range 3 {
+		if math.Abs(seen[i]-seen[0]) > 1e-9 {
+			t.Errorf("Expected equal adjusted fitnesses, got %v", seen)
+		}
+	}
+	if !math.IsInf(seen[3], -1) {
+		t.Errorf("Expected non-finite fitness to stay non-finite, got %v", seen[3])
+	}
+}
@@ -0,0 +1,58 @@
+package ea
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// Coverage is the share of genomes each feature (e.g. a grammar production)
+// occurs in, across the population and among its fittest genomes.
+type Coverage struct {
+	Population map[string]float64
+	Best       map[string]float64
+}
+
+// NewCoverage returns a function measuring coverage of the features each
+// genome reports, with the best `best` genomes by fitness as the elite. It
+// fits the AfterEvaluateGenomes hook.
+func NewCoverage[G any](features func(G) []string, best int) func([]G, []float64) Coverage {
+	return func(genomes []G, fitnesses []float64) Coverage {
+		indices := make([]int, 0, len(genomes))
+		for i, f := range fitnesses {
+			if !math.IsInf(f, 0) && !math.IsNaN(f) {
+				indices = append(indices, i)
+			}
+		}
+		slices.SortStableFunc(indices, func(a, b int) int {
+			return cmp.Compare(fitnesses[b], fitnesses[a])
+		})
+		elite := make(map[int]bool, best)
+		for _, i := range indices[:min(best, len(indices))] {
+			elite[i] = true
+		}
+
+		c := Coverage{Population: map[string]float64{}, Best: map[string]float64{}}
+		for i, g := range genomes {
+			seen := map[string]bool{}
+			for _, f := range features(g) {
+				if seen[f] {
+					continue
+				}
+				seen[f] = true
+				c.Population[f]++
+				if elite[i] {
+					c.Best[f]++
+				}
+			}
+		}
+
+		for f := range c.Population {
+			c.Population[f] /= float64(len(genomes))
+		}
+		for f := range c.Best {
+			c.Best[f] /= float64(len(elite))
+		}
+		return c
+	}
+}
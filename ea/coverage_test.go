@@ -0,0 +1,37 @@
+package ea
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	genomes := [][]string{
+		{"a", "b", "a"},
+		{"b"},
+		{"b", "c"},
+		{"c"},
+	}
+	fitnesses := []float64{1, 4, 3, math.Inf(-1)}
+
+	identity := func(g []string) []string { return g }
+	c := NewCoverage(identity, 2)(genomes, fitnesses)
+
+	wantPopulation := map[string]float64{"a": 0.25, "b": 0.75, "c": 0.5}
+	for f, want := range wantPopulation {
+		if c.Population[f] != want {
+			t.Errorf("Population coverage of %s: got %v, want %v", f, c.Population[f], want)
+		}
+	}
+
+	// The best two are genomes 1 and 2
+	wantBest := map[string]float64{"b": 1, "c": 0.5}
+	if len(c.Best) != len(wantBest) {
+		t.Errorf("Expected best coverage %v, got %v", wantBest, c.Best)
+	}
+	for f, want := range wantBest {
+		if c.Best[f] != want {
+			t.Errorf("Best coverage of %s: got %v, want %v", f, c.Best[f], want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package ea
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// Nelder–Mead coefficients: reflection, expansion, contraction and shrink
+const (
+	nmReflect  = 1.0
+	nmExpand   = 2.0
+	nmContract = 0.5
+	nmShrink   = 0.5
+	// nmTolerance stops the search once the simplex's values are this close
+	nmTolerance = 1e-10
+)
+
+// NelderMead minimises f from x0 with the downhill simplex method, using at
+// most maxEvaluations calls to f. It returns the best point and its value.
+func NelderMead(f func([]float64) float64, x0 []float64, maxEvaluations int) ([]float64, float64) {
+	n := len(x0)
+	evaluations := 0
+	eval := func(x []float64) float64 {
+		evaluations++
+		v := f(x)
+		if math.IsNaN(v) {
+			return math.Inf(1)
+		}
+		return v
+	}
+
+	simplex := make([][]float64, n+1)
+	values := make([]float64, n+1)
+	simplex[0] = slices.Clone(x0)
+	values[0] = eval(simplex[0])
+	for i := range n {
+		x := slices.Clone(x0)
+		step := 0.1 * math.Abs(x[i])
+		if step == 0 {
+			step = 0.1
+		}
+		x[i] += step
+		simplex[i+1], values[i+1] = x, eval(x)
+	}
+
+	// along returns centroid + t * (centroid - worst)
+	along := func(centroid, worst []float64, t float64) []float64 {
+		x := make([]float64, n)
+		for i := range x {
+			x[i] = centroid[i] + t*(centroid[i]-worst[i])
+		}
+		return x
+	}
+
+	order := make([]int, n+1)
+	for evaluations < maxEvaluations {
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(a, b int) bool { return values[order[a]] < values[order[b]] })
+		best, worst, second := order[0], order[n], order[max(n-1, 0)]
+		if values[worst]-values[best] <= nmTolerance {
+			break
+		}
+
+		centroid := make([]float64, n)
+		for _, i := range order[:n] {
+			for j := range centroid {
+				centroid[j] += simplex[i][j] / float64(n)
+			}
+		}
+
+		reflected := along(centroid, simplex[worst], nmReflect)
+		fr := eval(reflected)
+		switch {
+		case fr < values[best]:
+			expanded := along(centroid, simplex[worst], nmExpand)
+			if fe := eval(expanded); fe < fr {
+				simplex[worst], values[worst] = expanded, fe
+			} else {
+				simplex[worst], values[worst] = reflected, fr
+			}
+		case fr < values[second]:
+			simplex[worst], values[worst] = reflected, fr
+		default:
+			contracted := along(centroid, simplex[worst], -nmContract)
+			if fc := eval(contracted); fc < values[worst] {
+				simplex[worst], values[worst] = contracted, fc
+				continue
+			}
+			for _, i := range order[1:] {
+				for j := range simplex[i] {
+					simplex[i][j] = simplex[best][j] + nmShrink*(simplex[i][j]-simplex[best][j])
+				}
+				values[i] = eval(simplex[i])
+			}
+		}
+	}
+
+	best := 0
+	for i, v := range values {
+		if v < values[best] {
+			best = i
+		}
+	}
+	return simplex[best], values[best]
+}
+
+// localSearch applies LocalSearch to the LocalSearchCount fittest genomes,
+// or every genome if LocalSearchCount is 0, keeping the improved genome and
+// fitness in place (Lamarckian).
+func (p *Population[G]) localSearch() {
+	indices := make([]int, len(p.genomes))
+	for i := range indices {
+		indices[i] = i
+	}
+	if p.LocalSearchCount > 0 && p.LocalSearchCount < len(indices) {
+		sort.SliceStable(indices, func(a, b int) bool {
+			return p.fitnesses[indices[a]] > p.fitnesses[indices[b]]
+		})
+		indices = indices[:p.LocalSearchCount]
+	}
+
+	jobs := make(chan int, len(indices))
+	var wg sync.WaitGroup
+	for w := 0; w < p.numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				g, fitness := p.LocalSearch(p.genomes[idx], p.fitnesses[idx])
+				if fitness > p.fitnesses[idx] {
+					p.genomes[idx], p.fitnesses[idx] = g, fitness
+				}
+			}
+		}()
+	}
+	for _, idx := range indices {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -0,0 +1,65 @@
+package ea
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNelderMeadRosenbrock(t *testing.T) {
+	rosenbrock := func(x []float64) float64 {
+		return math.Pow(1-x[0], 2) + 100*math.Pow(x[1]-x[0]*x[0], 2)
+	}
+
+	x, v := NelderMead(rosenbrock, []float64{-1.2, 1}, 2000)
+	if math.Abs(x[0]-1) > 1e-3 || math.Abs(x[1]-1) > 1e-3 || v > 1e-6 {
+		t.Errorf("expected minimum at (1, 1), got %v with value %g", x, v)
+	}
+}
+
+func TestNelderMeadBudget(t *testing.T) {
+	calls := 0
+	NelderMead(func(x []float64) float64 {
+		calls++
+		return x[0]*x[0] + x[1]*x[1] + x[2]*x[2]
+	}, []float64{3, -2, 5}, 50)
+
+	// One iteration can overshoot the budget by at most a shrink
+	if calls > 50+3 {
+		t.Errorf("expected about 50 evaluations, got %d", calls)
+	}
+}
+
+func TestLocalSearchElites(t *testing.T) {
+	next := 0.0
+	pop := NewPopulation(
+		10, 0, 0, 0,
+		func() float64 { next++; return next },
+		func(x float64) float64 { return -x },
+		func(a, b float64) (float64, float64) { return a, b },
+		func(x float64) float64 { return x },
+		Tournament(2),
+		nil,
+		false,
+	)
+
+	var calls atomic.Int32
+	pop.LocalSearch = func(x, fitness float64) (float64, float64) {
+		calls.Add(1)
+		return x / 2, -x / 2
+	}
+	pop.LocalSearchCount = 3
+
+	pop.evaluateAll()
+	pop.localSearch()
+
+	if calls.Load() != 3 {
+		t.Errorf("expected local search on 3 genomes, got %d", calls.Load())
+	}
+	want := []float64{0.5, 1, 1.5, 4}
+	for i, w := range want {
+		if pop.genomes[i] != w || pop.fitnesses[i] != -w {
+			t.Errorf("genome %d: expected %g with fitness %g, got %g with %g", i, w, -w, pop.genomes[i], pop.fitnesses[i])
+		}
+	}
+}
@@ -25,9 +25,26 @@ type Population[G any] struct {
 	cacheMutex sync.RWMutex
 	toKey      func(G) string
 
-	BeforeEvaluate func(*[]G)
-	AfterEvaluate  func([]float64)
-	AfterSelection func([]G)
+	// Size and SizedSelector, when both set, replace the selector with
+	// size-aware selection for bloat control
+	Size          func(G) int
+	SizedSelector SizedSelector
+
+	// LocalSearch, when set, refines genomes after each evaluation (a
+	// memetic step) and returns the refined genome and its fitness. It runs
+	// on the LocalSearchCount fittest genomes, or all of them if 0
+	LocalSearch      func(g G, fitness float64) (G, float64)
+	LocalSearchCount int
+
+	// Rand, when set, decides which offspring mutate instead of time-seeded
+	// generators, and variation runs on one goroutine in a fixed order. With
+	// a seeded selector, crossover and mutation too, runs are reproducible
+	Rand *rand.Rand
+
+	BeforeEvaluate       func(*[]G)
+	AfterEvaluate        func([]float64)
+	AfterEvaluateGenomes func([]G, []float64)
+	AfterSelection       func([]G)
 }
 
 func NewPopulation[G any](
@@ -120,11 +137,19 @@ func (p *Population[G]) Evolve(generations int) {
 
 		p.evaluateAll()
 
+		if p.LocalSearch != nil {
+			p.localSearch()
+		}
+
 		if p.AfterEvaluate != nil {
 			p.AfterEvaluate(p.fitnesses)
 		}
 
-		parentIndices := p.selector(p.fitnesses, len(p.genomes))
+		if p.AfterEvaluateGenomes != nil {
+			p.AfterEvaluateGenomes(p.genomes, p.fitnesses)
+		}
+
+		parentIndices := p.selectParents()
 
 		offspring := make([]G, len(p.genomes))
 
@@ -134,41 +159,51 @@ func (p *Population[G]) Evolve(generations int) {
 			idx2 int
 		}
 
-		jobs := make(chan job, len(parentIndices)/2)
-		var wg sync.WaitGroup
+		vary := func(j job, rng *rand.Rand) {
+			c1, c2 := p.crossover(p.genomes[j.idx1], p.genomes[j.idx2])
 
-		for w := 0; w < p.numWorkers; w++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				localRng := rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), uint64(w)))
+			if rng.Float64() < p.mutationRate {
+				c1 = p.mutate(c1)
+			}
+			if rng.Float64() < p.mutationRate {
+				c2 = p.mutate(c2)
+			}
 
-				for j := range jobs {
-					c1, c2 := p.crossover(p.genomes[j.idx1], p.genomes[j.idx2])
+			offspring[j.idx] = c1
+			offspring[j.idx+1] = c2
+		}
 
-					if localRng.Float64() < p.mutationRate {
-						c1 = p.mutate(c1)
-					}
-					if localRng.Float64() < p.mutationRate {
-						c2 = p.mutate(c2)
+		if p.Rand != nil {
+			for i := 0; i < len(parentIndices)-1; i += 2 {
+				vary(job{idx: i, idx1: parentIndices[i], idx2: parentIndices[i+1]}, p.Rand)
+			}
+		} else {
+			jobs := make(chan job, len(parentIndices)/2)
+			var wg sync.WaitGroup
+
+			for w := 0; w < p.numWorkers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					localRng := rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), uint64(w)))
+
+					for j := range jobs {
+						vary(j, localRng)
 					}
+				}()
+			}
 
-					offspring[j.idx] = c1
-					offspring[j.idx+1] = c2
+			for i := 0; i < len(parentIndices)-1; i += 2 {
+				jobs <- job{
+					idx:  i,
+					idx1: parentIndices[i],
+					idx2: parentIndices[i+1],
 				}
-			}()
-		}
-
-		for i := 0; i < len(parentIndices)-1; i += 2 {
-			jobs <- job{
-				idx:  i,
-				idx1: parentIndices[i],
-				idx2: parentIndices[i+1],
 			}
-		}
 
-		close(jobs)
-		wg.Wait()
+			close(jobs)
+			wg.Wait()
+		}
 
 		totalFitness := 0.0
 		bestFitness := -math.MaxFloat64
@@ -209,6 +244,18 @@ func (p *Population[G]) Evolve(generations int) {
 		sum += t
 	}
 }
+func (p *Population[G]) selectParents() []int {
+	if p.Size == nil || p.SizedSelector == nil {
+		return p.selector(p.fitnesses, len(p.genomes))
+	}
+
+	sizes := make([]int, len(p.genomes))
+	for i, g := range p.genomes {
+		sizes[i] = p.Size(g)
+	}
+	return p.SizedSelector(p.fitnesses, sizes, len(p.genomes))
+}
+
 func (p *Population[G]) getElite() []G {
 	indices := make([]int, len(p.genomes))
 	for i := range indices {
@@ -1,9 +1,10 @@
 package ea
 
 import (
-	"bufio"
+	"math"
 	"math/rand/v2"
-	"os"
+	"slices"
+	"strconv"
 	"testing"
 
 	"github.com/danielkennedy1/sieve/genomes"
@@ -16,14 +17,11 @@ var testGrammar genomes.Grammar
 
 func init() {
 	// Load the grammar file
-	f, err := os.Open("../data/lecture.bnf")
+	var err error
+	testGrammar, err = grammar.ParseFile("../data/lecture.bnf")
 	if err != nil {
-		panic("Could not open grammar file: " + err.Error())
+		panic("Could not load grammar file: " + err.Error())
 	}
-	defer f.Close()
-
-	s := bufio.NewScanner(f)
-	testGrammar = grammar.Parse(*s)
 	testGrammar.BuildRuleMap()
 
 	// Define test samples
@@ -148,3 +146,31 @@ func benchmarkWithPopSize(b *testing.B, popSize int) {
 		pop.Evolve(10)
 	}
 }
+
+func TestSeededEvolveIsReproducible(t *testing.T) {
+	run := func() []float64 {
+		r := rand.New(rand.NewPCG(1, 2))
+		pop := NewPopulation(
+			20,
+			0.5,
+			0.9,
+			1,
+			func() float64 { return r.Float64() * 10 },
+			func(x float64) float64 { return -math.Abs(x - 3) },
+			func(a, b float64) (float64, float64) {
+				w := r.Float64()
+				return w*a + (1-w)*b, w*b + (1-w)*a
+			},
+			func(x float64) float64 { return x + r.NormFloat64() },
+			SeededTournament(3, r),
+			func(x float64) string { return strconv.FormatFloat(x, 'g', -1, 64) },
+			false,
+		)
+		pop.Rand = r
+		pop.Evolve(5)
+		return pop.genomes
+	}
+	if a, b := run(), run(); !slices.Equal(a, b) {
+		t.Errorf("runs from the same seed differ:\n%v\n%v", a, b)
+	}
+}
@@ -6,6 +6,16 @@ import (
 )
 
 func Tournament(k int) func([]float64, int) []int {
+	return tournament(k, rand.IntN)
+}
+
+// SeededTournament is Tournament drawing candidates from rng, for
+// reproducible runs.
+func SeededTournament(k int, rng *rand.Rand) func([]float64, int) []int {
+	return tournament(k, rng.IntN)
+}
+
+func tournament(k int, intN func(int) int) func([]float64, int) []int {
 	return func(fitnesses []float64, n int) []int {
 		selected := make([]int, n)
 		popSize := len(fitnesses)
@@ -14,13 +24,13 @@ func Tournament(k int) func([]float64, int) []int {
 			tournamentCandidates := make([]int, 0, k)
 
 			// Initial best candidate
-			best := rand.IntN(popSize)
+			best := intN(popSize)
 			bestFit := fitnesses[best]
 			tournamentCandidates = append(tournamentCandidates, best)
 
 			// Compare against k-1 other candidates
 			for j := 1; j < k; j++ {
-				candidate := rand.IntN(popSize)
+				candidate := intN(popSize)
 				tournamentCandidates = append(tournamentCandidates, candidate)
 				if fitnesses[candidate] > bestFit {
 					best = candidate
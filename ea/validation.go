@@ -0,0 +1,56 @@
+package ea
+
+import "math"
+
+// ValidationRecord is the fitness of one generation's best genome on the
+// training, validation and test data.
+type ValidationRecord struct {
+	Generation int
+	Train      float64
+	Validation float64
+	Test       float64
+}
+
+// Validation tracks how each generation's fittest genome does on held-out
+// data, to detect overfitting, and keeps the one that scored best on
+// validation as the final model. It prints nothing; callers report History
+// or Best as they need.
+type Validation[G any] struct {
+	validate, test func(G) float64
+
+	History        []ValidationRecord
+	Best           G
+	BestValidation float64
+	BestTest       float64
+}
+
+// NewValidation scores genomes on held-out data with validate and test,
+// fitness functions built like the training one but on other samples.
+// Its Record method fits the AfterEvaluateGenomes hook.
+func NewValidation[G any](validate, test func(G) float64) *Validation[G] {
+	return &Validation[G]{validate: validate, test: test, BestValidation: math.Inf(-1)}
+}
+
+func (v *Validation[G]) Record(genomes []G, fitnesses []float64) {
+	best := -1
+	for i, f := range fitnesses {
+		if !math.IsInf(f, 0) && !math.IsNaN(f) && (best < 0 || f > fitnesses[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return
+	}
+
+	r := ValidationRecord{
+		Generation: len(v.History),
+		Train:      fitnesses[best],
+		Validation: v.validate(genomes[best]),
+		Test:       v.test(genomes[best]),
+	}
+	v.History = append(v.History, r)
+
+	if r.Validation > v.BestValidation || len(v.History) == 1 {
+		v.Best, v.BestValidation, v.BestTest = genomes[best], r.Validation, r.Test
+	}
+}
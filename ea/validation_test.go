@@ -0,0 +1,28 @@
+package ea
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValidationSelectsOnValidation(t *testing.T) {
+	// Genomes are their own training fitness; validation peaks at 2, as if
+	// larger genomes overfit
+	validate := func(g float64) float64 { return -math.Abs(g - 2) }
+	test := func(g float64) float64 { return -math.Abs(g - 2.5) }
+	v := NewValidation(validate, test)
+
+	for _, generation := range [][]float64{{0, 1}, {2, 1}, {3, math.Inf(1)}, {4, 1}} {
+		v.Record(generation, generation)
+	}
+
+	if len(v.History) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(v.History))
+	}
+	if r := v.History[3]; r.Train != 4 || r.Validation != -2 || r.Test != -1.5 {
+		t.Errorf("unexpected last record %+v", r)
+	}
+	if v.Best != 2 || v.BestValidation != 0 || v.BestTest != -0.5 {
+		t.Errorf("expected genome 2 chosen on validation, got %v (validation %v, test %v)", v.Best, v.BestValidation, v.BestTest)
+	}
+}
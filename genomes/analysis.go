@@ -0,0 +1,312 @@
+package genomes
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return "?"
+	}
+}
+
+type Issue struct {
+	Severity Severity
+	Rule     string
+	Message  string
+}
+
+func (i Issue) String() string {
+	if i.Rule == "" {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Rule, i.Message)
+}
+
+type Recursion int
+
+const (
+	NotRecursive Recursion = iota
+	DirectlyRecursive
+	IndirectlyRecursive
+)
+
+func (r Recursion) String() string {
+	switch r {
+	case NotRecursive:
+		return "none"
+	case DirectlyRecursive:
+		return "direct"
+	case IndirectlyRecursive:
+		return "indirect"
+	default:
+		return "?"
+	}
+}
+
+type RuleReport struct {
+	Left        string
+	Productions int
+	Recursion   Recursion
+	Reachable   bool
+	// MinDepth is the shallowest derivation tree that fully terminates this
+	// non-terminal, or -1 if it never terminates.
+	MinDepth int
+}
+
+type GrammarReport struct {
+	Rules  []RuleReport
+	Issues []Issue
+}
+
+func (r GrammarReport) HasErrors() bool {
+	for _, i := range r.Issues {
+		if i.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+func (r GrammarReport) String() string {
+	var sb strings.Builder
+
+	width := 0
+	for _, rule := range r.Rules {
+		width = max(width, len(rule.Left))
+	}
+
+	sb.WriteString("Rules:\n")
+	for _, rule := range r.Rules {
+		depth := "never"
+		if rule.MinDepth >= 0 {
+			depth = fmt.Sprint(rule.MinDepth)
+		}
+		fmt.Fprintf(&sb, "  %-*s  productions=%-4d min depth=%-6s recursion=%-9s reachable=%t\n",
+			width, rule.Left, rule.Productions, depth, rule.Recursion, rule.Reachable)
+	}
+
+	errors, warnings := 0, 0
+	if len(r.Issues) > 0 {
+		sb.WriteString("\nIssues:\n")
+		for _, i := range r.Issues {
+			if i.Severity == Error {
+				errors++
+			} else {
+				warnings++
+			}
+			sb.WriteString("  ")
+			sb.WriteString(i.String())
+			sb.WriteByte('\n')
+		}
+	}
+	fmt.Fprintf(&sb, "\n%d error(s), %d warning(s)\n", errors, warnings)
+
+	return sb.String()
+}
+
+// AnalyseGrammar checks the grammar for structural problems and reports
+// per-rule recursion, reachability and minimum derivation depth. Modulo bias
+// is judged for 8-bit codons.
+func AnalyseGrammar(g Grammar) GrammarReport {
+	return AnalyseGrammarWidth(g, Codon8)
+}
+
+// AnalyseGrammarWidth is AnalyseGrammar for codons of the given width.
+func AnalyseGrammarWidth(g Grammar, width CodonWidth) GrammarReport {
+	var report GrammarReport
+
+	if len(g.Rules) == 0 {
+		report.Issues = append(report.Issues, Issue{Severity: Error, Message: "grammar has no rules"})
+		return report
+	}
+
+	rules := map[string]*Rule{}
+	for i := range g.Rules {
+		r := &g.Rules[i]
+
+		if !isNonTerminal(r.Left) {
+			report.Issues = append(report.Issues, Issue{Error, r.Left, "left-hand side is not a non-terminal"})
+		}
+		if _, ok := rules[r.Left]; ok {
+			report.Issues = append(report.Issues, Issue{Error, r.Left, "non-terminal defined more than once"})
+			continue
+		}
+		rules[r.Left] = r
+
+		if len(r.Productions) == 0 {
+			report.Issues = append(report.Issues, Issue{Error, r.Left, "rule has no productions"})
+		}
+	}
+
+	// Direct references from each rule to the non-terminals in its productions
+	refs := map[string][]string{}
+	for i := range g.Rules {
+		r := &g.Rules[i]
+		left := r.Left
+		if rules[left] != r {
+			continue
+		}
+
+		seen := map[string]bool{}
+		for _, p := range r.Productions {
+			for _, e := range p.Elements {
+				if !isNonTerminal(e) {
+					continue
+				}
+				if _, ok := rules[e]; !ok {
+					if !seen[e] {
+						report.Issues = append(report.Issues, Issue{Error, left, fmt.Sprintf("undefined non-terminal %s", e)})
+					}
+				} else if !seen[e] {
+					refs[left] = append(refs[left], e)
+				}
+				seen[e] = true
+			}
+		}
+	}
+
+	reachableFrom := func(start string) map[string]bool {
+		visited := map[string]bool{}
+		stack := append([]string{}, refs[start]...)
+		for len(stack) > 0 {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if visited[n] {
+				continue
+			}
+			visited[n] = true
+			stack = append(stack, refs[n]...)
+		}
+		return visited
+	}
+
+	start := g.Rules[0].Left
+	reachable := reachableFrom(start)
+	reachable[start] = true
+
+	depths := minDepths(rules)
+
+	emitted := map[string]bool{}
+	for _, r := range g.Rules {
+		if emitted[r.Left] {
+			continue
+		}
+		emitted[r.Left] = true
+
+		recursion := NotRecursive
+		for _, ref := range refs[r.Left] {
+			if ref == r.Left {
+				recursion = DirectlyRecursive
+			}
+		}
+		if recursion == NotRecursive && reachableFrom(r.Left)[r.Left] {
+			recursion = IndirectlyRecursive
+		}
+
+		depth, ok := depths[r.Left]
+		if !ok {
+			depth = -1
+		}
+
+		report.Rules = append(report.Rules, RuleReport{
+			Left:        r.Left,
+			Productions: len(r.Productions),
+			Recursion:   recursion,
+			Reachable:   reachable[r.Left],
+			MinDepth:    depth,
+		})
+
+		if !reachable[r.Left] {
+			report.Issues = append(report.Issues, Issue{Warning, r.Left, fmt.Sprintf("unreachable from start symbol %s", start)})
+		}
+		if depth < 0 {
+			report.Issues = append(report.Issues, Issue{Error, r.Left, "non-productive: no derivation terminates"})
+		}
+		if issue, ok := moduloBias(r, width.Values()); ok {
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+
+	return report
+}
+
+// minDepths computes, by fixpoint, the minimum derivation depth of every
+// rule that can derive a terminal string. Non-productive rules are absent.
+func minDepths(rules map[string]*Rule) map[string]int {
+	depths := map[string]int{}
+
+	for changed := true; changed; {
+		changed = false
+		for left, r := range rules {
+			best := math.MaxInt
+			for _, p := range r.Productions {
+				deepest := 0
+				for _, e := range p.Elements {
+					if _, isRule := rules[e]; !isRule {
+						continue
+					}
+					d, ok := depths[e]
+					if !ok {
+						deepest = math.MaxInt
+						break
+					}
+					deepest = max(deepest, d)
+				}
+				if deepest < math.MaxInt {
+					best = min(best, deepest+1)
+				}
+			}
+			if cur, ok := depths[left]; best < math.MaxInt && (!ok || best < cur) {
+				depths[left] = best
+				changed = true
+			}
+		}
+	}
+
+	return depths
+}
+
+// moduloBias warns when codon % len(productions) favours some productions
+// noticeably over others, or cannot reach some productions at all.
+func moduloBias(r Rule, codonValues uint64) (Issue, bool) {
+	n := uint64(len(r.Productions))
+	if n == 0 {
+		return Issue{}, false
+	}
+
+	if n > codonValues {
+		return Issue{Warning, r.Left, fmt.Sprintf(
+			"%d productions but codons only take %d values: productions %d..%d are unreachable",
+			n, codonValues, codonValues, n-1)}, true
+	}
+
+	extra := codonValues % n
+	if extra == 0 {
+		return Issue{}, false
+	}
+
+	low := codonValues / n
+	bias := float64(low+1)/float64(low) - 1
+	if bias < 0.1 {
+		return Issue{}, false
+	}
+
+	return Issue{Warning, r.Left, fmt.Sprintf(
+		"%d productions bias modulo mapping: productions 0..%d are %.0f%% more likely than the rest",
+		n, extra-1, bias*100)}, true
+}
@@ -0,0 +1,91 @@
+package genomes_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+func TestAnalyseLectureGrammar(t *testing.T) {
+	report := genomes.AnalyseGrammar(genomes.NewTestLectureExampleGrammar())
+
+	if len(report.Issues) != 0 {
+		t.Errorf("Expected no issues, got %v", report.Issues)
+	}
+
+	want := map[string]struct {
+		depth     int
+		recursion genomes.Recursion
+	}{
+		"<expr>":  {3, genomes.DirectlyRecursive},
+		"<op>":    {1, genomes.NotRecursive},
+		"<var>":   {2, genomes.NotRecursive},
+		"<input>": {1, genomes.NotRecursive},
+		"<prc>":   {1, genomes.NotRecursive},
+	}
+	for _, r := range report.Rules {
+		if r.MinDepth != want[r.Left].depth || r.Recursion != want[r.Left].recursion {
+			t.Errorf("%s: got depth %d recursion %s, want depth %d recursion %s",
+				r.Left, r.MinDepth, r.Recursion, want[r.Left].depth, want[r.Left].recursion)
+		}
+	}
+}
+
+func TestAnalyseGrammarIssues(t *testing.T) {
+	ints := make([]genomes.Production, 200)
+	for i := range ints {
+		ints[i] = genomes.Production{Elements: []string{fmt.Sprint(i)}}
+	}
+
+	gr := genomes.Grammar{
+		Rules: []genomes.Rule{
+			{Left: "<start>", Productions: []genomes.Production{
+				{Elements: []string{"<a>", "<missing>", "<int>"}},
+			}},
+			{Left: "<a>", Productions: []genomes.Production{
+				{Elements: []string{"<b>"}},
+			}},
+			{Left: "<b>", Productions: []genomes.Production{
+				{Elements: []string{"<a>", "x"}},
+			}},
+			{Left: "<int>", Productions: ints},
+			{Left: "<orphan>", Productions: []genomes.Production{
+				{Elements: []string{"y"}},
+			}},
+			{Left: "<orphan>", Productions: []genomes.Production{
+				{Elements: []string{"z"}},
+			}},
+		},
+	}
+
+	report := genomes.AnalyseGrammar(gr)
+
+	if !report.HasErrors() {
+		t.Fatalf("Expected errors, got none")
+	}
+	if genomes.ValidateGrammar(gr) {
+		t.Errorf("ValidateGrammar should reject a grammar with errors")
+	}
+
+	out := report.String()
+	for _, want := range []string{
+		"error: <start>: undefined non-terminal <missing>",
+		"error: <orphan>: non-terminal defined more than once",
+		"warning: <orphan>: unreachable from start symbol <start>",
+		"error: <a>: non-productive",
+		"error: <b>: non-productive",
+		"warning: <int>: 200 productions bias modulo mapping: productions 0..55",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Report missing %q:\n%s", want, out)
+		}
+	}
+
+	for _, r := range report.Rules {
+		if r.Left == "<a>" && r.Recursion != genomes.IndirectlyRecursive {
+			t.Errorf("<a> should be indirectly recursive, got %s", r.Recursion)
+		}
+	}
+}
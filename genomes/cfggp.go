@@ -0,0 +1,291 @@
+package genomes
+
+import (
+	"math"
+	"math/rand/v2"
+)
+
+// DerivationTree is a CFG-GP genome (Whigham): the derivation tree is
+// evolved directly, with crossover and mutation acting on subtrees rooted at
+// the same non-terminal so every offspring is a valid derivation.
+type DerivationTree struct {
+	Root       *GrammarNode
+	Attributes map[string]any
+}
+
+func (t DerivationTree) String() string {
+	return t.Root.String()
+}
+
+// Size and Depth measure the tree for bloat control.
+func (t DerivationTree) Size() int {
+	return t.Root.Size()
+}
+
+func (t DerivationTree) Depth() int {
+	return t.Root.Depth()
+}
+
+func (t DerivationTree) clone() DerivationTree {
+	return DerivationTree{Root: t.Root.clone()}
+}
+
+func (node *GrammarNode) clone() *GrammarNode {
+	c := &GrammarNode{token: node.token, production: node.production, violated: node.violated}
+	if node.children != nil {
+		c.children = make([]*GrammarNode, len(node.children))
+		for i, child := range node.children {
+			c.children[i] = child.clone()
+		}
+	}
+	return c
+}
+
+// treeGrower derives random subtrees within a depth limit, where depth
+// counts nodes down to and including the terminal leaves, as in
+// GrammarNode.Depth.
+type treeGrower struct {
+	gr  Grammar
+	rng *rand.Rand
+	// minDepth is the shallowest complete subtree each non-terminal can
+	// derive
+	minDepth map[string]int
+}
+
+func newTreeGrower(gr Grammar, rng *rand.Rand) treeGrower {
+	rules := make(map[string]*Rule, len(gr.Rules))
+	for i := range gr.Rules {
+		rules[gr.Rules[i].Left] = &gr.Rules[i]
+	}
+	depths := minDepths(rules)
+	for left, d := range depths {
+		// minDepths does not count the terminal leaves
+		depths[left] = d + 1
+	}
+	gr.BuildRuleMap()
+	return treeGrower{gr: gr, rng: rng, minDepth: depths}
+}
+
+// productionDepth is the shallowest subtree the production can derive.
+func (t treeGrower) productionDepth(p Production) int {
+	deepest := 0
+	for _, e := range p.Elements {
+		d := 1
+		if t.gr.getRule(e) != nil {
+			var ok bool
+			if d, ok = t.minDepth[e]; !ok {
+				return math.MaxInt
+			}
+		}
+		deepest = max(deepest, d)
+	}
+	return deepest + 1
+}
+
+// grow derives token with productions chosen uniformly among those that fit
+// in depth, or the shallowest production if none does. A subtree that keeps
+// breaking its conditions is tried with each production in turn, and marked
+// violated if none works.
+func (t treeGrower) grow(token string, depth int) *GrammarNode {
+	rule := t.gr.getRule(token)
+	if rule == nil {
+		return &GrammarNode{token: token}
+	}
+
+	var fitting []int
+	shallowest := 0
+	for i, p := range rule.Productions {
+		d := t.productionDepth(p)
+		if d <= depth {
+			fitting = append(fitting, i)
+		}
+		if d < t.productionDepth(rule.Productions[shallowest]) {
+			shallowest = i
+		}
+	}
+
+	for range maxConditionRetries {
+		prodIdx := shallowest
+		if len(fitting) > 0 {
+			prodIdx = fitting[t.rng.IntN(len(fitting))]
+		}
+		node := t.build(rule, prodIdx, depth)
+		if satisfiesConditions(t.gr, node) {
+			return node
+		}
+	}
+	for i := range rule.Productions {
+		node := t.build(rule, (shallowest+i)%len(rule.Productions), depth)
+		if satisfiesConditions(t.gr, node) {
+			return node
+		}
+	}
+	node := t.build(rule, shallowest, depth)
+	node.violated = true
+	return node
+}
+
+func (t treeGrower) build(rule *Rule, prodIdx, depth int) *GrammarNode {
+	production := rule.Productions[prodIdx]
+	children := make([]*GrammarNode, 0, len(production.Elements))
+	for _, e := range production.Elements {
+		children = append(children, t.grow(e, depth-1))
+	}
+	return &GrammarNode{token: rule.Left, children: children, production: prodIdx}
+}
+
+// satisfiesConditions checks the conditions of every production in the
+// tree.
+func satisfiesConditions(gr Grammar, root *GrammarNode) bool {
+	ok := true
+	root.Walk(func(n *GrammarNode, _ int) bool {
+		if n.IsTerminal() || !ok {
+			return false
+		}
+		rule := gr.getRule(n.token)
+		if rule == nil {
+			return true
+		}
+		for _, c := range rule.Productions[n.production].Conditions {
+			if !c.holds(n.children) {
+				ok = false
+			}
+		}
+		return ok
+	})
+	return ok
+}
+
+// NewCreateDerivationTree grows random trees, redrawing any that break a
+// condition. If every attempt does, the tree is returned with Valid false so
+// fitness functions can score it -Inf.
+func NewCreateDerivationTree(gr Grammar, maxDepth int, rng *rand.Rand) func() DerivationTree {
+	grower := newTreeGrower(gr, rng)
+	return func() DerivationTree {
+		root := grower.grow(gr.Rules[0].Left, maxDepth)
+		for range maxConditionRetries {
+			if satisfiesConditions(gr, root) {
+				break
+			}
+			root = grower.grow(gr.Rules[0].Left, maxDepth)
+		}
+		return DerivationTree{Root: root}
+	}
+}
+
+// Valid reports whether the tree meets its grammar's conditions; see
+// GrammarNode.Valid.
+func (t DerivationTree) Valid() bool {
+	return t.Root.Valid()
+}
+
+// nonTerminals lists the tree's non-terminal nodes with their distance from
+// the root.
+func nonTerminals(root *GrammarNode) ([]*GrammarNode, []int) {
+	var nodes []*GrammarNode
+	var depths []int
+	root.Walk(func(n *GrammarNode, depth int) bool {
+		if !n.IsTerminal() {
+			nodes = append(nodes, n)
+			depths = append(depths, depth)
+		}
+		return true
+	})
+	return nodes, depths
+}
+
+func NewSubtreeCrossover(gr Grammar, maxDepth int, rng *rand.Rand) func(t1, t2 DerivationTree) (DerivationTree, DerivationTree) {
+	return func(t1, t2 DerivationTree) (DerivationTree, DerivationTree) {
+		return SubtreeCrossover(gr, t1, t2, maxDepth, rng)
+	}
+}
+
+// SubtreeCrossover swaps a random subtree of t1 with one of t2 rooted at the
+// same non-terminal. Swaps that exceed maxDepth or break a condition are
+// redrawn, and the parents are returned unchanged if none is found.
+func SubtreeCrossover(gr Grammar, t1, t2 DerivationTree, maxDepth int, rng *rand.Rand) (DerivationTree, DerivationTree) {
+	for range maxCrossoverAttempts {
+		c1, c2 := t1.clone(), t2.clone()
+		nodes1, _ := nonTerminals(c1.Root)
+		nodes2, _ := nonTerminals(c2.Root)
+		if len(nodes1) == 0 {
+			break
+		}
+
+		n1 := nodes1[rng.IntN(len(nodes1))]
+		var matches []*GrammarNode
+		for _, n := range nodes2 {
+			if n.token == n1.token {
+				matches = append(matches, n)
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		n2 := matches[rng.IntN(len(matches))]
+
+		*n1, *n2 = *n2, *n1
+		if c1.Depth() > maxDepth || c2.Depth() > maxDepth ||
+			!satisfiesConditions(gr, c1.Root) || !satisfiesConditions(gr, c2.Root) {
+			continue
+		}
+		return c1, c2
+	}
+	return t1.clone(), t2.clone()
+}
+
+// NewSubtreeMutation regrows a random subtree from its non-terminal within
+// the depth left under maxDepth.
+func NewSubtreeMutation(gr Grammar, maxDepth int, rng *rand.Rand) func(t DerivationTree) DerivationTree {
+	grower := newTreeGrower(gr, rng)
+	return func(t DerivationTree) DerivationTree {
+		for range maxConditionRetries {
+			c := t.clone()
+			nodes, depths := nonTerminals(c.Root)
+			if len(nodes) == 0 {
+				return c
+			}
+
+			i := rng.IntN(len(nodes))
+			*nodes[i] = *grower.grow(nodes[i].token, maxDepth-depths[i])
+			if satisfiesConditions(gr, c.Root) {
+				return c
+			}
+		}
+		return t.clone()
+	}
+}
+
+// NewSeededCreateDerivationTree parses each seed phenotype into the first
+// trees created, then falls back to create.
+func NewSeededCreateDerivationTree(seeds []*GrammarNode, create func() DerivationTree) func() DerivationTree {
+	next := 0
+	return func() DerivationTree {
+		if next < len(seeds) {
+			next++
+			return DerivationTree{Root: seeds[next-1].clone()}
+		}
+		return create()
+	}
+}
+
+// ProductionFeatures labels the productions the tree uses, like
+// NewProductionFeatures does for genotypes.
+func (t DerivationTree) ProductionFeatures(gr Grammar) []string {
+	seen := map[string]bool{}
+	var features []string
+	t.Root.Walk(func(n *GrammarNode, _ int) bool {
+		if n.IsTerminal() {
+			return false
+		}
+		if rule := gr.getRule(n.token); rule != nil {
+			label := rule.ProductionLabel(n.production)
+			if !seen[label] {
+				seen[label] = true
+				features = append(features, label)
+			}
+		}
+		return true
+	})
+	return features
+}
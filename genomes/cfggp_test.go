@@ -0,0 +1,123 @@
+package genomes_test
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+func TestCreateDerivationTree(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	for _, maxDepth := range []int{4, 6, 10} {
+		create := genomes.NewCreateDerivationTree(gr, maxDepth, rng)
+		for range 100 {
+			tree := create()
+			if d := tree.Depth(); d > maxDepth {
+				t.Fatalf("Tree %q has depth %d, above %d", tree, d, maxDepth)
+			}
+			if _, err := genomes.ParsePhenotype(gr, tree.String()); err != nil {
+				t.Fatalf("Tree %q is not derivable: %v", tree, err)
+			}
+		}
+	}
+
+	// Too shallow for any derivation: the shallowest one is grown instead
+	tree := genomes.NewCreateDerivationTree(gr, 1, rng)()
+	if tree.Depth() != 4 {
+		t.Errorf("Expected the shallowest derivation (depth 4), got %q with depth %d", tree, tree.Depth())
+	}
+}
+
+func TestSubtreeCrossoverAndMutation(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	rng := rand.New(rand.NewPCG(3, 4))
+	maxDepth := 8
+
+	create := genomes.NewCreateDerivationTree(gr, maxDepth, rng)
+	crossover := genomes.NewSubtreeCrossover(gr, maxDepth, rng)
+	mutate := genomes.NewSubtreeMutation(gr, maxDepth, rng)
+
+	changed := 0
+	for range 200 {
+		p1, p2 := create(), create()
+		s1, s2 := p1.String(), p2.String()
+
+		c1, c2 := crossover(p1, p2)
+		m := mutate(c1)
+		for _, child := range []genomes.DerivationTree{c1, c2, m} {
+			if d := child.Depth(); d > maxDepth {
+				t.Fatalf("Offspring %q has depth %d, above %d", child, d, maxDepth)
+			}
+			if _, err := genomes.ParsePhenotype(gr, child.String()); err != nil {
+				t.Fatalf("Offspring %q is not derivable: %v", child, err)
+			}
+		}
+		if p1.String() != s1 || p2.String() != s2 {
+			t.Fatalf("Parents were modified")
+		}
+		if c1.String() != s1 || m.String() != c1.String() {
+			changed++
+		}
+	}
+	if changed == 0 {
+		t.Errorf("Expected crossover and mutation to change some trees")
+	}
+}
+
+func TestDerivationTreeConditions(t *testing.T) {
+	distinct, _ := genomes.ParseCondition("distinct", []string{"1", "3"})
+	gr := comparisonGrammar(distinct)
+	rng := rand.New(rand.NewPCG(5, 6))
+
+	create := genomes.NewCreateDerivationTree(gr, 5, rng)
+	crossover := genomes.NewSubtreeCrossover(gr, 5, rng)
+	mutate := genomes.NewSubtreeMutation(gr, 5, rng)
+
+	check := func(tree genomes.DerivationTree) {
+		operands := strings.Split(tree.String(), " > ")
+		if len(operands) != 2 || operands[0] == operands[1] || !tree.Valid() {
+			t.Fatalf("%q breaks !distinct(1,3)", tree)
+		}
+	}
+	for range 200 {
+		p1, p2 := create(), create()
+		c1, c2 := crossover(p1, p2)
+		for _, tree := range []genomes.DerivationTree{p1, p2, c1, c2, mutate(p1)} {
+			check(tree)
+		}
+	}
+}
+
+func TestUnsatisfiableDerivationTreeIsInvalid(t *testing.T) {
+	// No operand is a number at most 0.5
+	inRange, _ := genomes.ParseCondition("range", []string{"3", "0", "0.5"})
+	gr := comparisonGrammar(inRange)
+
+	tree := genomes.NewCreateDerivationTree(gr, 5, rand.New(rand.NewPCG(7, 8)))()
+	if tree.Valid() {
+		t.Errorf("Expected %q to be invalid", tree)
+	}
+}
+
+func TestSeededCreateDerivationTree(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	seed, err := genomes.ParsePhenotype(gr, "a * b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := genomes.NewSeededCreateDerivationTree([]*genomes.GrammarNode{seed},
+		genomes.NewCreateDerivationTree(gr, 6, rand.New(rand.NewPCG(7, 8))))
+	if got := create().String(); got != "a * b" {
+		t.Errorf("Expected the seed first, got %q", got)
+	}
+
+	features := create().ProductionFeatures(gr)
+	if len(features) == 0 || !strings.HasPrefix(features[0], "<expr> ::= ") {
+		t.Errorf("Expected features to start at the root production, got %q", features)
+	}
+}
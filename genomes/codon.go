@@ -0,0 +1,73 @@
+package genomes
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+)
+
+// CodonWidth is the number of bits in a codon. Wider codons keep the modulo
+// mapping unbiased for rules with many productions.
+type CodonWidth uint8
+
+const (
+	Codon8  CodonWidth = 8
+	Codon16 CodonWidth = 16
+	Codon32 CodonWidth = 32
+)
+
+func ParseCodonWidth(bits int) (CodonWidth, error) {
+	switch bits {
+	case 0, 8:
+		return Codon8, nil
+	case 16:
+		return Codon16, nil
+	case 32:
+		return Codon32, nil
+	}
+	return 0, fmt.Errorf("unsupported codon width %d: use 8, 16 or 32", bits)
+}
+
+// Values is the number of distinct values a codon can take.
+func (w CodonWidth) Values() uint64 {
+	if w == 0 {
+		return 1 << Codon8
+	}
+	return 1 << w
+}
+
+func (w CodonWidth) random(rng *rand.Rand) uint32 {
+	return uint32(rng.Uint64N(w.Values()))
+}
+
+// CodonWidth is the genotype's codon width; the zero value means 8 bits.
+func (g Genotype) CodonWidth() CodonWidth {
+	if g.Width == 0 {
+		return Codon8
+	}
+	return g.Width
+}
+
+// Key encodes the codons as a string, using as many bytes per codon as the
+// width needs, for use as a fitness cache key.
+func (g Genotype) Key() string {
+	size := int(g.CodonWidth()) / 8
+	buf := make([]byte, len(g.Genes)*size)
+	for i, c := range g.Genes {
+		switch size {
+		case 1:
+			buf[i] = byte(c)
+		case 2:
+			binary.LittleEndian.PutUint16(buf[i*2:], uint16(c))
+		default:
+			binary.LittleEndian.PutUint32(buf[i*4:], c)
+		}
+	}
+	return string(buf)
+}
+
+// codonChoice picks one of n options by codon % n, in uint32 arithmetic so
+// 32-bit codons never go negative where int is 32 bits.
+func codonChoice(codon uint32, n int) int {
+	return int(codon % uint32(n))
+}
@@ -0,0 +1,125 @@
+package genomes_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+func TestParseCodonWidth(t *testing.T) {
+	for bits, want := range map[int]genomes.CodonWidth{0: genomes.Codon8, 8: genomes.Codon8, 16: genomes.Codon16, 32: genomes.Codon32} {
+		got, err := genomes.ParseCodonWidth(bits)
+		if err != nil || got != want {
+			t.Errorf("ParseCodonWidth(%d) = %d, %v; want %d", bits, got, err, want)
+		}
+	}
+	if _, err := genomes.ParseCodonWidth(12); err == nil {
+		t.Errorf("Expected an error for a 12-bit codon width")
+	}
+}
+
+func TestCreateGenotypeWidth(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	for _, width := range []genomes.CodonWidth{genomes.Codon8, genomes.Codon16, genomes.Codon32} {
+		g := genomes.NewCreateGenotypeWidth(500, width, r)()
+		if g.Width != width {
+			t.Errorf("Expected width %d, got %d", width, g.Width)
+		}
+		exceeded := false
+		for _, c := range g.Genes {
+			if uint64(c) >= width.Values() {
+				t.Fatalf("Codon %d out of range for width %d", c, width)
+			}
+			exceeded = exceeded || c > 255
+		}
+		if width != genomes.Codon8 && !exceeded {
+			t.Errorf("Expected %d-bit codons above 255", width)
+		}
+	}
+}
+
+func TestKeyDistinguishesWideCodons(t *testing.T) {
+	a := genomes.Genotype{Genes: []uint32{1, 256}, Width: genomes.Codon16}
+	b := genomes.Genotype{Genes: []uint32{1, 0}, Width: genomes.Codon16}
+	if a.Key() == b.Key() {
+		t.Errorf("Expected different keys for %v and %v", a.Genes, b.Genes)
+	}
+	if len(a.Key()) != 4 {
+		t.Errorf("Expected 2 bytes per 16-bit codon, got key of length %d", len(a.Key()))
+	}
+
+	narrow := genomes.Genotype{Genes: []uint32{7, 9}}
+	if narrow.Key() != "\x07\x09" {
+		t.Errorf("Expected one byte per 8-bit codon, got %q", narrow.Key())
+	}
+}
+
+func TestMapWideCodons(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	narrow := genomes.Genotype{Genes: []uint32{0, 2, 1, 1, 0, 0, 2, 0}}
+	// 256 + c has the same residue as c for every rule of at most 4 productions
+	wide := genomes.Genotype{Width: genomes.Codon16}
+	for _, c := range narrow.Genes {
+		wide.Genes = append(wide.Genes, 1024+c)
+	}
+
+	if got, want := wide.MapToGrammar(gr, 100).String(), narrow.MapToGrammar(gr, 100).String(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestMapCodonsAboveInt32(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	narrow := genomes.Genotype{Genes: []uint32{0, 2, 1, 1, 0, 0, 2, 0}}
+	// 2^32 - 12 is a multiple of 4 and 2, so residues are unchanged, and it
+	// would be negative as a 32-bit int
+	wide := genomes.Genotype{Width: genomes.Codon32}
+	for _, c := range narrow.Genes {
+		wide.Genes = append(wide.Genes, 1<<32-12+c)
+	}
+
+	if got, want := wide.MapToGrammar(gr, 100).String(), narrow.MapToGrammar(gr, 100).String(); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestWideCodonsRemoveModuloBias(t *testing.T) {
+	ints := make([]genomes.Production, 200)
+	for i := range ints {
+		ints[i] = genomes.Production{Elements: []string{fmt.Sprint(i)}}
+	}
+	gr := genomes.Grammar{Rules: []genomes.Rule{{Left: "<int>", Productions: ints}}}
+
+	if report := genomes.AnalyseGrammarWidth(gr, genomes.Codon8); len(report.Issues) != 1 {
+		t.Errorf("Expected a modulo bias warning at 8 bits, got %v", report.Issues)
+	}
+	if report := genomes.AnalyseGrammarWidth(gr, genomes.Codon16); len(report.Issues) != 0 {
+		t.Errorf("Expected no issues at 16 bits, got %v", report.Issues)
+	}
+}
+
+func TestGenotypeFromPhenotypeWide(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4))
+	phenotype := "a * b - 0.5 / a"
+
+	for _, mode := range []genomes.MappingMode{genomes.StandardMapping, genomes.ProbabilisticMapping, genomes.PositionIndependentMapping} {
+		gr := genomes.NewTestLectureExampleGrammar()
+		gr.Mapping = mode
+		gr.NormaliseProbabilities()
+
+		for _, width := range []genomes.CodonWidth{genomes.Codon16, genomes.Codon32} {
+			g, err := genomes.GenotypeFromPhenotype(gr, phenotype, 50, width, 20, r)
+			if err != nil {
+				t.Fatalf("mode %d, %d bits: %v", mode, width, err)
+			}
+			if g.Width != width {
+				t.Errorf("Expected width %d, got %d", width, g.Width)
+			}
+			if got := g.MapToGrammar(gr, 20).String(); got != phenotype {
+				t.Errorf("mode %d, %d bits: expected %q, got %q", mode, width, phenotype, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package genomes
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxConditionRetries bounds how many times a child is re-derived from fresh
+// codons to satisfy its production's conditions before the mapper tries its
+// productions one by one.
+const maxConditionRetries = 8
+
+type ConditionKind int
+
+const (
+	// Distinct requires the phenotypes of two elements to differ
+	Distinct ConditionKind = iota
+	// InRange requires an element's phenotype to be a number in [Min, Max]
+	InRange
+	// SameType requires two elements to derive through the same non-terminal
+	SameType
+)
+
+var conditionNames = map[ConditionKind]string{
+	Distinct: "distinct",
+	InRange:  "range",
+	SameType: "sametype",
+}
+
+// Condition is a semantic constraint on a production, checked by the
+// depth-first mappers once the elements it refers to have been derived.
+type Condition struct {
+	Kind ConditionKind
+	// Elements are 0-based positions in the production
+	Elements []int
+	Min, Max float64
+}
+
+// ParseCondition reads the body of a "!name(args)" annotation. Element
+// positions are 1-based in the source, as in !distinct(2,4).
+func ParseCondition(name string, args []string) (Condition, error) {
+	var c Condition
+	found := false
+	for kind, n := range conditionNames {
+		if n == name {
+			c.Kind, found = kind, true
+		}
+	}
+	if !found {
+		return c, fmt.Errorf("unknown condition %q", name)
+	}
+
+	positions := args
+	if c.Kind == InRange {
+		if len(args) != 3 {
+			return c, fmt.Errorf("range takes an element and two bounds, got %d argument(s)", len(args))
+		}
+		var err error
+		if c.Min, err = strconv.ParseFloat(args[1], 64); err != nil {
+			return c, fmt.Errorf("invalid range bound %q", args[1])
+		}
+		if c.Max, err = strconv.ParseFloat(args[2], 64); err != nil {
+			return c, fmt.Errorf("invalid range bound %q", args[2])
+		}
+		positions = args[:1]
+	} else if len(args) != 2 {
+		return c, fmt.Errorf("%s takes two elements, got %d argument(s)", name, len(args))
+	}
+
+	for _, a := range positions {
+		i, err := strconv.Atoi(a)
+		if err != nil || i < 1 {
+			return c, fmt.Errorf("invalid element position %q", a)
+		}
+		c.Elements = append(c.Elements, i-1)
+	}
+	return c, nil
+}
+
+func (c Condition) String() string {
+	args := make([]string, len(c.Elements))
+	for i, e := range c.Elements {
+		args[i] = strconv.Itoa(e + 1)
+	}
+	if c.Kind == InRange {
+		args = append(args, strconv.FormatFloat(c.Min, 'f', -1, 64), strconv.FormatFloat(c.Max, 'f', -1, 64))
+	}
+	return "!" + conditionNames[c.Kind] + "(" + strings.Join(args, ",") + ")"
+}
+
+// last is the position of the last element the condition depends on, so it
+// can be checked as soon as that element is derived.
+func (c Condition) last() int {
+	return slices.Max(c.Elements)
+}
+
+func (c Condition) holds(children []*GrammarNode) bool {
+	switch c.Kind {
+	case Distinct:
+		return children[c.Elements[0]].String() != children[c.Elements[1]].String()
+	case InRange:
+		v, err := strconv.ParseFloat(children[c.Elements[0]].String(), 64)
+		return err == nil && v >= c.Min && v <= c.Max
+	case SameType:
+		return derivedType(children[c.Elements[0]]) == derivedType(children[c.Elements[1]])
+	}
+	return true
+}
+
+// derivedType follows single non-terminal expansions down from n and returns
+// the last non-terminal, e.g. <expr> -> <val> -> <var> -> $PRICE is a <var>.
+// Terminals have no type.
+func derivedType(n *GrammarNode) string {
+	if n.IsTerminal() {
+		return ""
+	}
+	for len(n.children) == 1 && !n.children[0].IsTerminal() {
+		n = n.children[0]
+	}
+	return n.token
+}
+
+// satisfied checks the conditions that become decidable once children[i]
+// has been derived.
+func (p Production) satisfied(children []*GrammarNode, i int) bool {
+	for _, c := range p.Conditions {
+		if c.last() == i && !c.holds(children) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckMapping reports an error if gr's conditions cannot be enforced under
+// its mapping mode: πGE only checks them after the fact, so most trees from
+// a grammar with conditions would be invalid.
+func (gr Grammar) CheckMapping() error {
+	if gr.Mapping != PositionIndependentMapping {
+		return nil
+	}
+	for _, r := range gr.Rules {
+		for _, p := range r.Productions {
+			if len(p.Conditions) > 0 {
+				return fmt.Errorf("%s has conditions, which the pige mapping does not enforce", r.Left)
+			}
+		}
+	}
+	return nil
+}
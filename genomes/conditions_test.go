@@ -0,0 +1,173 @@
+package genomes_test
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+func comparisonGrammar(conditions ...genomes.Condition) genomes.Grammar {
+	return genomes.Grammar{
+		Rules: []genomes.Rule{
+			{Left: "<cmp>", Productions: []genomes.Production{
+				{Elements: []string{"<operand>", ">", "<operand>"}, Conditions: conditions},
+			}},
+			{Left: "<operand>", Productions: []genomes.Production{
+				{Elements: []string{"<var>"}},
+				{Elements: []string{"<num>"}},
+			}},
+			{Left: "<var>", Productions: []genomes.Production{
+				{Elements: []string{"$PRICE"}},
+				{Elements: []string{"$RSI"}},
+			}},
+			{Left: "<num>", Productions: []genomes.Production{
+				{Elements: []string{"1"}},
+				{Elements: []string{"5"}},
+				{Elements: []string{"50"}},
+			}},
+		},
+	}
+}
+
+func TestConditionsDuringMapping(t *testing.T) {
+	distinct, _ := genomes.ParseCondition("distinct", []string{"1", "3"})
+	sameType, _ := genomes.ParseCondition("sametype", []string{"1", "3"})
+	inRange, _ := genomes.ParseCondition("range", []string{"3", "0", "10"})
+
+	tests := []struct {
+		name      string
+		condition genomes.Condition
+		holds     func(left, right string) bool
+	}{
+		{"distinct", distinct, func(l, r string) bool { return l != r }},
+		{"sametype", sameType, func(l, r string) bool { return strings.HasPrefix(l, "$") == strings.HasPrefix(r, "$") }},
+		{"range", inRange, func(l, r string) bool {
+			v, err := strconv.ParseFloat(r, 64)
+			return err == nil && v <= 10
+		}},
+	}
+
+	rng := rand.New(rand.NewPCG(1, 1))
+	create := genomes.NewCreateGenotype(20, rng)
+	for _, tt := range tests {
+		gr := comparisonGrammar(tt.condition)
+		for range 200 {
+			g := create()
+			phenotype := g.MapToGrammar(gr, 50).String()
+			sides := strings.Split(phenotype, " > ")
+			if !tt.holds(sides[0], sides[1]) {
+				t.Errorf("%s: mapping produced %q", tt.name, phenotype)
+			}
+			if again := g.MapToGrammar(gr, 50).String(); again != phenotype {
+				t.Errorf("%s: mapping is not deterministic: %q then %q", tt.name, phenotype, again)
+			}
+		}
+	}
+}
+
+func TestConditionsWhenReproductionsRunOut(t *testing.T) {
+	distinct, _ := genomes.ParseCondition("distinct", []string{"1", "3"})
+	gr := comparisonGrammar(distinct)
+
+	// Two codons: <operand> -> <var> -> $PRICE, then everything is forced
+	// and the right-hand side falls back to its terminating productions.
+	got := genomes.Genotype{Genes: []uint32{0, 0, 0}}.MapToGrammar(gr, 2).String()
+	if got != "$PRICE > $RSI" && got != "$PRICE > 1" {
+		t.Errorf("Expected forced choices to satisfy the condition, got %q", got)
+	}
+}
+
+func TestDiscardedDerivationsNotCounted(t *testing.T) {
+	distinct, _ := genomes.ParseCondition("distinct", []string{"1", "3"})
+	gr := comparisonGrammar(distinct)
+
+	// Every tree has five non-terminals: <cmp>, two <operand>s and what
+	// each derives, however many right-hand sides were thrown away
+	create := genomes.NewCreateGenotype(20, rand.New(rand.NewPCG(2, 2)))
+	for range 200 {
+		g := create()
+		tree, counts := g.MapToGrammarCounts(gr, 50)
+		total := 0
+		for _, c := range counts {
+			for _, n := range c {
+				total += n
+			}
+		}
+		if _, trace := g.MapToGrammarTrace(gr, 50); total != 5 || len(trace) != 5 {
+			t.Fatalf("%q: counted %d productions and traced %d, want 5", tree.String(), total, len(trace))
+		}
+		if !tree.Valid() {
+			t.Fatalf("%q: distinct operands are always possible", tree.String())
+		}
+	}
+}
+
+func TestUnsatisfiableConditionIsInvalid(t *testing.T) {
+	// No operand is a number at most 0.5
+	inRange, _ := genomes.ParseCondition("range", []string{"3", "0", "0.5"})
+	gr := comparisonGrammar(inRange)
+
+	tree := genomes.Genotype{Genes: []uint32{0, 1, 2, 3}}.MapToGrammar(gr, 50)
+	if tree.Valid() {
+		t.Errorf("Expected %q to be invalid", tree.String())
+	}
+}
+
+func TestConditionEndingAtTerminal(t *testing.T) {
+	distinct, _ := genomes.ParseCondition("distinct", []string{"1", "2"})
+	gr := genomes.Grammar{Rules: []genomes.Rule{
+		{Left: "<s>", Productions: []genomes.Production{{Elements: []string{"<v>", "x"}, Conditions: []genomes.Condition{distinct}}}},
+		{Left: "<v>", Productions: []genomes.Production{{Elements: []string{"x"}}, {Elements: []string{"y"}}}},
+	}}
+
+	for genes, valid := range map[uint32]bool{0: false, 1: true} {
+		tree := genomes.Genotype{Genes: []uint32{0, genes}}.MapToGrammar(gr, 50)
+		if tree.Valid() != valid {
+			t.Errorf("%q: got Valid() %v, want %v", tree.String(), tree.Valid(), valid)
+		}
+	}
+}
+
+func TestPositionIndependentConditions(t *testing.T) {
+	distinct, _ := genomes.ParseCondition("distinct", []string{"1", "3"})
+	gr := comparisonGrammar(distinct)
+	gr.Mapping = genomes.PositionIndependentMapping
+	if err := gr.CheckMapping(); err == nil {
+		t.Error("Expected pige to be rejected for a grammar with conditions")
+	}
+
+	// Trees that break the condition are reported, if not redrawn
+	r := rand.New(rand.NewPCG(3, 4))
+	for range 200 {
+		g := genomes.NewCreateGenotype(20, r)()
+		tree := g.MapToGrammar(gr, 50)
+		operands := strings.Split(tree.String(), " > ")
+		if broken := operands[0] == operands[1]; tree.Valid() == broken {
+			t.Fatalf("%q: got Valid() %v", tree.String(), tree.Valid())
+		}
+	}
+
+	gr.Mapping = genomes.StandardMapping
+	if err := gr.CheckMapping(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseCondition(t *testing.T) {
+	c, err := genomes.ParseCondition("range", []string{"2", "0", "1.5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.String() != "!range(2,0,1.5)" {
+		t.Errorf("Unexpected round trip %s", c)
+	}
+
+	for _, args := range [][]string{{"unknown", "1", "2"}, {"distinct", "1"}, {"distinct", "0", "2"}, {"range", "1", "a", "2"}} {
+		if _, err := genomes.ParseCondition(args[0], args[1:]); err == nil {
+			t.Errorf("Expected an error for %v", args)
+		}
+	}
+}
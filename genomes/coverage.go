@@ -0,0 +1,42 @@
+package genomes
+
+import "strings"
+
+// ProductionLabel names a production for coverage reports, e.g.
+// "<var> ::= $RSI".
+func (rule Rule) ProductionLabel(i int) string {
+	return rule.Left + " ::= " + strings.Join(rule.Productions[i].Elements, " ")
+}
+
+// NewProductionFeatures returns the labels of the productions a genotype's
+// derivation uses, for measuring grammar coverage.
+func NewProductionFeatures(gr Grammar, maxReproductions int) func(g Genotype) []string {
+	rules := make(map[string]*Rule, len(gr.Rules))
+	for i := range gr.Rules {
+		rules[gr.Rules[i].Left] = &gr.Rules[i]
+	}
+
+	return func(g Genotype) []string {
+		_, counts := g.MapToGrammarCounts(gr, maxReproductions)
+
+		var features []string
+		for left, c := range counts {
+			for i, n := range c {
+				if n > 0 {
+					features = append(features, rules[left].ProductionLabel(i))
+				}
+			}
+		}
+		return features
+	}
+}
+
+// ProductionCount is the number of productions in the grammar, the most a
+// coverage report can list.
+func (gr Grammar) ProductionCount() int {
+	n := 0
+	for _, r := range gr.Rules {
+		n += len(r.Productions)
+	}
+	return n
+}
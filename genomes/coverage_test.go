@@ -0,0 +1,41 @@
+package genomes_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+func TestProductionFeatures(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	// <expr> -> <expr> <op> <expr>, a, +, 0.2
+	g := genomes.Genotype{Genes: []uint32{0, 1, 1, 0, 0, 1, 0, 2}}
+
+	tree, counts := g.MapToGrammarCounts(gr, 20)
+	if tree.String() != "a + 0.2" {
+		t.Fatalf("unexpected phenotype %q", tree.String())
+	}
+	if counts["<expr>"][0] != 1 || counts["<expr>"][1] != 2 {
+		t.Errorf("Expected <expr> productions used 1 and 2 times, got %v", counts["<expr>"])
+	}
+
+	features := genomes.NewProductionFeatures(gr, 20)(g)
+	slices.Sort(features)
+	want := []string{
+		"<expr> ::= <expr> <op> <expr>",
+		"<expr> ::= <var>",
+		"<input> ::= a",
+		"<op> ::= +",
+		"<prc> ::= 0.2",
+		"<var> ::= <input>",
+		"<var> ::= <prc>",
+	}
+	if !slices.Equal(features, want) {
+		t.Errorf("Expected features %q, got %q", want, features)
+	}
+
+	if n := gr.ProductionCount(); n != 16 {
+		t.Errorf("Expected 16 productions, got %d", n)
+	}
+}
@@ -0,0 +1,173 @@
+package genomes
+
+// batchSize is how many samples EvalBatch pushes through each instruction
+// at a time, small enough for the stack to stay in cache.
+const batchSize = 256
+
+type opcode uint8
+
+const (
+	opConst opcode = iota
+	opVar
+	opAdd
+	opSubtract
+	opMultiply
+	opDivide
+	opFunc
+)
+
+var operatorCodes = map[Operator]opcode{
+	Add: opAdd, Subtract: opSubtract, Multiply: opMultiply, Divide: opDivide,
+}
+
+type instruction struct {
+	op    opcode
+	value float64
+	index int
+	fn    Func
+}
+
+// Program is an Expression compiled to postfix for a stack machine. It
+// evaluates the same as the tree it was compiled from.
+type Program struct {
+	code     []instruction
+	maxStack int
+}
+
+func Compile(e Expression) Program {
+	var p Program
+	p.compile(e, 0)
+	return p
+}
+
+// compile appends e's code given height values already on the stack.
+func (p *Program) compile(e Expression, height int) {
+	switch node := e.(type) {
+	case Primitive:
+		p.code = append(p.code, instruction{op: opConst, value: node.Value})
+	case Variable:
+		p.code = append(p.code, instruction{op: opVar, index: node.Index})
+	case NonTerminal:
+		p.compile(node.Left, height)
+		p.compile(node.Right, height+1)
+		p.code = append(p.code, instruction{op: operatorCodes[node.Operator]})
+	case Function:
+		for i, a := range node.Args {
+			p.compile(a, height+i)
+		}
+		p.code = append(p.code, instruction{op: opFunc, fn: node.Func})
+	default:
+		panic("unknown node")
+	}
+	p.maxStack = max(p.maxStack, height+1)
+}
+
+func (p Program) Len() int {
+	return len(p.code)
+}
+
+func (p Program) Eval(vars []float64) float64 {
+	stack := make([]float64, 0, p.maxStack)
+	var args []float64
+	for _, in := range p.code {
+		switch in.op {
+		case opConst:
+			stack = append(stack, in.value)
+		case opVar:
+			stack = append(stack, vars[in.index])
+		case opFunc:
+			n := len(stack) - in.fn.Arity
+			args = append(args[:0], stack[n:]...)
+			stack = append(stack[:n], in.fn.Apply(args))
+		default:
+			n := len(stack) - 1
+			stack[n-1] = applyOp(in.op, stack[n-1], stack[n])
+			stack = stack[:n]
+		}
+	}
+	return stack[0]
+}
+
+func applyOp(op opcode, l, r float64) float64 {
+	switch op {
+	case opAdd:
+		return l + r
+	case opSubtract:
+		return l - r
+	case opMultiply:
+		return l * r
+	default:
+		if r == 0 {
+			return 1
+		}
+		return l / r
+	}
+}
+
+// EvalBatch evaluates the program on every sample, where columns[i] holds
+// variable i across the samples, writing results to out. Each instruction
+// runs over a batch of samples before the next, so the interpreter's
+// overhead is paid per batch rather than per sample.
+func (p Program) EvalBatch(columns [][]float64, out []float64) {
+	buf := make([]float64, p.maxStack*batchSize)
+	stack := make([][]float64, p.maxStack)
+	var args []float64
+
+	for start := 0; start < len(out); start += batchSize {
+		end := min(start+batchSize, len(out))
+		n := end - start
+		for i := range stack {
+			stack[i] = buf[i*batchSize : i*batchSize+n]
+		}
+
+		top := 0
+		for _, in := range p.code {
+			switch in.op {
+			case opConst:
+				for j := range stack[top] {
+					stack[top][j] = in.value
+				}
+				top++
+			case opVar:
+				copy(stack[top], columns[in.index][start:end])
+				top++
+			case opFunc:
+				base := top - in.fn.Arity
+				args = append(args[:0], make([]float64, in.fn.Arity)...)
+				for j := range n {
+					for a := range args {
+						args[a] = stack[base+a][j]
+					}
+					stack[base][j] = in.fn.Apply(args)
+				}
+				top = base + 1
+			default:
+				l, r := stack[top-2], stack[top-1]
+				switch in.op {
+				case opAdd:
+					for j := range l {
+						l[j] += r[j]
+					}
+				case opSubtract:
+					for j := range l {
+						l[j] -= r[j]
+					}
+				case opMultiply:
+					for j := range l {
+						l[j] *= r[j]
+					}
+				case opDivide:
+					for j := range l {
+						if r[j] == 0 {
+							l[j] = 1
+						} else {
+							l[j] /= r[j]
+						}
+					}
+				}
+				top--
+			}
+		}
+		copy(out[start:end], stack[0])
+	}
+}
@@ -0,0 +1,50 @@
+package genomes_test
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+func TestCompiledMatchesTree(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4))
+	set, err := genomes.ParsePrimitiveSet([]string{"+", "-", "*", "/", "sin", "log", "sqrt", "if"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	constants := []float64{0, 0.5, 1, 2}
+
+	// More samples than one batch, with a partial last batch
+	samples := make([][]float64, 600)
+	columns := [][]float64{make([]float64, len(samples)), make([]float64, len(samples))}
+	for i := range samples {
+		samples[i] = []float64{r.Float64()*4 - 2, float64(i % 3)}
+		columns[0][i], columns[1][i] = samples[i][0], samples[i][1]
+	}
+
+	for range 50 {
+		e := genomes.RandomFormulaFrom(set, 7, &constants, 2, r)
+		p := genomes.Compile(e)
+		if p.Len() != genomes.ExpressionSize(e) {
+			t.Errorf("%s: %d instructions for %d nodes", e, p.Len(), genomes.ExpressionSize(e))
+		}
+
+		out := make([]float64, len(samples))
+		p.EvalBatch(columns, out)
+		for i, vars := range samples {
+			want := e.Eval(vars)
+			if got := p.Eval(vars); !same(got, want) {
+				t.Fatalf("%s at %v: Eval %f, tree %f", e, vars, got, want)
+			}
+			if !same(out[i], want) {
+				t.Fatalf("%s at %v: EvalBatch %f, tree %f", e, vars, out[i], want)
+			}
+		}
+	}
+}
+
+func same(a, b float64) bool {
+	return a == b || math.IsNaN(a) && math.IsNaN(b)
+}
@@ -0,0 +1,53 @@
+package genomes
+
+import "math/rand/v2"
+
+// ERC is a range for ephemeral random constants: when a PrimitiveSet has
+// one, each new constant terminal gets a fresh uniform value in [Min, Max)
+// instead of one from the constants list.
+type ERC struct {
+	Min, Max float64
+}
+
+func (erc ERC) random(r *rand.Rand) float64 {
+	return erc.Min + r.Float64()*(erc.Max-erc.Min)
+}
+
+// Constants lists the values of e's Primitive nodes in pre-order.
+func Constants(e Expression) []float64 {
+	var values []float64
+	var walk func(Expression)
+	walk = func(e Expression) {
+		if p, ok := e.(Primitive); ok {
+			values = append(values, p.Value)
+		}
+		for _, c := range children(e) {
+			walk(c)
+		}
+	}
+	walk(e)
+	return values
+}
+
+// WithConstants returns a copy of e whose Primitive nodes take values in
+// pre-order, the inverse of Constants.
+func WithConstants(e Expression, values []float64) Expression {
+	next := 0
+	var rebuild func(Expression) Expression
+	rebuild = func(e Expression) Expression {
+		if _, ok := e.(Primitive); ok {
+			next++
+			return Primitive{Value: values[next-1]}
+		}
+		c := children(e)
+		if len(c) == 0 {
+			return e
+		}
+		replaced := make([]Expression, len(c))
+		for i := range c {
+			replaced[i] = rebuild(c[i])
+		}
+		return withChildren(e, replaced)
+	}
+	return rebuild(e)
+}
@@ -0,0 +1,335 @@
+package genomes
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Operator precedence when rendering, highest binding tightest
+const (
+	precSum = iota + 1
+	precProduct
+	precAtom
+)
+
+// How a dialect writes an operator
+const (
+	// infix operands are parenthesised by precedence
+	infix = iota
+	// bracketed is infix inside a construct of its own, like a ternary, so
+	// the result needs no parentheses
+	bracketed
+	// called operands are arguments of a call, like \frac{a}{b} or pdiv(a, b)
+	called
+)
+
+// dialect renders expression nodes in one target language.
+type dialect struct {
+	variable func(i int) string
+	constant func(v float64) string
+	form     func(op Operator) int
+	operator func(op Operator, l, r string) string
+	function func(f Func, args []string) string
+	paren    func(s string) string
+}
+
+func (d dialect) render(e Expression) (string, int) {
+	switch n := e.(type) {
+	case Primitive:
+		if n.Value < 0 {
+			return d.paren(d.constant(n.Value)), precAtom
+		}
+		return d.constant(n.Value), precAtom
+	case Variable:
+		return d.variable(n.Index), precAtom
+	case NonTerminal:
+		prec := precSum
+		if n.Operator == Multiply || n.Operator == Divide {
+			prec = precProduct
+		}
+		l, lp := d.render(n.Left)
+		r, rp := d.render(n.Right)
+		form := d.form(n.Operator)
+		if form == called {
+			return d.operator(n.Operator, l, r), precAtom
+		}
+
+		if lp < prec {
+			l = d.paren(l)
+		}
+		// Subtraction and division do not associate to the right
+		if rp < prec || rp == prec && (n.Operator == Subtract || n.Operator == Divide) {
+			r = d.paren(r)
+		}
+		if form == bracketed {
+			return d.operator(n.Operator, l, r), precAtom
+		}
+		return d.operator(n.Operator, l, r), prec
+	case Function:
+		args := make([]string, len(n.Args))
+		for i, a := range n.Args {
+			var prec int
+			args[i], prec = d.render(a)
+			// Negation is the one function written as an operator
+			if n.Func.Name == Neg.Name && prec < precAtom {
+				args[i] = d.paren(args[i])
+			}
+		}
+		return d.function(n.Func, args), precAtom
+	default:
+		panic("unknown node")
+	}
+}
+
+func (d dialect) String(e Expression) string {
+	s, _ := d.render(e)
+	return s
+}
+
+func parens(s string) string {
+	return "(" + s + ")"
+}
+
+// floatLiteral formats v so it reads back as a float, not an integer.
+func floatLiteral(v float64) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+func symbol(op Operator) string {
+	return map[Operator]string{Add: "+", Subtract: "-", Multiply: "*", Divide: "/"}[op]
+}
+
+// divideForm writes division in the given form and the rest infix, as
+// every dialect protects or typesets division specially.
+func divideForm(form int) func(op Operator) int {
+	return func(op Operator) int {
+		if op == Divide {
+			return form
+		}
+		return infix
+	}
+}
+
+func call(name string, args []string) string {
+	return name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// variableNames names variable i by names[i], or xi past the end of names.
+func variableNames(names []string) func(i int) string {
+	return func(i int) string {
+		if i < len(names) {
+			return names[i]
+		}
+		return fmt.Sprintf("x%d", i)
+	}
+}
+
+// ExpressionLaTeX typesets e as a LaTeX formula. Variables are x_{i}
+// unless names are given.
+func ExpressionLaTeX(e Expression, names ...string) string {
+	d := dialect{
+		variable: func(i int) string {
+			if i < len(names) {
+				return names[i]
+			}
+			return fmt.Sprintf("x_{%d}", i)
+		},
+		constant: func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) },
+		form:     divideForm(called),
+		operator: func(op Operator, l, r string) string {
+			switch op {
+			case Multiply:
+				return l + ` \cdot ` + r
+			case Divide:
+				return `\frac{` + l + `}{` + r + `}`
+			}
+			return l + " " + symbol(op) + " " + r
+		},
+		function: func(f Func, args []string) string {
+			switch f.Name {
+			case Sin.Name, Cos.Name:
+				return `\` + f.Name + `\left(` + args[0] + `\right)`
+			case Exp.Name:
+				return `e^{` + args[0] + `}`
+			case Log.Name:
+				return `\log\left|` + args[0] + `\right|`
+			case Sqrt.Name:
+				return `\sqrt{\left|` + args[0] + `\right|}`
+			case Abs.Name:
+				return `\left|` + args[0] + `\right|`
+			case Neg.Name:
+				return `\left(-` + args[0] + `\right)`
+			case IfThenElse.Name:
+				return `\begin{cases} ` + args[1] + ` & \text{if } ` + args[0] + ` > 0 \\ ` +
+					args[2] + ` & \text{otherwise} \end{cases}`
+			}
+			return `\operatorname{` + f.Name + `}\left(` + strings.Join(args, ", ") + `\right)`
+		},
+		paren: func(s string) string { return `\left(` + s + `\right)` },
+	}
+	return d.String(e)
+}
+
+// ExpressionExpr writes e in expr-lang syntax for the grammar pipeline,
+// whose environment provides sin, cos, exp and the protected log and sqrt.
+// Variables are x0, x1, ... unless names are given.
+func ExpressionExpr(e Expression, names ...string) string {
+	d := dialect{
+		variable: variableNames(names),
+		constant: floatLiteral,
+		form:     divideForm(bracketed),
+		operator: func(op Operator, l, r string) string {
+			if op == Divide {
+				return "(" + r + " == 0 ? 1.0 : " + l + " / " + r + ")"
+			}
+			return l + " " + symbol(op) + " " + r
+		},
+		function: func(f Func, args []string) string {
+			switch f.Name {
+			case Neg.Name:
+				return "(-" + args[0] + ")"
+			case IfThenElse.Name:
+				return "(" + args[0] + " > 0 ? " + args[1] + " : " + args[2] + ")"
+			}
+			return call(f.Name, args)
+		},
+		paren: parens,
+	}
+	return d.String(e)
+}
+
+// goHelpers and pythonHelpers define the protected primitives for models
+// that use them.
+var goHelpers = map[string]string{
+	"pdiv": `func pdiv(a, b float64) float64 {
+	if b == 0 {
+		return 1
+	}
+	return a / b
+}`,
+	"plog": `func plog(a float64) float64 {
+	if a == 0 {
+		return 0
+	}
+	return math.Log(math.Abs(a))
+}`,
+	"ifpos": `func ifpos(a, b, c float64) float64 {
+	if a > 0 {
+		return b
+	}
+	return c
+}`,
+}
+
+var pythonHelpers = map[string]string{
+	"_pdiv": `def _pdiv(a, b):
+    b = np.asarray(b, dtype=float)
+    safe = np.where(b == 0, 1.0, b)
+    return np.where(b == 0, 1.0, a / safe)`,
+	"_plog": `def _plog(a):
+    a = np.abs(np.asarray(a, dtype=float))
+    safe = np.where(a == 0, 1.0, a)
+    return np.where(a == 0, 0.0, np.log(safe))`,
+}
+
+// helperList returns the used helpers' definitions in name order.
+func helperList(used map[string]bool, helpers map[string]string) []string {
+	var names []string
+	for name := range used {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	defs := make([]string, len(names))
+	for i, name := range names {
+		defs[i] = helpers[name]
+	}
+	return defs
+}
+
+// ExpressionGo writes e as a Go function `func name(x []float64) float64`,
+// followed by any helpers for the protected primitives it uses.
+func ExpressionGo(e Expression, name string) string {
+	used := map[string]bool{}
+	d := dialect{
+		variable: func(i int) string { return fmt.Sprintf("x[%d]", i) },
+		constant: floatLiteral,
+		form:     divideForm(called),
+		operator: func(op Operator, l, r string) string {
+			if op == Divide {
+				used["pdiv"] = true
+				return call("pdiv", []string{l, r})
+			}
+			return l + " " + symbol(op) + " " + r
+		},
+		function: func(f Func, args []string) string {
+			switch f.Name {
+			case Sin.Name, Cos.Name, Exp.Name, Abs.Name:
+				return call("math."+strings.ToUpper(f.Name[:1])+f.Name[1:], args)
+			case Log.Name:
+				used["plog"] = true
+				return call("plog", args)
+			case Sqrt.Name:
+				return "math.Sqrt(math.Abs(" + args[0] + "))"
+			case Neg.Name:
+				return "(-" + args[0] + ")"
+			case IfThenElse.Name:
+				used["ifpos"] = true
+				return call("ifpos", args)
+			}
+			return call(f.Name, args)
+		},
+		paren: parens,
+	}
+
+	body := d.String(e)
+	parts := append([]string{fmt.Sprintf("func %s(x []float64) float64 {\n\treturn %s\n}", name, body)},
+		helperList(used, goHelpers)...)
+	return strings.Join(parts, "\n\n") + "\n"
+}
+
+// ExpressionPython writes e as a NumPy function `def name(x)` where x[i]
+// may be a scalar or an array of samples, preceded by the numpy import and
+// any helpers for the protected primitives it uses.
+func ExpressionPython(e Expression, name string) string {
+	used := map[string]bool{}
+	d := dialect{
+		variable: func(i int) string { return fmt.Sprintf("x[%d]", i) },
+		constant: floatLiteral,
+		form:     divideForm(called),
+		operator: func(op Operator, l, r string) string {
+			if op == Divide {
+				used["_pdiv"] = true
+				return call("_pdiv", []string{l, r})
+			}
+			return l + " " + symbol(op) + " " + r
+		},
+		function: func(f Func, args []string) string {
+			switch f.Name {
+			case Sin.Name, Cos.Name, Exp.Name, Abs.Name:
+				return call("np."+f.Name, args)
+			case Log.Name:
+				used["_plog"] = true
+				return call("_plog", args)
+			case Sqrt.Name:
+				return "np.sqrt(np.abs(" + args[0] + "))"
+			case Neg.Name:
+				return "(-" + args[0] + ")"
+			case IfThenElse.Name:
+				return "np.where(" + args[0] + " > 0, " + args[1] + ", " + args[2] + ")"
+			}
+			return call(f.Name, args)
+		},
+		paren: parens,
+	}
+
+	body := d.String(e)
+	parts := append([]string{"import numpy as np"}, helperList(used, pythonHelpers)...)
+	parts = append(parts, fmt.Sprintf("def %s(x):\n    return %s", name, body))
+	return strings.Join(parts, "\n\n\n") + "\n"
+}
@@ -0,0 +1,122 @@
+package genomes_test
+
+import (
+	"math"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+	"github.com/expr-lang/expr"
+)
+
+func TestExpressionLaTeX(t *testing.T) {
+	tests := []struct {
+		in   genomes.Expression
+		want string
+	}{
+		{op(genomes.Divide, op(genomes.Add, x0, c(1)), x1), `\frac{x_{0} + 1}{x_{1}}`},
+		{op(genomes.Multiply, op(genomes.Subtract, x0, x1), c(-2)), `\left(x_{0} - x_{1}\right) \cdot \left(-2\right)`},
+		{fn(genomes.Neg, op(genomes.Add, x0, x1)), `\left(-\left(x_{0} + x_{1}\right)\right)`},
+		{fn(genomes.IfThenElse, x0, c(1), c(0)), `\begin{cases} 1 & \text{if } x_{0} > 0 \\ 0 & \text{otherwise} \end{cases}`},
+	}
+	for _, test := range tests {
+		if got := genomes.ExpressionLaTeX(test.in); got != test.want {
+			t.Errorf("ExpressionLaTeX(%s) = %s, want %s", test.in, got, test.want)
+		}
+	}
+
+	if got := genomes.ExpressionLaTeX(op(genomes.Add, x0, x1), "a", "b"); got != "a + b" {
+		t.Errorf("named variables: got %s", got)
+	}
+}
+
+func TestExpressionExprParentheses(t *testing.T) {
+	tests := []struct {
+		in   genomes.Expression
+		want string
+	}{
+		{op(genomes.Subtract, x0, op(genomes.Add, x1, c(1))), "x0 - (x1 + 1.0)"},
+		{op(genomes.Add, op(genomes.Add, x0, x1), c(1)), "x0 + x1 + 1.0"},
+		{op(genomes.Multiply, op(genomes.Add, x0, x1), x0), "(x0 + x1) * x0"},
+		{op(genomes.Divide, x0, x1), "(x1 == 0 ? 1.0 : x0 / x1)"},
+	}
+	for _, test := range tests {
+		if got := genomes.ExpressionExpr(test.in); got != test.want {
+			t.Errorf("ExpressionExpr(%s) = %s, want %s", test.in, got, test.want)
+		}
+	}
+}
+
+// exprEnv mirrors the grammar pipeline's math functions.
+func exprEnv(vars []float64) map[string]any {
+	env := map[string]any{
+		"sin": math.Sin,
+		"cos": math.Cos,
+		"exp": math.Exp,
+		"log": func(x float64) float64 {
+			if x == 0 {
+				return 0
+			}
+			return math.Log(math.Abs(x))
+		},
+		"sqrt": func(x float64) float64 { return math.Sqrt(math.Abs(x)) },
+		"abs":  math.Abs,
+	}
+	env["x0"], env["x1"] = vars[0], vars[1]
+	return env
+}
+
+func TestExpressionExprEvaluates(t *testing.T) {
+	r := rand.New(rand.NewPCG(5, 6))
+	set := genomes.DefaultPrimitiveSet()
+	constants := []float64{-1, 0.5, 2}
+	for range 200 {
+		e := genomes.RandomFormulaFrom(set, 5, &constants, 2, r)
+		code := genomes.ExpressionExpr(e)
+		for _, vars := range [][]float64{{0.3, -1.7}, {2, 0}, {-0.5, 1.25}} {
+			out, err := expr.Eval(code, exprEnv(vars))
+			if err != nil {
+				t.Fatalf("%s: %v", code, err)
+			}
+			got, ok := out.(float64)
+			if !ok {
+				t.Fatalf("%s evaluated to %T", code, out)
+			}
+			want := e.Eval(vars)
+			if got != want && !(math.IsNaN(got) && math.IsNaN(want)) && math.Abs(got-want) > 1e-9*math.Max(1, math.Abs(want)) {
+				t.Fatalf("%s at %v = %v, tree gives %v", code, vars, got, want)
+			}
+		}
+	}
+}
+
+func TestExpressionGo(t *testing.T) {
+	e := op(genomes.Divide, fn(genomes.Log, x0), op(genomes.Add, x1, c(1)))
+	got := genomes.ExpressionGo(e, "Model")
+	if !strings.HasPrefix(got, "func Model(x []float64) float64 {\n\treturn pdiv(plog(x[0]), x[1] + 1.0)\n}") {
+		t.Errorf("unexpected model:\n%s", got)
+	}
+	for _, helper := range []string{"func pdiv(", "func plog("} {
+		if !strings.Contains(got, helper) {
+			t.Errorf("missing %s helper:\n%s", helper, got)
+		}
+	}
+	if strings.Contains(got, "func ifpos(") {
+		t.Errorf("unused helper included:\n%s", got)
+	}
+}
+
+func TestExpressionPython(t *testing.T) {
+	e := op(genomes.Divide, fn(genomes.Sin, x0), fn(genomes.IfThenElse, x1, x0, c(2)))
+	got := genomes.ExpressionPython(e, "model")
+	if !strings.HasPrefix(got, "import numpy as np\n") {
+		t.Errorf("missing numpy import:\n%s", got)
+	}
+	if !strings.Contains(got, "def model(x):\n    return _pdiv(np.sin(x[0]), np.where(x[1] > 0, x[0], 2.0))") {
+		t.Errorf("unexpected model:\n%s", got)
+	}
+	if !strings.Contains(got, "def _pdiv(") || strings.Contains(got, "def _plog(") {
+		t.Errorf("wrong helpers:\n%s", got)
+	}
+}
@@ -0,0 +1,124 @@
+package genomes
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Func is a primitive function of fixed arity for Function nodes.
+type Func struct {
+	Name  string
+	Arity int
+	Apply func(args []float64) float64
+}
+
+var (
+	Sin = Func{Name: "sin", Arity: 1, Apply: func(a []float64) float64 { return math.Sin(a[0]) }}
+	Cos = Func{Name: "cos", Arity: 1, Apply: func(a []float64) float64 { return math.Cos(a[0]) }}
+	Exp = Func{Name: "exp", Arity: 1, Apply: func(a []float64) float64 { return math.Exp(a[0]) }}
+	// Log is protected: log|x|, and 0 at x = 0
+	Log = Func{Name: "log", Arity: 1, Apply: func(a []float64) float64 {
+		if a[0] == 0 {
+			return 0
+		}
+		return math.Log(math.Abs(a[0]))
+	}}
+	// Sqrt is protected: sqrt|x|
+	Sqrt = Func{Name: "sqrt", Arity: 1, Apply: func(a []float64) float64 { return math.Sqrt(math.Abs(a[0])) }}
+	Abs  = Func{Name: "abs", Arity: 1, Apply: func(a []float64) float64 { return math.Abs(a[0]) }}
+	Neg  = Func{Name: "neg", Arity: 1, Apply: func(a []float64) float64 { return -a[0] }}
+	// IfThenElse is the second argument when the first is positive, the
+	// third otherwise
+	IfThenElse = Func{Name: "if", Arity: 3, Apply: func(a []float64) float64 {
+		if a[0] > 0 {
+			return a[1]
+		}
+		return a[2]
+	}}
+)
+
+// Function applies a Func to its arguments.
+type Function struct {
+	Func Func
+	Args []Expression
+}
+
+func (f Function) Eval(vars []float64) float64 {
+	args := make([]float64, len(f.Args))
+	for i, a := range f.Args {
+		args[i] = a.Eval(vars)
+	}
+	return f.Func.Apply(args)
+}
+
+func (f Function) String() string {
+	args := make([]string, len(f.Args))
+	for i, a := range f.Args {
+		args[i] = a.String()
+	}
+	return fmt.Sprintf("%s(%s)", f.Func.Name, strings.Join(args, ", "))
+}
+
+func (f Function) Compare(other Expression) bool {
+	f2, ok := other.(Function)
+	if !ok || f.Func.Name != f2.Func.Name || len(f.Args) != len(f2.Args) {
+		return false
+	}
+	for i := range f.Args {
+		if !f.Args[i].Compare(f2.Args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// PrimitiveSet is what random generation and mutation build trees from:
+// binary Operators as NonTerminal nodes and Functions of any arity, with
+// constants drawn from ERC if it is set.
+type PrimitiveSet struct {
+	Operators []Operator
+	Functions []Func
+	ERC       *ERC
+}
+
+// DefaultPrimitiveSet is the four arithmetic operators.
+func DefaultPrimitiveSet() PrimitiveSet {
+	return PrimitiveSet{Operators: []Operator{Add, Subtract, Multiply, Divide}}
+}
+
+var primitiveNames = map[string]any{
+	"+": Add, "-": Subtract, "*": Multiply, "/": Divide,
+	"sin": Sin, "cos": Cos, "exp": Exp, "log": Log, "sqrt": Sqrt, "abs": Abs, "neg": Neg, "if": IfThenElse,
+}
+
+// ParsePrimitiveSet builds a set from operator and function names, e.g.
+// []string{"+", "*", "sin", "if"}.
+func ParsePrimitiveSet(names []string) (PrimitiveSet, error) {
+	var set PrimitiveSet
+	for _, name := range names {
+		switch p := primitiveNames[name].(type) {
+		case Operator:
+			set.Operators = append(set.Operators, p)
+		case Func:
+			set.Functions = append(set.Functions, p)
+		default:
+			return set, fmt.Errorf("unknown primitive %q", name)
+		}
+	}
+	if len(set.Operators)+len(set.Functions) == 0 {
+		return set, fmt.Errorf("primitive set is empty")
+	}
+	return set, nil
+}
+
+// withArity lists the set's functions of the given arity.
+func (set PrimitiveSet) withArity(arity int) []Func {
+	var funcs []Func
+	for _, f := range set.Functions {
+		if f.Arity == arity {
+			funcs = append(funcs, f)
+		}
+	}
+	return funcs
+}
@@ -0,0 +1,158 @@
+package genomes_test
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+func TestFunctionNodes(t *testing.T) {
+	x := genomes.Variable{0}
+
+	// if(x, sqrt(x), log(x) + neg(x))
+	expr := genomes.Function{genomes.IfThenElse, []genomes.Expression{
+		x,
+		genomes.Function{genomes.Sqrt, []genomes.Expression{x}},
+		genomes.NonTerminal{
+			genomes.Add,
+			genomes.Function{genomes.Log, []genomes.Expression{x}},
+			genomes.Function{genomes.Neg, []genomes.Expression{x}},
+		},
+	}}
+
+	if got, want := expr.Eval([]float64{-4}), math.Log(4)+4; got != want {
+		t.Errorf("expected %f, got %f", want, got)
+	}
+	if got := expr.Eval([]float64{9}); got != 3 {
+		t.Errorf("expected 3, got %f", got)
+	}
+
+	if want := "if(x0, sqrt(x0), (log(x0) + neg(x0)))"; expr.String() != want {
+		t.Errorf("expected %s, got %s", want, expr.String())
+	}
+	if genomes.ExpressionSize(expr) != 9 || genomes.ExpressionDepth(expr) != 4 {
+		t.Errorf("expected size 9 and depth 4, got %d and %d", genomes.ExpressionSize(expr), genomes.ExpressionDepth(expr))
+	}
+}
+
+func TestProtectedFunctions(t *testing.T) {
+	if v := genomes.Log.Apply([]float64{0}); v != 0 {
+		t.Errorf("log(0) should be 0, got %f", v)
+	}
+	if v := genomes.Sqrt.Apply([]float64{-9}); v != 3 {
+		t.Errorf("sqrt(-9) should be 3, got %f", v)
+	}
+}
+
+func TestFunctionCompare(t *testing.T) {
+	a := genomes.Function{genomes.Sin, []genomes.Expression{genomes.Primitive{1}}}
+	if !a.Compare(genomes.Function{genomes.Sin, []genomes.Expression{genomes.Primitive{1}}}) {
+		t.Error("identical functions should compare equal")
+	}
+	if a.Compare(genomes.Function{genomes.Cos, []genomes.Expression{genomes.Primitive{1}}}) {
+		t.Error("different functions should not compare equal")
+	}
+	if a.Compare(genomes.Function{genomes.Sin, []genomes.Expression{genomes.Primitive{2}}}) {
+		t.Error("different arguments should not compare equal")
+	}
+}
+
+func TestParsePrimitiveSet(t *testing.T) {
+	set, err := genomes.ParsePrimitiveSet([]string{"+", "*", "sin", "if"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Operators) != 2 || len(set.Functions) != 2 {
+		t.Errorf("expected 2 operators and 2 functions, got %v", set)
+	}
+
+	if _, err := genomes.ParsePrimitiveSet([]string{"tan"}); err == nil {
+		t.Error("expected error for unknown primitive")
+	}
+	if _, err := genomes.ParsePrimitiveSet(nil); err == nil {
+		t.Error("expected error for empty set")
+	}
+}
+
+func TestRandomFormulaFromFunctions(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	set := genomes.PrimitiveSet{Functions: []genomes.Func{genomes.Sin, genomes.IfThenElse}}
+	variables := []float64{0.5, 2}
+	constants := []float64{1, 2, 3}
+	mutate := genomes.NewMutateExpressionSet(set, constants, 2, r)
+
+	for range 100 {
+		e := genomes.RandomFormulaFrom(set, 4, &constants, 2, r)
+		if d := genomes.ExpressionDepth(e); d > 5 {
+			t.Fatalf("depth %d exceeds limit: %s", d, e)
+		}
+		if _, ok := e.(genomes.NonTerminal); ok {
+			t.Fatalf("no operators in set, got %s", e)
+		}
+		if math.IsNaN(e.Eval(variables)) {
+			t.Fatalf("NaN from %s", e)
+		}
+
+		m := mutate(e)
+		if _, ok := m.(genomes.NonTerminal); ok {
+			t.Fatalf("mutation introduced an operator: %s", m)
+		}
+
+		o := genomes.RandomFormulaFrom(set, 4, &constants, 2, r)
+		c1, c2 := genomes.Crossover(e, o, r, 6)
+		if genomes.ExpressionDepth(c1) > 6 || genomes.ExpressionDepth(c2) > 6 {
+			t.Fatalf("crossover exceeded depth: %s, %s", c1, c2)
+		}
+	}
+}
+
+func TestConstantsRoundTrip(t *testing.T) {
+	// if(x0, 2 * x0, sin(3)) - 4
+	expr := genomes.NonTerminal{genomes.Subtract,
+		genomes.Function{genomes.IfThenElse, []genomes.Expression{
+			genomes.Variable{0},
+			genomes.NonTerminal{genomes.Multiply, genomes.Primitive{2}, genomes.Variable{0}},
+			genomes.Function{genomes.Sin, []genomes.Expression{genomes.Primitive{3}}},
+		}},
+		genomes.Primitive{4},
+	}
+
+	if got := genomes.Constants(expr); !slices.Equal(got, []float64{2, 3, 4}) {
+		t.Fatalf("expected constants [2 3 4], got %v", got)
+	}
+
+	replaced := genomes.WithConstants(expr, []float64{5, 6, 7})
+	if got := genomes.Constants(replaced); !slices.Equal(got, []float64{5, 6, 7}) {
+		t.Errorf("expected constants [5 6 7], got %v", got)
+	}
+	if got := genomes.Constants(expr); !slices.Equal(got, []float64{2, 3, 4}) {
+		t.Errorf("original changed to %v", got)
+	}
+	if replaced.Eval([]float64{1}) != 5-7 {
+		t.Errorf("expected -2, got %f", replaced.Eval([]float64{1}))
+	}
+}
+
+func TestEphemeralRandomConstants(t *testing.T) {
+	r := rand.New(rand.NewPCG(7, 8))
+	set := genomes.DefaultPrimitiveSet()
+	set.ERC = &genomes.ERC{Min: -1, Max: 1}
+	mutate := genomes.NewMutateExpressionSet(set, nil, 1, r)
+
+	seen := map[float64]bool{}
+	for range 50 {
+		e := genomes.RandomFormulaFrom(set, 5, nil, 1, r)
+		for _, c := range append(genomes.Constants(e), genomes.Constants(mutate(e))...) {
+			if c < -1 || c >= 1 {
+				t.Fatalf("constant %f outside ERC range", c)
+			}
+			seen[c] = true
+		}
+	}
+	if len(seen) < 20 {
+		t.Errorf("expected many distinct constants, got %d", len(seen))
+	}
+}
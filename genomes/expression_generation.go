@@ -1,44 +1,221 @@
 package genomes
 
 import (
+	"fmt"
 	"math/rand/v2"
+	"slices"
+	"strings"
 )
 
-func createRandomTerminal(variables, constants *[]float64, numVars int, r *rand.Rand) Expression {
-	if numVars == 0 || r.Float64() < 0.5 {
+// createRandomTerminal picks a constant or a variable evenly, or only
+// variables if there is neither ERC nor a constants list.
+func createRandomTerminal(set PrimitiveSet, constants *[]float64, numVars int, r *rand.Rand) Expression {
+	hasConstants := set.ERC != nil || (constants != nil && len(*constants) > 0)
+	if numVars == 0 || (hasConstants && r.Float64() < 0.5) {
+		if set.ERC != nil {
+			return Primitive{Value: set.ERC.random(r)}
+		}
+		if !hasConstants {
+			panic("genomes: no variables, constants or ERC to make a terminal from")
+		}
 		return Primitive{Value: (*constants)[r.IntN(len(*constants))]}
 	} else {
-		return Variable{
-			Variables: variables,
-			Index:     r.IntN(numVars),
+		return Variable{Index: r.IntN(numVars)}
+	}
+}
+
+// terminalCount is how many distinct terminals grow chooses between, with
+// ERC counting as one.
+func terminalCount(set PrimitiveSet, constants *[]float64, numVars int) int {
+	switch {
+	case set.ERC != nil:
+		return numVars + 1
+	case constants == nil:
+		return numVars
+	}
+	return numVars + len(*constants)
+}
+
+func createRandomNonTerminal(set PrimitiveSet, currentDepth, maxDepth int, full bool, constants *[]float64, numVars int, r *rand.Rand) Expression {
+	choice := r.IntN(len(set.Operators) + len(set.Functions))
+	if choice < len(set.Operators) {
+		return NonTerminal{
+			Operator: set.Operators[choice],
+			Left:     createRandomExpression(set, currentDepth+1, maxDepth, full, constants, numVars, r),
+			Right:    createRandomExpression(set, currentDepth+1, maxDepth, full, constants, numVars, r),
 		}
 	}
+
+	f := set.Functions[choice-len(set.Operators)]
+	args := make([]Expression, f.Arity)
+	for i := range args {
+		args[i] = createRandomExpression(set, currentDepth+1, maxDepth, full, constants, numVars, r)
+	}
+	return Function{Func: f, Args: args}
 }
 
-func createRandomExpression(currentDepth, maxDepth int, variables, constants *[]float64, numVars int, r *rand.Rand) Expression {
-	if currentDepth == maxDepth {
-		return createRandomTerminal(variables, constants, numVars, r)
+// createRandomExpression builds a tree whose branches end by maxDepth. The
+// full method only places terminals there; grow picks each node uniformly
+// from all primitives, so branches may end sooner (Koza 1992).
+func createRandomExpression(set PrimitiveSet, currentDepth, maxDepth int, full bool, constants *[]float64, numVars int, r *rand.Rand) Expression {
+	nonTerminals := len(set.Operators) + len(set.Functions)
+	if currentDepth >= maxDepth || nonTerminals == 0 {
+		return createRandomTerminal(set, constants, numVars, r)
 	}
+	if full || r.IntN(nonTerminals+terminalCount(set, constants, numVars)) < nonTerminals {
+		return createRandomNonTerminal(set, currentDepth, maxDepth, full, constants, numVars, r)
+	}
+	return createRandomTerminal(set, constants, numVars, r)
+}
+
+func RandomFormula(maxDepth int, constants *[]float64, numVars int, r *rand.Rand) Expression {
+	return RandomFormulaFrom(DefaultPrimitiveSet(), maxDepth, constants, numVars, r)
+}
 
-	// TODO: Make this negative exponential with max depth
-	probNonTerminal := 1.0 - (float64(currentDepth) / float64(maxDepth))
+// RandomFormulaFrom grows a random expression from the operators and
+// functions in set, at most maxDepth edges deep.
+func RandomFormulaFrom(set PrimitiveSet, maxDepth int, constants *[]float64, numVars int, r *rand.Rand) Expression {
+	return GrowFormula(set, maxDepth, constants, numVars, r)
+}
 
-	if r.Float64() < probNonTerminal {
-		return NonTerminal{
+// GrowFormula builds a tree with the grow method: nodes are drawn from all
+// primitives until maxDepth, so shapes and sizes vary.
+func GrowFormula(set PrimitiveSet, maxDepth int, constants *[]float64, numVars int, r *rand.Rand) Expression {
+	return createRandomExpression(set, 0, maxDepth, false, constants, numVars, r)
+}
+
+// FullFormula builds a tree with the full method: every branch is exactly
+// depth edges long.
+func FullFormula(set PrimitiveSet, depth int, constants *[]float64, numVars int, r *rand.Rand) Expression {
+	return createRandomExpression(set, 0, depth, true, constants, numVars, r)
+}
+
+// Initialisation is how an initial population of trees is built.
+type Initialisation int
+
+const (
+	Grow Initialisation = iota
+	Full
+	// RampedHalfAndHalf spreads the population evenly over the depths from
+	// the minimum to the maximum, half grown and half full at each
+	RampedHalfAndHalf
+)
+
+func ParseInitialisation(name string) (Initialisation, error) {
+	switch name {
+	case "grow":
+		return Grow, nil
+	case "full":
+		return Full, nil
+	case "", "ramped":
+		return RampedHalfAndHalf, nil
+	default:
+		return RampedHalfAndHalf, fmt.Errorf("unknown tree initialisation %q", name)
+	}
+}
+
+func (i Initialisation) String() string {
+	return [...]string{"grow", "full", "ramped"}[i]
+}
 
-			Operator: Operator(r.IntN(int(numOperators))),
-			Left:     createRandomExpression(currentDepth+1, maxDepth, variables, constants, numVars, r),
-			Right:    createRandomExpression(currentDepth+1, maxDepth, variables, constants, numVars, r),
+// NewCreateExpression returns a tree creator for the population. Grow and
+// full build every tree to maxDepth; ramped half-and-half cycles through
+// the depths minDepth..maxDepth, alternating full and grow, so each depth
+// and method gets an equal share of the population.
+func NewCreateExpression(method Initialisation, set PrimitiveSet, minDepth, maxDepth int, constants *[]float64, numVars int, r *rand.Rand) func() Expression {
+	minDepth = min(max(minDepth, 0), maxDepth)
+	created := 0
+	return func() Expression {
+		switch method {
+		case Grow:
+			return GrowFormula(set, maxDepth, constants, numVars, r)
+		case Full:
+			return FullFormula(set, maxDepth, constants, numVars, r)
 		}
-	} else {
-		return createRandomTerminal(variables, constants, numVars, r)
+		depth := minDepth + created/2%(maxDepth-minDepth+1)
+		full := created%2 == 0
+		created++
+		if full {
+			return FullFormula(set, depth, constants, numVars, r)
+		}
+		return GrowFormula(set, depth, constants, numVars, r)
+	}
+}
+
+// NewDistinctExpression wraps create to avoid duplicates, retrying up to
+// attempts times for a tree it has not made before. Small primitive sets
+// can run out of distinct shallow trees, so after that a duplicate is
+// accepted.
+func NewDistinctExpression(create func() Expression, attempts int) func() Expression {
+	seen := map[string]bool{}
+	return func() Expression {
+		e := create()
+		for range attempts {
+			if !seen[e.String()] {
+				break
+			}
+			e = create()
+		}
+		seen[e.String()] = true
+		return e
+	}
+}
+
+// Shapes summarises the depths and sizes of a population of trees, to
+// check an initialisation gives the spread intended.
+type Shapes struct {
+	Depths map[int]int
+	Sizes  map[int]int
+	// Distinct counts the different trees
+	Distinct int
+	Total    int
+}
+
+// ExpressionShapes counts trees by ExpressionDepth and ExpressionSize. As
+// ExpressionDepth counts nodes, a tree built to depth d has depth d+1 here.
+// Its result's String fits a BeforeEvaluate hook run once on the initial
+// population.
+func ExpressionShapes(es []Expression) Shapes {
+	s := Shapes{Depths: map[int]int{}, Sizes: map[int]int{}, Total: len(es)}
+	seen := map[string]bool{}
+	for _, e := range es {
+		s.Depths[ExpressionDepth(e)]++
+		s.Sizes[ExpressionSize(e)]++
+		seen[e.String()] = true
 	}
+	s.Distinct = len(seen)
+	return s
 }
 
-func RandomFormula(maxDepth int, variables, constants *[]float64, numVars int, r *rand.Rand) Expression {
-	if maxDepth <= 0 {
-		return createRandomTerminal(variables, constants, numVars, r)
+func (s Shapes) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d trees, %d distinct\n", s.Total, s.Distinct)
+	sb.WriteString("Depth:\n")
+	writeHistogram(&sb, s.Depths, 1)
+	sb.WriteString("Size:\n")
+	writeHistogram(&sb, s.Sizes, 5)
+	return sb.String()
+}
+
+// writeHistogram prints counts grouped into bins of width binWidth, with
+// bars scaled to the largest bin.
+func writeHistogram(sb *strings.Builder, counts map[int]int, binWidth int) {
+	bins := map[int]int{}
+	largest := 0
+	for v, n := range counts {
+		bins[v/binWidth*binWidth] += n
+		largest = max(largest, bins[v/binWidth*binWidth])
+	}
+	var keys []int
+	for k := range bins {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		label := fmt.Sprint(k)
+		if binWidth > 1 {
+			label = fmt.Sprintf("%d-%d", k, k+binWidth-1)
+		}
+		fmt.Fprintf(sb, "  %-7s %5d %s\n", label, bins[k], strings.Repeat("#", (40*bins[k]+largest-1)/largest))
 	}
-	// TODO: Dont do all at max depth, do a distribution based on totalPop
-	return createRandomExpression(0, maxDepth, variables, constants, numVars, r)
 }
@@ -0,0 +1,123 @@
+package genomes_test
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+func TestFullFormula(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	constants := []float64{1, 2}
+	for depth := range 6 {
+		e := genomes.FullFormula(genomes.DefaultPrimitiveSet(), depth, &constants, 2, r)
+		if got := genomes.ExpressionDepth(e); got != depth+1 {
+			t.Errorf("depth %d: got ExpressionDepth %d", depth, got)
+		}
+		// Only binary operators, so the tree is complete
+		if got, want := genomes.ExpressionSize(e), 1<<(depth+1)-1; got != want {
+			t.Errorf("depth %d: got size %d, want %d", depth, got, want)
+		}
+	}
+}
+
+func TestGrowFormula(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4))
+	constants := []float64{1, 2}
+	set, _ := genomes.ParsePrimitiveSet([]string{"+", "*", "sin"})
+	depths := map[int]bool{}
+	for range 200 {
+		d := genomes.ExpressionDepth(genomes.GrowFormula(set, 5, &constants, 2, r))
+		if d > 6 {
+			t.Fatalf("grown tree has depth %d, limit 6", d)
+		}
+		depths[d] = true
+	}
+	if len(depths) < 4 {
+		t.Errorf("grow should vary depth, got only %v", depths)
+	}
+}
+
+func TestRampedHalfAndHalf(t *testing.T) {
+	r := rand.New(rand.NewPCG(5, 6))
+	constants := []float64{1, 2}
+	create := genomes.NewCreateExpression(genomes.RampedHalfAndHalf, genomes.DefaultPrimitiveSet(), 2, 6, &constants, 2, r)
+
+	trees := make([]genomes.Expression, 100)
+	for i := range trees {
+		trees[i] = create()
+	}
+	shapes := genomes.ExpressionShapes(trees)
+
+	// Each depth's full trees reach it, and grown ones can't exceed it
+	for d := 3; d <= 7; d++ {
+		if shapes.Depths[d] < 10 {
+			t.Errorf("depth %d has %d trees, want at least its 10 full ones", d, shapes.Depths[d])
+		}
+	}
+	for d := range shapes.Depths {
+		if d > 7 {
+			t.Errorf("tree of depth %d past the maximum", d)
+		}
+	}
+}
+
+func TestGrowWithoutConstants(t *testing.T) {
+	r := rand.New(rand.NewPCG(9, 10))
+	for range 50 {
+		e := genomes.GrowFormula(genomes.DefaultPrimitiveSet(), 4, nil, 2, r)
+		if c := genomes.Constants(e); len(c) > 0 {
+			t.Fatalf("%s has constants %v without a constants list or ERC", e, c)
+		}
+	}
+}
+
+func TestParseInitialisation(t *testing.T) {
+	for _, name := range []string{"grow", "full", "ramped"} {
+		i, err := genomes.ParseInitialisation(name)
+		if err != nil || i.String() != name {
+			t.Errorf("ParseInitialisation(%q) = %v, %v", name, i, err)
+		}
+	}
+	if _, err := genomes.ParseInitialisation("koza"); err == nil {
+		t.Error("expected an error for an unknown method")
+	}
+}
+
+func TestDistinctExpression(t *testing.T) {
+	r := rand.New(rand.NewPCG(7, 8))
+	constants := []float64{1, 2, 3}
+	create := genomes.NewDistinctExpression(
+		genomes.NewCreateExpression(genomes.RampedHalfAndHalf, genomes.DefaultPrimitiveSet(), 1, 3, &constants, 2, r),
+		20,
+	)
+	trees := make([]genomes.Expression, 200)
+	for i := range trees {
+		trees[i] = create()
+	}
+	if shapes := genomes.ExpressionShapes(trees); shapes.Distinct != shapes.Total {
+		t.Errorf("got %d distinct trees of %d", shapes.Distinct, shapes.Total)
+	}
+
+	// Only 2 distinct trees exist, so duplicates must be let through
+	one := []float64{1}
+	create = genomes.NewDistinctExpression(func() genomes.Expression {
+		return genomes.GrowFormula(genomes.PrimitiveSet{}, 3, &one, 1, r)
+	}, 5)
+	for range 10 {
+		create()
+	}
+}
+
+func TestExpressionShapesString(t *testing.T) {
+	trees := []genomes.Expression{x0, x0, op(genomes.Add, x0, x1)}
+	shapes := genomes.ExpressionShapes(trees)
+	if shapes.Depths[1] != 2 || shapes.Depths[2] != 1 || shapes.Sizes[3] != 1 || shapes.Distinct != 2 {
+		t.Errorf("unexpected shapes %+v", shapes)
+	}
+	if s := shapes.String(); !strings.HasPrefix(s, "3 trees, 2 distinct\n") || !strings.Contains(s, "Size:\n  0-4") {
+		t.Errorf("unexpected report:\n%s", s)
+	}
+}
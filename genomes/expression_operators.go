@@ -0,0 +1,246 @@
+package genomes
+
+import (
+	"math/rand/v2"
+	"slices"
+)
+
+// node is a subtree found by walking a tree in pre-order.
+type node struct {
+	path  Path
+	depth int
+	size  int
+	expr  Expression
+}
+
+func treeNodes(e Expression) []node {
+	var nodes []node
+	var walk func(e Expression, path Path)
+	walk = func(e Expression, path Path) {
+		at := len(nodes)
+		nodes = append(nodes, node{path: path, depth: len(path), expr: e})
+		for i, c := range children(e) {
+			walk(c, append(slices.Clone(path), i))
+		}
+		nodes[at].size = len(nodes) - at
+	}
+	walk(e, Path{})
+	return nodes
+}
+
+// internalNodes keeps the nodes with at least minChildren children.
+func internalNodes(nodes []node, minChildren int) []node {
+	var internal []node
+	for _, n := range nodes {
+		if len(children(n.expr)) >= minChildren {
+			internal = append(internal, n)
+		}
+	}
+	return internal
+}
+
+// pickWeighted returns an index drawn in proportion to weights, or -1 if
+// they are all zero.
+func pickWeighted(weights []float64, rng *rand.Rand) int {
+	total := 0.0
+	for _, w := range weights {
+		total += max(w, 0)
+	}
+	if total == 0 {
+		return -1
+	}
+	x := rng.Float64() * total
+	for i, w := range weights {
+		x -= max(w, 0)
+		if x < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
+
+// SubtreeMutation replaces a random subtree with one grown to at most
+// subtreeDepth, keeping e if the result is deeper than maxDepth.
+func SubtreeMutation(e Expression, set PrimitiveSet, constants *[]float64, numVars, subtreeDepth, maxDepth int, rng *rand.Rand) Expression {
+	path := pickPath(e, rng.IntN(countNodes(e)))
+	grown := GrowFormula(set, subtreeDepth, constants, numVars, rng)
+	return depthLimited(setAt(e, path, grown), e, maxDepth)
+}
+
+// HoistMutation replaces e with one of its proper subtrees, which shrinks
+// bloated trees while keeping working code.
+func HoistMutation(e Expression, rng *rand.Rand) Expression {
+	n := countNodes(e)
+	if n == 1 {
+		return e
+	}
+	return getAt(e, pickPath(e, 1+rng.IntN(n-1)))
+}
+
+// ShrinkMutation replaces a random operator or function node with one of
+// its arguments.
+func ShrinkMutation(e Expression, rng *rand.Rand) Expression {
+	internal := internalNodes(treeNodes(e), 1)
+	if len(internal) == 0 {
+		return e
+	}
+	n := internal[rng.IntN(len(internal))]
+	c := children(n.expr)
+	return setAt(e, n.path, c[rng.IntN(len(c))])
+}
+
+// PermutationMutation shuffles the arguments of a random node with two or
+// more of them, e.g. turning x - y into y - x.
+func PermutationMutation(e Expression, rng *rand.Rand) Expression {
+	internal := internalNodes(treeNodes(e), 2)
+	if len(internal) == 0 {
+		return e
+	}
+	n := internal[rng.IntN(len(internal))]
+	c := slices.Clone(children(n.expr))
+	rng.Shuffle(len(c), func(i, j int) { c[i], c[j] = c[j], c[i] })
+	return setAt(e, n.path, withChildren(n.expr, c))
+}
+
+// ConstantPerturbation adds Gaussian noise with standard deviation sigma to
+// every constant, so values can drift off the constants list.
+func ConstantPerturbation(e Expression, sigma float64, rng *rand.Rand) Expression {
+	values := Constants(e)
+	if len(values) == 0 {
+		return e
+	}
+	for i := range values {
+		values[i] += rng.NormFloat64() * sigma
+	}
+	return WithConstants(e, values)
+}
+
+// TreeMutationRates weights how often each mutation operator is chosen.
+// One operator is applied per mutation.
+type TreeMutationRates struct {
+	Point       float64
+	Subtree     float64
+	Hoist       float64
+	Shrink      float64
+	Permutation float64
+	Constant    float64
+}
+
+// TreeMutationOptions tunes the mutation operators. A zero MaxDepth means
+// unbounded.
+type TreeMutationOptions struct {
+	SwapRate      float64
+	SubtreeDepth  int
+	MaxDepth      int
+	ConstantSigma float64
+}
+
+// NewTreeMutation applies one of the mutation operators per call, picked
+// in proportion to rates, or point mutation if every rate is zero.
+func NewTreeMutation(set PrimitiveSet, constants []float64, numVars int, rates TreeMutationRates, o TreeMutationOptions, rng *rand.Rand) func(e Expression) Expression {
+	point := NewPointMutation(set, constants, numVars, o.SwapRate, rng)
+	operators := []func(e Expression) Expression{
+		point,
+		func(e Expression) Expression {
+			return SubtreeMutation(e, set, &constants, numVars, o.SubtreeDepth, o.MaxDepth, rng)
+		},
+		func(e Expression) Expression { return HoistMutation(e, rng) },
+		func(e Expression) Expression { return ShrinkMutation(e, rng) },
+		func(e Expression) Expression { return PermutationMutation(e, rng) },
+		func(e Expression) Expression { return ConstantPerturbation(e, o.ConstantSigma, rng) },
+	}
+	weights := []float64{rates.Point, rates.Subtree, rates.Hoist, rates.Shrink, rates.Permutation, rates.Constant}
+	return func(e Expression) Expression {
+		if i := pickWeighted(weights, rng); i >= 0 {
+			return operators[i](e)
+		}
+		return point(e)
+	}
+}
+
+// SizeFairCrossover swaps a random subtree of p1 for one of p2 no larger
+// than twice its size plus one, so offspring cannot grow much faster than
+// their parents (after Langdon 2000).
+func SizeFairCrossover(p1, p2 Expression, rng *rand.Rand, maxDepth int) (Expression, Expression) {
+	nodes1 := treeNodes(p1)
+	n1 := nodes1[rng.IntN(len(nodes1))]
+
+	var candidates []node
+	for _, n := range treeNodes(p2) {
+		if n.size <= 2*n1.size+1 {
+			candidates = append(candidates, n)
+		}
+	}
+	// Terminals always qualify, so there is a candidate
+	n2 := candidates[rng.IntN(len(candidates))]
+	return swapSubtrees(p1, p2, n1.path, n2.path, maxDepth)
+}
+
+// pickByDepth picks a depth level uniformly and then a node at it, so deep
+// levels with many leaves are no likelier than the root's.
+func pickByDepth(e Expression, rng *rand.Rand) Path {
+	levels := map[int][]Path{}
+	for _, n := range treeNodes(e) {
+		levels[n.depth] = append(levels[n.depth], n.path)
+	}
+	level := levels[rng.IntN(len(levels))]
+	return level[rng.IntN(len(level))]
+}
+
+// DepthFairCrossover picks each parent's crossover point with pickByDepth
+// rather than uniformly over nodes, which in bushy trees mostly picks
+// leaves (after Ito, Iba and Sato 1998).
+func DepthFairCrossover(p1, p2 Expression, rng *rand.Rand, maxDepth int) (Expression, Expression) {
+	return swapSubtrees(p1, p2, pickByDepth(p1, rng), pickByDepth(p2, rng), maxDepth)
+}
+
+// UniformCrossover walks the parents' common region, where both have
+// nodes of the same arity, swapping each node with probability one half.
+// Inside the region only the operator or function swaps; where it ends the
+// whole subtrees do (Poli and Langdon 1998).
+func UniformCrossover(p1, p2 Expression, rng *rand.Rand, maxDepth int) (Expression, Expression) {
+	c1, c2 := uniformCrossover(p1, p2, rng)
+	return depthLimited(c1, p1, maxDepth), depthLimited(c2, p2, maxDepth)
+}
+
+func uniformCrossover(a, b Expression, rng *rand.Rand) (Expression, Expression) {
+	ca, cb := children(a), children(b)
+	if len(ca) == 0 || len(ca) != len(cb) {
+		if rng.Float64() < 0.5 {
+			return b, a
+		}
+		return a, b
+	}
+
+	na, nb := make([]Expression, len(ca)), make([]Expression, len(cb))
+	for i := range ca {
+		na[i], nb[i] = uniformCrossover(ca[i], cb[i], rng)
+	}
+	if rng.Float64() < 0.5 {
+		a, b = b, a
+	}
+	return withChildren(a, na), withChildren(b, nb)
+}
+
+// TreeCrossoverRates weights how often each crossover operator is chosen.
+type TreeCrossoverRates struct {
+	Subtree   float64
+	SizeFair  float64
+	DepthFair float64
+	Uniform   float64
+}
+
+// NewTreeCrossover applies one of the crossover operators per call, picked
+// in proportion to rates, or subtree crossover if every rate is zero.
+func NewTreeCrossover(rates TreeCrossoverRates, maxDepth int, rng *rand.Rand) func(Expression, Expression) (Expression, Expression) {
+	operators := []func(p1, p2 Expression, rng *rand.Rand, maxDepth int) (Expression, Expression){
+		Crossover, SizeFairCrossover, DepthFairCrossover, UniformCrossover,
+	}
+	weights := []float64{rates.Subtree, rates.SizeFair, rates.DepthFair, rates.Uniform}
+	return func(p1, p2 Expression) (Expression, Expression) {
+		if i := pickWeighted(weights, rng); i >= 0 {
+			return operators[i](p1, p2, rng, maxDepth)
+		}
+		return Crossover(p1, p2, rng, maxDepth)
+	}
+}
@@ -0,0 +1,160 @@
+package genomes_test
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+func TestHoistMutation(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 1))
+	e := op(genomes.Add, op(genomes.Multiply, x0, c(2)), fn(genomes.Sin, x1))
+	for range 50 {
+		h := genomes.HoistMutation(e, r)
+		if !strings.Contains(e.String(), h.String()) || genomes.ExpressionSize(h) >= genomes.ExpressionSize(e) {
+			t.Fatalf("%s is not a proper subtree of %s", h, e)
+		}
+	}
+	if h := genomes.HoistMutation(x0, r); h.String() != x0.String() {
+		t.Errorf("hoisting a terminal gave %s", h)
+	}
+}
+
+func TestShrinkMutation(t *testing.T) {
+	r := rand.New(rand.NewPCG(2, 2))
+	e := op(genomes.Subtract, op(genomes.Multiply, x0, c(2)), x1)
+	allowed := map[string]bool{
+		"(x0 - x1)":   true,
+		"(2.00 - x1)": true,
+		"(x0 * 2.00)": true,
+		"x1":          true,
+	}
+	for range 50 {
+		s := genomes.ShrinkMutation(e, r).String()
+		if !allowed[s] {
+			t.Fatalf("unexpected shrink of %s: %s", e, s)
+		}
+	}
+}
+
+func TestPermutationMutation(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 3))
+	e := op(genomes.Subtract, x0, x1)
+	seen := map[string]bool{}
+	for range 50 {
+		seen[genomes.PermutationMutation(e, r).String()] = true
+	}
+	if !seen["(x0 - x1)"] || !seen["(x1 - x0)"] || len(seen) != 2 {
+		t.Errorf("unexpected permutations %v", seen)
+	}
+}
+
+func TestConstantPerturbation(t *testing.T) {
+	r := rand.New(rand.NewPCG(4, 4))
+	e := op(genomes.Add, op(genomes.Multiply, x0, c(2)), c(3))
+	p := genomes.ConstantPerturbation(e, 0.1, r)
+
+	before, after := genomes.Constants(e), genomes.Constants(p)
+	if len(after) != 2 || slices.Equal(before, after) {
+		t.Fatalf("constants %v became %v", before, after)
+	}
+	for i := range after {
+		if d := after[i] - before[i]; d > 1 || d < -1 {
+			t.Errorf("constant %d moved by %f with sigma 0.1", i, d)
+		}
+	}
+	if got, want := genomes.WithConstants(p, before).String(), e.String(); got != want {
+		t.Errorf("structure changed: %s, want %s", got, want)
+	}
+}
+
+func TestSubtreeMutationDepthLimit(t *testing.T) {
+	r := rand.New(rand.NewPCG(5, 5))
+	constants := []float64{1}
+	e := genomes.FullFormula(genomes.DefaultPrimitiveSet(), 3, &constants, 2, r)
+	for range 100 {
+		if m := genomes.SubtreeMutation(e, genomes.DefaultPrimitiveSet(), &constants, 2, 3, 5, r); genomes.ExpressionDepth(m) > 5 {
+			t.Fatalf("mutant of depth %d past the limit", genomes.ExpressionDepth(m))
+		}
+	}
+}
+
+func TestNewTreeMutationRates(t *testing.T) {
+	r := rand.New(rand.NewPCG(6, 6))
+	e := op(genomes.Add, op(genomes.Multiply, x0, c(2)), fn(genomes.Sin, x1))
+	// Only hoist, so every mutant is smaller
+	mutate := genomes.NewTreeMutation(genomes.DefaultPrimitiveSet(), []float64{1}, 2,
+		genomes.TreeMutationRates{Hoist: 1}, genomes.TreeMutationOptions{}, r)
+	for range 20 {
+		if m := mutate(e); genomes.ExpressionSize(m) >= genomes.ExpressionSize(e) {
+			t.Fatalf("hoist-only mutation gave %s", m)
+		}
+	}
+}
+
+func TestSizeFairCrossover(t *testing.T) {
+	r := rand.New(rand.NewPCG(7, 7))
+	constants := []float64{1, 2}
+	small := op(genomes.Add, x0, c(1))
+	large := genomes.FullFormula(genomes.DefaultPrimitiveSet(), 6, &constants, 2, r)
+	for range 100 {
+		c1, _ := genomes.SizeFairCrossover(small, large, r, 0)
+		// At most the whole of small swapped for a subtree of size 7
+		if genomes.ExpressionSize(c1) > 7 {
+			t.Fatalf("child of size %d from parents of size 3", genomes.ExpressionSize(c1))
+		}
+	}
+}
+
+func TestDepthFairCrossover(t *testing.T) {
+	r := rand.New(rand.NewPCG(8, 8))
+	constants := []float64{1, 2}
+	set := genomes.DefaultPrimitiveSet()
+	p1 := genomes.FullFormula(set, 5, &constants, 2, r)
+	p2 := genomes.FullFormula(set, 5, &constants, 2, r)
+
+	// A child keeps the full shape only if both points are at the same
+	// depth: a sixth of the time picking by depth, but about a third picking
+	// nodes uniformly, as half of them are leaves
+	kept := 0
+	for range 600 {
+		c1, _ := genomes.DepthFairCrossover(p1, p2, r, 0)
+		if genomes.ExpressionDepth(c1) == 6 && genomes.ExpressionSize(c1) == 63 {
+			kept++
+		}
+	}
+	if kept > 150 {
+		t.Errorf("%d of 600 children kept the shape, expected about 100", kept)
+	}
+}
+
+func TestUniformCrossover(t *testing.T) {
+	r := rand.New(rand.NewPCG(9, 9))
+	p1 := op(genomes.Add, x0, op(genomes.Multiply, x1, c(2)))
+	p2 := op(genomes.Subtract, c(3), fn(genomes.Sin, x0))
+	for range 50 {
+		c1, c2 := genomes.UniformCrossover(p1, p2, r, 0)
+		// Swaps within the common region conserve the node count
+		if genomes.ExpressionSize(c1)+genomes.ExpressionSize(c2) != genomes.ExpressionSize(p1)+genomes.ExpressionSize(p2) {
+			t.Fatalf("%s and %s from %s and %s", c1, c2, p1, p2)
+		}
+	}
+}
+
+func TestNewTreeCrossover(t *testing.T) {
+	r := rand.New(rand.NewPCG(10, 10))
+	constants := []float64{1, 2}
+	set := genomes.DefaultPrimitiveSet()
+	crossover := genomes.NewTreeCrossover(genomes.TreeCrossoverRates{SizeFair: 1, DepthFair: 1, Uniform: 1}, 6, r)
+	for range 200 {
+		p1 := genomes.GrowFormula(set, 5, &constants, 2, r)
+		p2 := genomes.GrowFormula(set, 5, &constants, 2, r)
+		c1, c2 := crossover(p1, p2)
+		if genomes.ExpressionDepth(c1) > 6 || genomes.ExpressionDepth(c2) > 6 {
+			t.Fatalf("children %s and %s past the depth limit", c1, c2)
+		}
+	}
+}
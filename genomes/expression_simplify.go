@@ -0,0 +1,237 @@
+package genomes
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+)
+
+// maxSimplifyPasses bounds how often the rewrite rules are reapplied, since
+// each pass can expose more (e.g. folding a product lines up like terms).
+const maxSimplifyPasses = 10
+
+// SimplifyExpression rewrites e into a smaller equivalent tree: constant
+// subtrees are folded, identities such as x + 0, x * 1 and x / x removed,
+// like terms of sums combined (x + 2*x becomes 3*x) and constant factors of
+// products multiplied out. Intermediate values are assumed finite, so x * 0
+// becomes 0 and x - x becomes 0. Negated terms are written with Neg whether
+// or not the tree's primitive set has it.
+func SimplifyExpression(e Expression) Expression {
+	s := e.String()
+	for range maxSimplifyPasses {
+		e = simplifyNode(e)
+		next := e.String()
+		if next == s {
+			break
+		}
+		s = next
+	}
+	return e
+}
+
+func simplifyNode(e Expression) Expression {
+	c := children(e)
+	if len(c) == 0 {
+		return e
+	}
+
+	simplified := make([]Expression, len(c))
+	constant := true
+	for i := range c {
+		simplified[i] = simplifyNode(c[i])
+		if _, ok := simplified[i].(Primitive); !ok {
+			constant = false
+		}
+	}
+	e = withChildren(e, simplified)
+
+	if constant {
+		// Leave overflow and NaN to run time
+		if v := e.Eval(nil); !math.IsInf(v, 0) && !math.IsNaN(v) {
+			return Primitive{Value: v}
+		}
+		return e
+	}
+
+	switch n := e.(type) {
+	case NonTerminal:
+		switch n.Operator {
+		case Add, Subtract:
+			return combineTerms(n)
+		case Multiply:
+			return combineFactors(n)
+		case Divide:
+			if p, ok := n.Right.(Primitive); ok && p.Value == 1 {
+				return n.Left
+			}
+			// Protected division makes x / x 1 even at 0
+			if n.Left.String() == n.Right.String() {
+				return Primitive{Value: 1}
+			}
+		}
+	case Function:
+		return simplifyFunction(n)
+	}
+	return e
+}
+
+func simplifyFunction(f Function) Expression {
+	switch f.Func.Name {
+	case Neg.Name:
+		if inner, ok := f.Args[0].(Function); ok && inner.Func.Name == Neg.Name {
+			return inner.Args[0]
+		}
+	case IfThenElse.Name:
+		if p, ok := f.Args[0].(Primitive); ok {
+			if p.Value > 0 {
+				return f.Args[1]
+			}
+			return f.Args[2]
+		}
+		if f.Args[1].String() == f.Args[2].String() {
+			return f.Args[1]
+		}
+	}
+	return f
+}
+
+// term is coef * expr, or the constant coef if expr is nil.
+type term struct {
+	coef float64
+	expr Expression
+}
+
+// linearTerms flattens a sum into its terms, pulling constant factors and
+// negations into the coefficients.
+func linearTerms(e Expression, coef float64, terms []term) []term {
+	switch n := e.(type) {
+	case Primitive:
+		return append(terms, term{coef * n.Value, nil})
+	case NonTerminal:
+		switch n.Operator {
+		case Add:
+			return linearTerms(n.Right, coef, linearTerms(n.Left, coef, terms))
+		case Subtract:
+			return linearTerms(n.Right, -coef, linearTerms(n.Left, coef, terms))
+		case Multiply:
+			if p, ok := n.Left.(Primitive); ok {
+				return linearTerms(n.Right, coef*p.Value, terms)
+			}
+			if p, ok := n.Right.(Primitive); ok {
+				return linearTerms(n.Left, coef*p.Value, terms)
+			}
+		}
+	case Function:
+		if n.Func.Name == Neg.Name {
+			return linearTerms(n.Args[0], -coef, terms)
+		}
+	}
+	return append(terms, term{coef, e})
+}
+
+// combineTerms sums the coefficients of like terms. Positive terms come
+// first, in order of first appearance, then negative ones, then the
+// constant, so that as few terms as possible need negating.
+func combineTerms(e Expression) Expression {
+	var order []string
+	like := map[string]*term{}
+	constant := 0.0
+	for _, t := range linearTerms(e, 1, nil) {
+		if t.expr == nil {
+			constant += t.coef
+			continue
+		}
+		key := t.expr.String()
+		if existing, ok := like[key]; ok {
+			existing.coef += t.coef
+			continue
+		}
+		order = append(order, key)
+		like[key] = &term{t.coef, t.expr}
+	}
+
+	slices.SortStableFunc(order, func(a, b string) int {
+		return cmp.Compare(boolInt(like[a].coef < 0), boolInt(like[b].coef < 0))
+	})
+
+	var sum Expression
+	for _, key := range order {
+		t := like[key]
+		switch {
+		case t.coef == 0:
+		case sum == nil && t.coef < 0 && constant > 0:
+			sum = NonTerminal{Operator: Subtract, Left: Primitive{Value: constant}, Right: scaled(-t.coef, t.expr)}
+			constant = 0
+		case sum == nil:
+			sum = scaled(t.coef, t.expr)
+		case t.coef < 0:
+			sum = NonTerminal{Operator: Subtract, Left: sum, Right: scaled(-t.coef, t.expr)}
+		default:
+			sum = NonTerminal{Operator: Add, Left: sum, Right: scaled(t.coef, t.expr)}
+		}
+	}
+
+	switch {
+	case sum == nil:
+		return Primitive{Value: constant}
+	case constant < 0:
+		return NonTerminal{Operator: Subtract, Left: sum, Right: Primitive{Value: -constant}}
+	case constant > 0:
+		return NonTerminal{Operator: Add, Left: sum, Right: Primitive{Value: constant}}
+	}
+	return sum
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func scaled(coef float64, e Expression) Expression {
+	switch coef {
+	case 1:
+		return e
+	case -1:
+		return Function{Func: Neg, Args: []Expression{e}}
+	}
+	return NonTerminal{Operator: Multiply, Left: Primitive{Value: coef}, Right: e}
+}
+
+// factors flattens a product into its constant and other factors.
+func factors(e Expression, coef float64, fs []Expression) (float64, []Expression) {
+	switch n := e.(type) {
+	case Primitive:
+		return coef * n.Value, fs
+	case NonTerminal:
+		if n.Operator == Multiply {
+			coef, fs = factors(n.Left, coef, fs)
+			return factors(n.Right, coef, fs)
+		}
+	case Function:
+		if n.Func.Name == Neg.Name {
+			return factors(n.Args[0], -coef, fs)
+		}
+	}
+	return coef, append(fs, e)
+}
+
+// combineFactors multiplies out a product's constants and orders the other
+// factors canonically, so x * y and y * x are like terms.
+func combineFactors(e Expression) Expression {
+	coef, fs := factors(e, 1, nil)
+	if coef == 0 {
+		return Primitive{Value: 0}
+	}
+	slices.SortStableFunc(fs, func(a, b Expression) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	product := fs[0]
+	for _, f := range fs[1:] {
+		product = NonTerminal{Operator: Multiply, Left: product, Right: f}
+	}
+	return scaled(coef, product)
+}
@@ -0,0 +1,82 @@
+package genomes_test
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+var (
+	x0 = genomes.Variable{0}
+	x1 = genomes.Variable{1}
+)
+
+func c(v float64) genomes.Primitive {
+	return genomes.Primitive{v}
+}
+
+func op(o genomes.Operator, l, r genomes.Expression) genomes.NonTerminal {
+	return genomes.NonTerminal{o, l, r}
+}
+
+func fn(f genomes.Func, args ...genomes.Expression) genomes.Function {
+	return genomes.Function{f, args}
+}
+
+func TestSimplifyExpression(t *testing.T) {
+	tests := []struct {
+		name string
+		in   genomes.Expression
+		want string
+	}{
+		{"identities", op(genomes.Multiply, op(genomes.Add, x0, c(0)), c(1)), "x0"},
+		{"constant folding", op(genomes.Add, op(genomes.Multiply, c(2), c(3)), x0), "(x0 + 6.00)"},
+		{"like terms", op(genomes.Add, op(genomes.Multiply, x0, c(2)), op(genomes.Multiply, c(3), x0)), "(5.00 * x0)"},
+		{"cancelling terms", op(genomes.Subtract, op(genomes.Add, x0, x1), x0), "x1"},
+		{"zero product", op(genomes.Multiply, fn(genomes.Sin, x0), c(0)), "0.00"},
+		{"constant factors", op(genomes.Multiply, c(2), op(genomes.Multiply, x0, c(3))), "(6.00 * x0)"},
+		{"commuted products", op(genomes.Subtract, op(genomes.Multiply, x0, x1), op(genomes.Multiply, x1, x0)), "0.00"},
+		{"self division", op(genomes.Divide, fn(genomes.Cos, x0), fn(genomes.Cos, x0)), "1.00"},
+		{"division by one", op(genomes.Divide, x1, c(1)), "x1"},
+		{"double negation", fn(genomes.Neg, fn(genomes.Neg, x0)), "x0"},
+		{"negated term", op(genomes.Add, x0, fn(genomes.Neg, x0)), "0.00"},
+		{"known condition", fn(genomes.IfThenElse, op(genomes.Subtract, c(1), c(2)), x0, x1), "x1"},
+		{"same branches", fn(genomes.IfThenElse, x0, fn(genomes.Sin, x1), fn(genomes.Sin, x1)), "sin(x1)"},
+		{"simplified arguments", fn(genomes.Exp, op(genomes.Add, x0, c(0))), "exp(x0)"},
+		{"nested sums", op(genomes.Subtract, op(genomes.Add, x0, c(1)), op(genomes.Subtract, c(3), x0)), "((2.00 * x0) - 2.00)"},
+		{"protected division kept", op(genomes.Divide, c(0), x0), "(0.00 / x0)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := genomes.SimplifyExpression(tt.in).String(); got != tt.want {
+				t.Errorf("simplified %s to %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSimplifyExpressionEquivalent(t *testing.T) {
+	r := rand.New(rand.NewPCG(9, 9))
+	set, err := genomes.ParsePrimitiveSet([]string{"+", "-", "*", "sin", "neg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	constants := []float64{0, 1, 2, 0.5}
+
+	for range 200 {
+		e := genomes.RandomFormulaFrom(set, 6, &constants, 2, r)
+		s := genomes.SimplifyExpression(e)
+		if genomes.ExpressionSize(s) > genomes.ExpressionSize(e) {
+			t.Errorf("simplifying %s grew it to %s", e, s)
+		}
+		for range 5 {
+			vars := []float64{r.Float64()*4 - 2, r.Float64()*4 - 2}
+			want, got := e.Eval(vars), s.Eval(vars)
+			if math.Abs(got-want) > 1e-9*math.Max(1, math.Abs(want)) {
+				t.Fatalf("%s simplified to %s: %f != %f at %v", e, s, got, want, vars)
+			}
+		}
+	}
+}
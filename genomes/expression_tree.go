@@ -2,12 +2,14 @@ package genomes
 
 import (
 	"fmt"
-	"math"
 	"math/rand/v2"
+	"slices"
 )
 
+// Expression is an immutable expression tree; Eval takes the input vector so
+// one tree can be evaluated by several goroutines at once.
 type Expression interface {
-	GetValue() float64
+	Eval(vars []float64) float64
 	String() string
 	Compare(other Expression) bool
 }
@@ -32,24 +34,25 @@ type Primitive struct {
 	Value float64
 }
 
+// Variable is the input at Index in the vector passed to Eval.
 type Variable struct {
-	Variables *[]float64
-	Index     int
+	Index int
 }
 
-func (nt NonTerminal) GetValue() float64 {
+func (nt NonTerminal) Eval(vars []float64) float64 {
 	switch nt.Operator {
 	case Add:
-		return nt.Left.GetValue() + nt.Right.GetValue()
+		return nt.Left.Eval(vars) + nt.Right.Eval(vars)
 	case Subtract:
-		return nt.Left.GetValue() - nt.Right.GetValue()
+		return nt.Left.Eval(vars) - nt.Right.Eval(vars)
 	case Multiply:
-		return nt.Left.GetValue() * nt.Right.GetValue()
+		return nt.Left.Eval(vars) * nt.Right.Eval(vars)
 	case Divide:
-		if nt.Right.GetValue() == 0 {
+		right := nt.Right.Eval(vars)
+		if right == 0 {
 			return 1
 		}
-		return nt.Left.GetValue() / nt.Right.GetValue()
+		return nt.Left.Eval(vars) / right
 	default:
 		panic("invalid operator")
 	}
@@ -82,7 +85,7 @@ func (op Operator) String() string {
 	}
 }
 
-func (p Primitive) GetValue() float64 {
+func (p Primitive) Eval(vars []float64) float64 {
 	return p.Value
 }
 
@@ -98,39 +101,65 @@ func (p Primitive) Compare(other Expression) bool {
 	return false
 }
 
-func (v Variable) GetValue() float64 {
-	return (*v.Variables)[v.Index]
+func (v Variable) Eval(vars []float64) float64 {
+	return vars[v.Index]
 }
 
 func (v Variable) String() string {
 	return fmt.Sprintf("x%d", v.Index)
 }
 
-func depth(e Expression) int {
+// children returns a node's subexpressions in order.
+func children(e Expression) []Expression {
 	switch node := e.(type) {
 	case Primitive, Variable:
-		return 1
+		return nil
 	case NonTerminal:
-		depthl := depth(node.Left)
-		depthr := depth(node.Right)
-		if depthl > depthr {
-			return depthl + 1
-		}
-		return depthr + 1
+		return []Expression{node.Left, node.Right}
+	case Function:
+		return node.Args
 	default:
 		panic("unknown node")
 	}
 }
 
-func countNodes(e Expression) int {
+// withChildren returns e with its subexpressions replaced.
+func withChildren(e Expression, c []Expression) Expression {
 	switch node := e.(type) {
-	case Primitive, Variable:
-		return 1
 	case NonTerminal:
-		return 1 + countNodes(node.Left) + countNodes(node.Right)
+		node.Left, node.Right = c[0], c[1]
+		return node
+	case Function:
+		node.Args = c
+		return node
 	default:
-		panic("unknown node")
+		return e
+	}
+}
+
+func depth(e Expression) int {
+	deepest := 0
+	for _, c := range children(e) {
+		deepest = max(deepest, depth(c))
+	}
+	return deepest + 1
+}
+
+// ExpressionSize and ExpressionDepth measure a tree for bloat control.
+func ExpressionSize(e Expression) int {
+	return countNodes(e)
+}
+
+func ExpressionDepth(e Expression) int {
+	return depth(e)
+}
+
+func countNodes(e Expression) int {
+	n := 1
+	for _, c := range children(e) {
+		n += countNodes(c)
 	}
+	return n
 }
 
 func clone(e Expression) Expression {
@@ -138,73 +167,66 @@ func clone(e Expression) Expression {
 	case Primitive:
 		return Primitive{Value: node.Value}
 	case Variable:
-		return Variable{Variables: node.Variables, Index: node.Index}
+		return Variable{Index: node.Index}
 	case NonTerminal:
 		return NonTerminal{
 			Operator: node.Operator,
 			Left:     clone(node.Left),
 			Right:    clone(node.Right),
 		}
+	case Function:
+		args := make([]Expression, len(node.Args))
+		for i, a := range node.Args {
+			args[i] = clone(a)
+		}
+		return Function{Func: node.Func, Args: args}
 	default:
 		panic("unknown node")
 	}
 }
 
+// Path indexes children from the root down; for NonTerminal 0 is Left and
+// 1 is Right.
 type Path []int
 
 func getAt(e Expression, path Path) Expression {
-	if len(path) == 0 {
-		return e
-	}
-	nt, ok := e.(NonTerminal)
-	if !ok {
+	c := children(e)
+	if len(path) == 0 || len(c) == 0 {
 		return e
 	}
-	if path[0] == 0 {
-		return getAt(nt.Left, path[1:])
-	}
-	return getAt(nt.Right, path[1:])
+	return getAt(c[path[0]], path[1:])
 }
 
 func setAt(e Expression, path Path, repl Expression) Expression {
-	if len(path) == 0 {
-		return clone(repl)
-	}
-	nt, ok := e.(NonTerminal)
-	if !ok {
+	c := children(e)
+	if len(path) == 0 || len(c) == 0 {
 		return clone(repl)
 	}
-	if path[0] == 0 {
-		return NonTerminal{
-			Operator: nt.Operator,
-			Left:     setAt(nt.Left, path[1:], repl),
-			Right:    clone(nt.Right),
+	replaced := make([]Expression, len(c))
+	for i := range c {
+		if i == path[0] {
+			replaced[i] = setAt(c[i], path[1:], repl)
+		} else {
+			replaced[i] = clone(c[i])
 		}
 	}
-	return NonTerminal{
-		Operator: nt.Operator,
-		Left:     clone(nt.Left),
-		Right:    setAt(nt.Right, path[1:], repl),
-	}
+	return withChildren(e, replaced)
 }
 
+// pickPath returns the path to the idx-th node in pre-order.
 func pickPath(e Expression, idx int) Path {
-	switch node := e.(type) {
-	case Primitive, Variable:
+	if idx == 0 {
 		return Path{}
-	case NonTerminal:
-		if idx == 0 {
-			return Path{}
-		}
-		idx--
-		leftCount := countNodes(node.Left)
-		if idx < leftCount {
-			return append(Path{0}, pickPath(node.Left, idx)...)
+	}
+	idx--
+	for i, c := range children(e) {
+		n := countNodes(c)
+		if idx < n {
+			return append(Path{i}, pickPath(c, idx)...)
 		}
-		return append(Path{1}, pickPath(node.Right, idx-leftCount)...)
-	default:
-		panic("unknown node")
+		idx -= n
 	}
+	return Path{}
 }
 
 func NewCrossoverExpression(rng *rand.Rand, maxDepth int) func(Expression, Expression) (Expression, Expression) {
@@ -223,29 +245,25 @@ func Crossover(p1, p2 Expression, rng *rand.Rand, maxDepth int) (Expression, Exp
 		return clone1, clone2
 	}
 
-	point1 := rng.IntN(int(math.Ceil(float64(nodes1) / 3.0)))
-	point2 := rng.IntN(int(math.Ceil(float64(nodes2) / 3.0)))
-	// fmt.Println("Crossover points:", point1, point2)
-	path1 := pickPath(clone1, point1)
-	path2 := pickPath(clone2, point2)
-
-	sub1 := getAt(clone1, path1)
-	sub2 := getAt(clone2, path2)
-	// fmt.Println(sub1.String(), "<->", sub2.String())
+	path1 := pickPath(clone1, rng.IntN(nodes1))
+	path2 := pickPath(clone2, rng.IntN(nodes2))
+	return swapSubtrees(clone1, clone2, path1, path2, maxDepth)
+}
 
-	child1 := setAt(clone1, path1, sub2)
-	child2 := setAt(clone2, path2, sub1)
+// swapSubtrees exchanges the subtrees at path1 and path2, keeping a parent
+// in place of any child deeper than maxDepth.
+func swapSubtrees(p1, p2 Expression, path1, path2 Path, maxDepth int) (Expression, Expression) {
+	sub1 := getAt(p1, path1)
+	sub2 := getAt(p2, path2)
+	return depthLimited(setAt(p1, path1, sub2), p1, maxDepth), depthLimited(setAt(p2, path2, sub1), p2, maxDepth)
+}
 
-	if maxDepth > 0 {
-		if depth(child1) > maxDepth {
-			child1 = clone1
-		}
-		if depth(child2) > maxDepth {
-			child2 = clone2
-		}
+// depthLimited returns child, or parent if child is deeper than maxDepth.
+func depthLimited(child, parent Expression, maxDepth int) Expression {
+	if maxDepth > 0 && depth(child) > maxDepth {
+		return parent
 	}
-
-	return child1, child2
+	return child
 }
 
 func (v Variable) Compare(other Expression) bool {
@@ -256,29 +274,59 @@ func (v Variable) Compare(other Expression) bool {
 	return false
 }
 
-func NewMutateExpression(constants []float64, rng *rand.Rand) func(e Expression) Expression {
+// DefaultSwapRate is how often point mutation swaps an operator or function
+// rather than descending past it.
+const DefaultSwapRate = 0.1
+
+func NewMutateExpression(constants []float64, numVars int, rng *rand.Rand) func(e Expression) Expression {
+	return NewMutateExpressionSet(DefaultPrimitiveSet(), constants, numVars, rng)
+}
+
+func NewMutateExpressionSet(set PrimitiveSet, constants []float64, numVars int, rng *rand.Rand) func(e Expression) Expression {
+	return NewPointMutation(set, constants, numVars, DefaultSwapRate, rng)
+}
+
+// NewPointMutation mutates one node on a random path: a constant or
+// variable is redrawn, an operator or function is swapped for one of the
+// same arity from set with probability swapRate, or the mutation descends
+// into a child.
+func NewPointMutation(set PrimitiveSet, constants []float64, numVars int, swapRate float64, rng *rand.Rand) func(e Expression) Expression {
 	var MutateExpression func(e Expression) Expression
 
 	MutateExpression = func(e Expression) Expression {
 		switch x := e.(type) {
 		case Primitive:
-			x.Value = constants[rng.IntN(len(constants))]
+			if set.ERC != nil {
+				x.Value = set.ERC.random(rng)
+			} else if len(constants) > 0 {
+				x.Value = constants[rng.IntN(len(constants))]
+			}
 			return x
 		case Variable:
-			x.Index = rng.IntN(len(*x.Variables))
+			x.Index = rng.IntN(numVars)
 			return x
 		case NonTerminal:
 			random := rng.Float64()
-			if random < 0.1 { // FIXME: Shouldn't be hardcoded
-				x.Operator = Operator(rng.IntN(int(numOperators)))
+			if random < swapRate && len(set.Operators) > 0 {
+				x.Operator = set.Operators[rng.IntN(len(set.Operators))]
 				return x
-			} else if random < 0.55 {
+			} else if random < swapRate+(1-swapRate)/2 {
 				x.Left = MutateExpression(x.Left)
 				return x
 			} else {
 				x.Right = MutateExpression(x.Right)
 				return x
 			}
+		case Function:
+			if funcs := set.withArity(len(x.Args)); rng.Float64() < swapRate && len(funcs) > 0 {
+				x.Func = funcs[rng.IntN(len(funcs))]
+				return x
+			}
+			i := rng.IntN(len(x.Args))
+			args := slices.Clone(x.Args)
+			args[i] = MutateExpression(args[i])
+			x.Args = args
+			return x
 		default:
 			panic("Unexpected expression type in MutateExpression")
 		}
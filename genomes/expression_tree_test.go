@@ -10,30 +10,28 @@ import (
 )
 
 func TestExpressionTreeSingle(t *testing.T) {
-	expr := genomes.NonTerminal{genomes.Add, genomes.Primitive{3}, genomes.Variable{&[]float64{2}, 0}}
+	expr := genomes.NonTerminal{genomes.Add, genomes.Primitive{3}, genomes.Variable{0}}
 
-	if expr.GetValue() != 5 {
-		t.Errorf("Expression is not expected value, expected 5, got %f\n", expr.GetValue())
+	if expr.Eval([]float64{2}) != 5 {
+		t.Errorf("Expression is not expected value, expected 5, got %f\n", expr.Eval([]float64{2}))
 	}
 }
 
 func TestExpressionTreeParameterized(t *testing.T) {
-	variables := make([]float64, 3)
-
 	// x1 + ( 3 * x2 - x3 / 2 )
 	expr := genomes.NonTerminal{
 		genomes.Add,
-		genomes.Variable{&variables, 0},
+		genomes.Variable{0},
 		genomes.NonTerminal{
 			genomes.Subtract,
 			genomes.NonTerminal{
 				genomes.Multiply,
 				genomes.Primitive{3},
-				genomes.Variable{&variables, 1},
+				genomes.Variable{1},
 			},
 			genomes.NonTerminal{
 				genomes.Divide,
-				genomes.Variable{&variables, 2},
+				genomes.Variable{2},
 				genomes.Primitive{2},
 			},
 		},
@@ -51,8 +49,7 @@ func TestExpressionTreeParameterized(t *testing.T) {
 
 	for idx, in := range tests {
 		t.Run(fmt.Sprintf("Tree %d", idx), func(t *testing.T) {
-			variables = in.sample
-			got := expr.GetValue()
+			got := expr.Eval(in.sample)
 
 			if got != in.want {
 				t.Errorf("Got %f in test index %d, expected %f", got, idx, in.want)
@@ -61,6 +58,18 @@ func TestExpressionTreeParameterized(t *testing.T) {
 	}
 }
 
+func TestExpressionSizeAndDepth(t *testing.T) {
+	x := genomes.Variable{0}
+	expr := genomes.NonTerminal{genomes.Add, genomes.Primitive{3}, genomes.NonTerminal{genomes.Multiply, x, x}}
+
+	if size := genomes.ExpressionSize(expr); size != 5 {
+		t.Errorf("Expected size 5, got %d", size)
+	}
+	if depth := genomes.ExpressionDepth(expr); depth != 3 {
+		t.Errorf("Expected depth 3, got %d", depth)
+	}
+}
+
 func TestRandomExpression(t *testing.T) {
 
 	tests := []struct {
@@ -95,9 +104,9 @@ func TestRandomExpression(t *testing.T) {
 			variableValues := in.varValues
 			constants := in.constants
 
-			expr := genomes.RandomFormula(maxDepth, &variableValues, &constants, numVars, r)
+			expr := genomes.RandomFormula(maxDepth, &constants, numVars, r)
 
-			result := expr.GetValue()
+			result := expr.Eval(variableValues)
 
 			if math.IsNaN(result) || math.IsInf(result, 0) || result == math.MaxFloat64 {
 				t.Errorf("Got %f as result which is not expected type", result)
@@ -108,27 +117,25 @@ func TestRandomExpression(t *testing.T) {
 
 func TestMakeMutateExpression(t *testing.T) {
 	constants := []float64{1.0, 2.0, 3.0, 4.0}
-	variables := []float64{0.1, 0.2, 0.3, 0.4}
-
 	// x0 + ( 3 * x1 - x2 / 2 )
 	expr := genomes.NonTerminal{
 		genomes.Add,
-		genomes.Variable{&variables, 0},
+		genomes.Variable{0},
 		genomes.NonTerminal{
 			genomes.Subtract,
 			genomes.NonTerminal{
 				genomes.Multiply,
 				genomes.Primitive{constants[2]},
-				genomes.Variable{&variables, 1},
+				genomes.Variable{1},
 			},
 			genomes.NonTerminal{
 				genomes.Divide,
-				genomes.Variable{&variables, 2},
+				genomes.Variable{2},
 				genomes.Primitive{constants[1]},
 			},
 		},
 	}
-	MutateExpression := genomes.NewMutateExpression(constants, rand.New(rand.NewPCG(0, 0)))
+	MutateExpression := genomes.NewMutateExpression(constants, 4, rand.New(rand.NewPCG(0, 0)))
 
 	new_expr := MutateExpression(expr)
 
@@ -138,8 +145,8 @@ func TestMakeMutateExpression(t *testing.T) {
 }
 
 func TestExpressionCrossover(t *testing.T) {
-	expr1 := genomes.RandomFormula(20, &[]float64{1, 2, 3}, &[]float64{0.1, 0.2, 0.3}, 3, rand.New(rand.NewPCG(0, 1)))
-	expr2 := genomes.RandomFormula(20, &[]float64{1, 2, 3}, &[]float64{0.1, 0.2, 0.3}, 3, rand.New(rand.NewPCG(0, 3)))
+	expr1 := genomes.RandomFormula(20, &[]float64{0.1, 0.2, 0.3}, 3, rand.New(rand.NewPCG(0, 1)))
+	expr2 := genomes.RandomFormula(20, &[]float64{0.1, 0.2, 0.3}, 3, rand.New(rand.NewPCG(0, 3)))
 
 	c1, c2 := genomes.Crossover(expr1, expr2, rand.New(rand.NewPCG(2, 0)), 20)
 
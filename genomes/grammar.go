@@ -1,6 +1,7 @@
 package genomes
 
 import (
+	"fmt"
 	"maps"
 	"math/rand/v2"
 	"sort"
@@ -9,53 +10,61 @@ import (
 
 type Grammar struct {
 	Rules   []Rule
+	Mapping MappingMode
+	// Types optionally declares the expression type ("bool", "int", "float"
+	// or "string") each non-terminal derives
+	Types map[string]string
+	// Env optionally declares the types of the variables phenotypes use
+	Env     map[string]string
 	ruleMap map[string]*Rule
 }
 
+// MappingMode selects how codons are turned into production choices.
+type MappingMode int
+
+const (
+	// StandardMapping picks production codon % len(productions).
+	StandardMapping MappingMode = iota
+	// ProbabilisticMapping reads codons as floats in [0, 1) and picks via
+	// the cumulative production probabilities (PGE).
+	ProbabilisticMapping
+	// PositionIndependentMapping reads codon pairs: the first picks which open
+	// non-terminal to expand next, the second picks its production (πGE).
+	PositionIndependentMapping
+)
+
 type Rule struct {
 	Left        string
 	Productions []Production
 }
 
 type Production struct {
-	Elements []string
+	Elements    []string
+	Probability float64
+	Conditions  []Condition
+}
+
+func ParseMappingMode(name string) (MappingMode, error) {
+	switch name {
+	case "", "standard":
+		return StandardMapping, nil
+	case "pge", "probabilistic":
+		return ProbabilisticMapping, nil
+	case "pige", "position_independent":
+		return PositionIndependentMapping, nil
+	default:
+		return StandardMapping, fmt.Errorf("unknown mapping mode %q", name)
+	}
 }
 
 func isNonTerminal(element string) bool {
 	return len(element) > 0 && element[0] == '<' && element[len(element)-1] == '>'
 }
 
+// ValidateGrammar reports whether the grammar has no errors. Use
+// AnalyseGrammar for the full list of errors and warnings.
 func ValidateGrammar(g Grammar) bool {
-	stems := map[string]bool{}
-	nonTerminalElements := map[string]bool{}
-
-	for _, r := range g.Rules {
-		if stems[r.Left] {
-			return false
-		}
-
-		if !isNonTerminal(r.Left) {
-			return false
-		}
-
-		stems[r.Left] = true
-
-		for _, p := range r.Productions {
-			for _, e := range p.Elements {
-				if isNonTerminal(e) {
-					nonTerminalElements[e] = true
-				}
-			}
-		}
-	}
-
-	for e := range nonTerminalElements {
-		if !stems[e] {
-			return false
-		}
-	}
-
-	return true
+	return !AnalyseGrammar(g).HasErrors()
 }
 
 func (gr *Grammar) BuildRuleMap() {
@@ -80,6 +89,10 @@ func (gr Grammar) getRule(token string) *Rule {
 type GrammarNode struct {
 	token    string
 	children []*GrammarNode
+	// production is the index of the production chosen for a non-terminal
+	production int
+	// violated marks a node whose production's conditions could not be met
+	violated bool
 }
 
 func (node GrammarNode) String() string {
@@ -91,17 +104,23 @@ func (node GrammarNode) String() string {
 	var sb strings.Builder
 	sb.Grow(capacity)
 
-	for i, child := range node.children {
-		if i > 0 {
+	for _, child := range node.children {
+		s := child.String()
+		if s == "" {
+			continue
+		}
+		if sb.Len() > 0 {
 			sb.WriteByte(' ')
 		}
-		sb.WriteString(child.String())
+		sb.WriteString(s)
 	}
 	return sb.String()
 }
 
 type Genotype struct {
-	Genes      []uint8
+	Genes []uint32
+	// Width is the codon width; the zero value means 8 bits
+	Width      CodonWidth
 	Attributes map[string]any
 }
 
@@ -140,8 +159,62 @@ func (gr Grammar) getTerminatingProductionIndex(rule *Rule) int {
 	return bestIndex
 }
 
-func expand(gr Grammar, g Genotype, token string, offset *int, maxReproductions int) *GrammarNode {
-	rule := gr.getRule(token)
+type mapping struct {
+	gr               Grammar
+	g                Genotype
+	offset           int
+	maxReproductions int
+	tracing          bool
+	trace            []TraceStep
+	// forcing makes every choice a terminating one, as if codons had run out
+	forcing bool
+}
+
+func (m *mapping) nextCodon() uint32 {
+	m.offset += 1
+	return m.g.Genes[m.offset%len(m.g.Genes)]
+}
+
+func (m *mapping) exhausted() bool {
+	return m.forcing || m.offset >= m.maxReproductions
+}
+
+func (m *mapping) choose(rule *Rule) int {
+	if m.exhausted() {
+		return m.gr.getTerminatingProductionIndex(rule)
+	}
+
+	codon := m.nextCodon()
+
+	if m.gr.Mapping == ProbabilisticMapping {
+		return rule.pick(codonFraction(codon, m.g.CodonWidth()))
+	}
+	return codonChoice(codon, len(rule.Productions))
+}
+
+// record traces an expansion; before is the offset before the production
+// was chosen, so an unchanged offset means the choice was forced.
+func (m *mapping) record(rule *Rule, prodIdx, before, order int) {
+	if !m.tracing {
+		return
+	}
+	step := TraceStep{NonTerminal: rule.Left, Production: prodIdx, Codon: -1, OrderCodon: order}
+	if m.offset != before {
+		step.Codon = m.offset % len(m.g.Genes)
+		step.Value = m.g.Genes[step.Codon]
+	}
+	m.trace = append(m.trace, step)
+}
+
+func (m *mapping) run(start string) *GrammarNode {
+	if m.gr.Mapping == PositionIndependentMapping {
+		return m.expandPositionIndependent(start)
+	}
+	return m.expand(start)
+}
+
+func (m *mapping) expand(token string) *GrammarNode {
+	rule := m.gr.getRule(token)
 	if rule == nil {
 		return &GrammarNode{
 			token:    token,
@@ -149,41 +222,74 @@ func expand(gr Grammar, g Genotype, token string, offset *int, maxReproductions
 		}
 	}
 
-	var production Production
-
-	if *offset >= maxReproductions {
-		bestIdx := gr.getTerminatingProductionIndex(rule)
-		production = rule.Productions[bestIdx]
-	} else {
-		*offset += 1
-
-		geneIdx := (*offset) % len(g.Genes)
-		prodIdx := int(g.Genes[geneIdx]) % len(rule.Productions)
-
-		production = rule.Productions[prodIdx]
-	}
+	before := m.offset
+	prodIdx := m.choose(rule)
+	return m.build(rule, prodIdx, before)
+}
 
-	var children []*GrammarNode
-	for _, e := range production.Elements {
-		children = append(children, expand(gr, g, e, offset, maxReproductions))
+// build derives the elements of a chosen production. A child that breaks one
+// of the production's conditions is derived again from the following codons
+// and, if that keeps failing or codons have run out, with each of its
+// productions in turn, completed with terminating productions. Discarded
+// derivations are dropped from the trace; if none fits, or the condition ends
+// at a terminal, the node is marked violated and the tree is not Valid.
+func (m *mapping) build(rule *Rule, prodIdx, before int) *GrammarNode {
+	m.record(rule, prodIdx, before, -1)
+	production := rule.Productions[prodIdx]
+
+	violated := false
+	children := make([]*GrammarNode, 0, len(production.Elements))
+	for i, e := range production.Elements {
+		mark := len(m.trace)
+		children = append(children, m.expand(e))
+
+		childRule := m.gr.getRule(e)
+		if childRule == nil {
+			// A terminal cannot be derived again
+			if !production.satisfied(children, i) {
+				violated = true
+			}
+			continue
+		}
+		retries, forced := 0, 0
+		for !production.satisfied(children, i) {
+			if retries < maxConditionRetries && !m.exhausted() {
+				retries++
+				m.trace = m.trace[:mark]
+				children[i] = m.expand(e)
+				continue
+			}
+			if forced == len(childRule.Productions) {
+				violated = true
+				break
+			}
+			choice := (m.gr.getTerminatingProductionIndex(childRule) + forced) % len(childRule.Productions)
+			forced++
+			forcing := m.forcing
+			m.forcing = true
+			m.trace = m.trace[:mark]
+			children[i] = m.build(childRule, choice, m.offset)
+			m.forcing = forcing
+		}
 	}
 
 	return &GrammarNode{
-		token:    rule.Left,
-		children: children,
+		token:      rule.Left,
+		children:   children,
+		production: prodIdx,
+		violated:   violated,
 	}
 }
 
 func (g Genotype) MapToGrammar(gr Grammar, maxReproductions int) GrammarNode {
-	offset := -1
-	root := expand(gr, g, gr.Rules[0].Left, &offset, maxReproductions)
-	return *root
+	m := mapping{gr: gr, g: g, offset: -1, maxReproductions: maxReproductions}
+	return *m.run(gr.Rules[0].Left)
 }
 
 func cloneG(g Genotype) Genotype {
-	newGenes := make([]uint8, len(g.Genes))
+	newGenes := make([]uint32, len(g.Genes))
 	copy(newGenes, g.Genes)
-	return Genotype{Genes: newGenes}
+	return Genotype{Genes: newGenes, Width: g.Width}
 }
 
 func NewCrossoverGenotype(rng *rand.Rand) func(g1, g2 Genotype) (Genotype, Genotype) {
@@ -219,9 +325,10 @@ func (g Genotype) CrossoverGenotype(g2 Genotype, rng *rand.Rand) (Genotype, Geno
 func NewMutateGenotype(rng *rand.Rand, perGeneMutationRate float64) func(g Genotype) Genotype {
 	return func(g Genotype) Genotype {
 		clone := cloneG(g)
+		width := g.CodonWidth()
 		for i := range clone.Genes {
 			if rng.Float64() < perGeneMutationRate {
-				clone.Genes[i] = uint8(rng.IntN(256))
+				clone.Genes[i] = width.random(rng)
 			}
 		}
 		return clone
@@ -258,7 +365,11 @@ func BuildVarMapFromGrammar(gr Grammar) map[string]int {
 }
 
 func NewCreateGenotype(length int, rng *rand.Rand, options ...map[string]any) func() Genotype {
+	return NewCreateGenotypeWidth(length, Codon8, rng, options...)
+}
 
+// NewCreateGenotypeWidth creates random genotypes with codons of the given width.
+func NewCreateGenotypeWidth(length int, width CodonWidth, rng *rand.Rand, options ...map[string]any) func() Genotype {
 	var universalAttributes map[string]any
 	if len(options) > 0 {
 		universalAttributes = options[0]
@@ -271,10 +382,10 @@ func NewCreateGenotype(length int, rng *rand.Rand, options ...map[string]any) fu
 		maps.Copy(attrs, universalAttributes)
 		attrs["id"] = int(id)
 		id++
-		genes := make([]uint8, length)
+		genes := make([]uint32, length)
 		for i := range length {
-			genes[i] = uint8(rng.IntN(256))
+			genes[i] = width.random(rng)
 		}
-		return Genotype{Genes: genes, Attributes: attrs}
+		return Genotype{Genes: genes, Width: width, Attributes: attrs}
 	}
 }
@@ -10,7 +10,7 @@ func TestLectureExampleGrammarAndGenome(t *testing.T) {
 	lectureExampleGrammar := genomes.NewTestLectureExampleGrammar()
 
 	genotype := genomes.Genotype{
-		Genes: []uint8{220, 149, 147, 220, 144, 55, 36, 170},
+		Genes: []uint32{220, 149, 147, 220, 144, 55, 36, 170},
 	}
 
 	want := "a + 0.2"
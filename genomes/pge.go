@@ -0,0 +1,221 @@
+package genomes
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// codonFraction reads a codon as a float in [0, 1).
+func codonFraction(codon uint32, width CodonWidth) float64 {
+	return float64(codon) / float64(width.Values())
+}
+
+// pick returns the production whose cumulative probability interval contains r.
+// Rules without probabilities are treated as uniform.
+func (rule Rule) pick(r float64) int {
+	total := 0.0
+	for _, p := range rule.Productions {
+		total += p.Probability
+	}
+	if total <= 0 {
+		return min(int(r*float64(len(rule.Productions))), len(rule.Productions)-1)
+	}
+
+	acc := 0.0
+	for i, p := range rule.Productions {
+		acc += p.Probability / total
+		if r < acc {
+			return i
+		}
+	}
+	return len(rule.Productions) - 1
+}
+
+// NormaliseProbabilities makes every rule's production probabilities sum to 1.
+// Productions without an explicit probability share whatever is left over.
+func (gr *Grammar) NormaliseProbabilities() {
+	for i := range gr.Rules {
+		prods := gr.Rules[i].Productions
+
+		assigned := 0.0
+		unassigned := 0
+		for _, p := range prods {
+			if p.Probability > 0 {
+				assigned += p.Probability
+			} else {
+				unassigned++
+			}
+		}
+
+		if unassigned > 0 {
+			share := 0.0
+			if assigned < 1 {
+				share = (1 - assigned) / float64(unassigned)
+			}
+			for j := range prods {
+				if prods[j].Probability <= 0 {
+					prods[j].Probability = share
+				}
+			}
+			assigned += share * float64(unassigned)
+		}
+
+		if assigned <= 0 {
+			for j := range prods {
+				prods[j].Probability = 1 / float64(len(prods))
+			}
+			continue
+		}
+		for j := range prods {
+			prods[j].Probability /= assigned
+		}
+	}
+}
+
+// ProductionCounts maps the genotype and counts how often each production of
+// each rule was chosen, keyed by the rule's left-hand side.
+func (g Genotype) ProductionCounts(gr Grammar, maxReproductions int) map[string][]int {
+	_, counts := g.MapToGrammarCounts(gr, maxReproductions)
+	return counts
+}
+
+// MapToGrammarCounts maps like MapToGrammar and also returns the production
+// counts ProductionCounts would. Only the productions in the final tree
+// count, not derivations discarded for breaking conditions.
+func (g Genotype) MapToGrammarCounts(gr Grammar, maxReproductions int) (GrammarNode, map[string][]int) {
+	root := g.MapToGrammar(gr, maxReproductions)
+	counts := map[string][]int{}
+	root.Walk(func(n *GrammarNode, _ int) bool {
+		rule := gr.getRule(n.token)
+		if rule == nil || n.children == nil {
+			return false
+		}
+		if counts[rule.Left] == nil {
+			counts[rule.Left] = make([]int, len(rule.Productions))
+		}
+		counts[rule.Left][n.production]++
+		return true
+	})
+	return root, counts
+}
+
+// UpdateProbabilities moves each rule's probabilities towards the observed
+// production frequencies in counts. Rules that were never expanded are left alone.
+func (gr *Grammar) UpdateProbabilities(counts map[string][]int, learningRate float64) {
+	for i := range gr.Rules {
+		ruleCounts, ok := counts[gr.Rules[i].Left]
+		if !ok {
+			continue
+		}
+
+		total := 0
+		for _, c := range ruleCounts {
+			total += c
+		}
+		if total == 0 {
+			continue
+		}
+
+		prods := gr.Rules[i].Productions
+		for j := range prods {
+			observed := float64(ruleCounts[j]) / float64(total)
+			prods[j].Probability = (1-learningRate)*prods[j].Probability + learningRate*observed
+		}
+	}
+}
+
+// NewPGEUpdate returns a hook that, after each evaluation, updates gr's
+// probabilities from the derivations of the best `best` individuals.
+func NewPGEUpdate(gr *Grammar, learningRate float64, best, maxReproductions int) func([]Genotype, []float64) {
+	gr.NormaliseProbabilities()
+
+	return func(population []Genotype, fitnesses []float64) {
+		indices := make([]int, len(population))
+		for i := range indices {
+			indices[i] = i
+		}
+		sort.SliceStable(indices, func(a, b int) bool {
+			return fitnesses[indices[a]] > fitnesses[indices[b]]
+		})
+
+		counts := map[string][]int{}
+		for _, idx := range indices[:min(best, len(indices))] {
+			for left, c := range population[idx].ProductionCounts(*gr, maxReproductions) {
+				if counts[left] == nil {
+					counts[left] = make([]int, len(c))
+				}
+				for j := range c {
+					counts[left][j] += c[j]
+				}
+			}
+		}
+
+		gr.UpdateProbabilities(counts, learningRate)
+	}
+}
+
+// quoteElement quotes terminals that would otherwise be read back as
+// BNF syntax (spaces, '|', brackets, quotes, comments, ranges, annotations).
+func quoteElement(e string) string {
+	if isNonTerminal(e) {
+		return e
+	}
+	if e != "" && !strings.ContainsAny(e, " \t|()[]{}'\"#") && !strings.Contains(e, "..") &&
+		!strings.Contains(e, "::=") && e[0] != '@' {
+		return e
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(e) + "'"
+}
+
+// String renders the grammar back to BNF, annotating each production with
+// its probability when the grammar carries any. Type declarations come first.
+func (gr Grammar) String() string {
+	annotate := false
+	for _, r := range gr.Rules {
+		for _, p := range r.Productions {
+			if p.Probability > 0 {
+				annotate = true
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(gr.Env)) {
+		fmt.Fprintf(&sb, "%%env %s %s\n", name, gr.Env[name])
+	}
+	for _, r := range gr.Rules {
+		if t, ok := gr.Types[r.Left]; ok {
+			fmt.Fprintf(&sb, "%%type %s %s\n", r.Left, t)
+		}
+	}
+
+	for _, r := range gr.Rules {
+		sb.WriteString(r.Left)
+		sb.WriteString(" ::= ")
+		for i, p := range r.Productions {
+			if i > 0 {
+				sb.WriteString(" | ")
+			}
+			for j, e := range p.Elements {
+				if j > 0 {
+					sb.WriteByte(' ')
+				}
+				sb.WriteString(quoteElement(e))
+			}
+			if annotate {
+				sb.WriteString(" @")
+				sb.WriteString(strconv.FormatFloat(p.Probability, 'f', 4, 64))
+			}
+			for _, c := range p.Conditions {
+				sb.WriteByte(' ')
+				sb.WriteString(c.String())
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
@@ -0,0 +1,75 @@
+package genomes_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+func TestProbabilisticMapping(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	gr.Mapping = genomes.ProbabilisticMapping
+	gr.NormaliseProbabilities()
+
+	// <expr>: 0.6 -> <var> (second half), <var>: 0.1 -> <prc>, <prc>: 0.9 -> 0.5
+	genotype := genomes.Genotype{
+		Genes: []uint32{154, 26, 231},
+	}
+
+	want := "0.5"
+	got := genotype.MapToGrammar(gr, 10).String()
+
+	if got != want {
+		t.Errorf("Got unexpected string from grammar. got '%s', want '%s'", got, want)
+	}
+}
+
+func TestNormaliseProbabilities(t *testing.T) {
+	gr := genomes.Grammar{
+		Rules: []genomes.Rule{
+			{
+				Left: "<a>",
+				Productions: []genomes.Production{
+					{Elements: []string{"x"}, Probability: 0.5},
+					{Elements: []string{"y"}},
+					{Elements: []string{"z"}},
+				},
+			},
+		},
+	}
+
+	gr.NormaliseProbabilities()
+
+	want := []float64{0.5, 0.25, 0.25}
+	for i, p := range gr.Rules[0].Productions {
+		if math.Abs(p.Probability-want[i]) > 1e-9 {
+			t.Errorf("Production %d has probability %f, want %f", i, p.Probability, want[i])
+		}
+	}
+}
+
+func TestPGEUpdateMovesTowardsBest(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	gr.Mapping = genomes.ProbabilisticMapping
+	gr.BuildRuleMap()
+
+	update := genomes.NewPGEUpdate(&gr, 0.5, 1, 10)
+
+	// Best individual derives "0.5" via <expr> -> <var> -> <prc> -> 0.5
+	population := []genomes.Genotype{
+		{Genes: []uint32{154, 26, 231}},
+		{Genes: []uint32{0, 0, 0}},
+	}
+	update(population, []float64{1, 0})
+
+	got := gr.Rules[0].Productions[1].Probability
+	if math.Abs(got-0.75) > 1e-9 {
+		t.Errorf("Got <expr> -> <var> probability %f, want 0.75", got)
+	}
+
+	if !strings.Contains(gr.String(), "<expr> ::= <expr> <op> <expr> @0.2500 | <var> @0.7500") {
+		t.Errorf("Learned grammar not exported as expected:\n%s", gr.String())
+	}
+}
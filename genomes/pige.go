@@ -0,0 +1,70 @@
+package genomes
+
+import "slices"
+
+// expandPositionIndependent builds the derivation tree πGE style. Open
+// non-terminals are kept in derivation order; each expansion reads an order
+// codon to pick which one to expand and a content codon to pick its
+// production. Once maxReproductions expansions have been made the remaining
+// non-terminals are closed left-most first with their terminating productions.
+// Conditions are checked but not enforced; see CheckMapping.
+func (m *mapping) expandPositionIndependent(start string) *GrammarNode {
+	root := &GrammarNode{token: start}
+	open := []*GrammarNode{root}
+	expansions := 0
+
+	for len(open) > 0 {
+		idx, order := 0, -1
+		if expansions < m.maxReproductions {
+			idx = codonChoice(m.nextCodon(), len(open))
+			order = m.offset % len(m.g.Genes)
+		}
+		node := open[idx]
+		rule := m.gr.getRule(node.token)
+
+		var prodIdx int
+		before := m.offset
+		if expansions < m.maxReproductions {
+			prodIdx = codonChoice(m.nextCodon(), len(rule.Productions))
+		} else {
+			prodIdx = m.gr.getTerminatingProductionIndex(rule)
+		}
+		expansions++
+		m.record(rule, prodIdx, before, order)
+
+		production := rule.Productions[prodIdx]
+		node.production = prodIdx
+		node.children = make([]*GrammarNode, 0, len(production.Elements))
+
+		var opened []*GrammarNode
+		for _, e := range production.Elements {
+			child := &GrammarNode{token: e}
+			node.children = append(node.children, child)
+			if m.gr.getRule(e) != nil {
+				opened = append(opened, child)
+			}
+		}
+
+		open = slices.Replace(open, idx, idx+1, opened...)
+	}
+
+	m.markViolations(root)
+	return root
+}
+
+// markViolations flags nodes whose children break their production's
+// conditions. πGE expands siblings in any order, so it cannot redraw them as
+// build does; the tree is only reported as not Valid.
+func (m *mapping) markViolations(node *GrammarNode) {
+	rule := m.gr.getRule(node.token)
+	if rule == nil {
+		return
+	}
+	production := rule.Productions[node.production]
+	for i, child := range node.children {
+		m.markViolations(child)
+		if !production.satisfied(node.children[:i+1], i) {
+			node.violated = true
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package genomes_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+func TestPositionIndependentMapping(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	gr.Mapping = genomes.PositionIndependentMapping
+
+	// Codon pairs (order, content): the right-hand <expr> is built first
+	genotype := genomes.Genotype{
+		Genes: []uint32{0, 0, 2, 1, 2, 1, 2, 0, 1, 0, 0, 1, 0, 0, 0, 2},
+	}
+
+	want := "0.2 + a"
+	got := genotype.MapToGrammar(gr, 20).String()
+
+	if got != want {
+		t.Errorf("Got unexpected string from grammar. got '%s', want '%s'", got, want)
+	}
+}
+
+func TestPositionIndependentMappingTerminates(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	gr.Mapping = genomes.PositionIndependentMapping
+
+	// Always picks the recursive production until reproductions run out
+	genotype := genomes.Genotype{Genes: []uint32{0}}
+
+	got := genotype.MapToGrammar(gr, 5).String()
+	if got == "" || strings.Contains(got, "<") {
+		t.Errorf("Expected a complete phenotype after running out of reproductions, got '%s'", got)
+	}
+}
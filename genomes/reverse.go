@@ -0,0 +1,383 @@
+package genomes
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"unicode"
+)
+
+type earleyItem struct {
+	rule   int
+	prod   int
+	dot    int
+	origin int
+}
+
+// earley is a character-level Earley parser over a Grammar. Terminals match
+// literally and may be preceded by any amount of whitespace, so phenotypes
+// don't have to use the single-space layout that mapping produces.
+type earley struct {
+	gr    Grammar
+	rules map[string]int
+	text  string
+	chart []map[earleyItem]bool
+	order [][]earleyItem
+	// completed[end][left] lists the origins of completed items for left
+	completed []map[string]map[int][]int
+	failed    map[[3]int]bool
+	visiting  map[[3]int]bool
+}
+
+func (p *earley) skipSpace(i int) int {
+	for i < len(p.text) && unicode.IsSpace(rune(p.text[i])) {
+		i++
+	}
+	return i
+}
+
+// matchTerminal reports whether terminal starts at i. A terminal ending in an
+// identifier character can't be followed by another one, so x doesn't match
+// the start of x1.
+func (p *earley) matchTerminal(terminal string, i int) bool {
+	if !strings.HasPrefix(p.text[i:], terminal) {
+		return false
+	}
+	end := i + len(terminal)
+	return terminal == "" || end == len(p.text) ||
+		!isIdentByte(terminal[len(terminal)-1]) || !isIdentByte(p.text[end])
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func (p *earley) add(pos int, it earleyItem) {
+	if p.chart[pos][it] {
+		return
+	}
+	p.chart[pos][it] = true
+	p.order[pos] = append(p.order[pos], it)
+}
+
+func (p *earley) recognise() {
+	n := len(p.text)
+	p.chart = make([]map[earleyItem]bool, n+1)
+	p.order = make([][]earleyItem, n+1)
+	p.completed = make([]map[string]map[int][]int, n+1)
+	for i := range p.chart {
+		p.chart[i] = map[earleyItem]bool{}
+		p.completed[i] = map[string]map[int][]int{}
+	}
+
+	for j := range p.gr.Rules[0].Productions {
+		p.add(0, earleyItem{rule: 0, prod: j, origin: 0})
+	}
+
+	for i := 0; i <= n; i++ {
+		// Non-terminals completed without consuming input at i, so items
+		// predicted after the completion can still advance over them.
+		nullable := map[string]bool{}
+
+		for k := 0; k < len(p.order[i]); k++ {
+			it := p.order[i][k]
+			rule := p.gr.Rules[it.rule]
+			elements := rule.Productions[it.prod].Elements
+
+			if it.dot == len(elements) {
+				if p.completed[i][rule.Left] == nil {
+					p.completed[i][rule.Left] = map[int][]int{}
+				}
+				p.completed[i][rule.Left][it.origin] = append(p.completed[i][rule.Left][it.origin], it.prod)
+				if it.origin == i {
+					nullable[rule.Left] = true
+				}
+				for _, parent := range p.order[it.origin] {
+					pe := p.gr.Rules[parent.rule].Productions[parent.prod].Elements
+					if parent.dot < len(pe) && pe[parent.dot] == rule.Left {
+						p.add(i, earleyItem{parent.rule, parent.prod, parent.dot + 1, parent.origin})
+					}
+				}
+				continue
+			}
+
+			next := elements[it.dot]
+			if ruleIdx, ok := p.rules[next]; ok {
+				for j := range p.gr.Rules[ruleIdx].Productions {
+					p.add(i, earleyItem{rule: ruleIdx, prod: j, origin: i})
+				}
+				if nullable[next] {
+					p.add(i, earleyItem{it.rule, it.prod, it.dot + 1, it.origin})
+				}
+				continue
+			}
+
+			start := p.skipSpace(i)
+			if p.matchTerminal(next, start) {
+				p.add(start+len(next), earleyItem{it.rule, it.prod, it.dot + 1, it.origin})
+			}
+		}
+	}
+}
+
+// tree rebuilds a derivation of left spanning [from, to).
+func (p *earley) tree(left string, from, to int) *GrammarNode {
+	key := [3]int{p.rules[left], from, to}
+	if p.failed[key] || p.visiting[key] {
+		return nil
+	}
+	p.visiting[key] = true
+	defer delete(p.visiting, key)
+
+	for _, prod := range p.completed[to][left][from] {
+		elements := p.gr.Rules[p.rules[left]].Productions[prod].Elements
+		if children := p.children(elements, from, to); children != nil {
+			return &GrammarNode{token: left, children: children, production: prod}
+		}
+	}
+
+	p.failed[key] = true
+	return nil
+}
+
+// children matches elements against [from, to), returning nil if they can't span it.
+func (p *earley) children(elements []string, from, to int) []*GrammarNode {
+	if len(elements) == 0 {
+		if from == to {
+			return []*GrammarNode{}
+		}
+		return nil
+	}
+
+	e := elements[0]
+	if _, ok := p.rules[e]; !ok {
+		start := p.skipSpace(from)
+		if !p.matchTerminal(e, start) || start+len(e) > to {
+			return nil
+		}
+		rest := p.children(elements[1:], start+len(e), to)
+		if rest == nil {
+			return nil
+		}
+		return append([]*GrammarNode{{token: e}}, rest...)
+	}
+
+	for mid := from; mid <= to; mid++ {
+		if _, ok := p.completed[mid][e][from]; !ok {
+			continue
+		}
+		rest := p.children(elements[1:], mid, to)
+		if rest == nil {
+			continue
+		}
+		if child := p.tree(e, from, mid); child != nil {
+			return append([]*GrammarNode{child}, rest...)
+		}
+	}
+	return nil
+}
+
+// ParsePhenotype recovers a derivation tree for phenotype, starting from the
+// grammar's first rule. When the phenotype is ambiguous the first derivation
+// found is returned.
+func ParsePhenotype(gr Grammar, phenotype string) (*GrammarNode, error) {
+	if len(gr.Rules) == 0 {
+		return nil, fmt.Errorf("grammar has no rules")
+	}
+
+	p := &earley{
+		gr:       gr,
+		rules:    make(map[string]int, len(gr.Rules)),
+		text:     phenotype,
+		failed:   map[[3]int]bool{},
+		visiting: map[[3]int]bool{},
+	}
+	for i := range gr.Rules {
+		if _, ok := p.rules[gr.Rules[i].Left]; !ok {
+			p.rules[gr.Rules[i].Left] = i
+		}
+	}
+
+	p.recognise()
+
+	start := gr.Rules[0].Left
+	for end := len(phenotype); end >= 0; end-- {
+		if p.skipSpace(end) != len(phenotype) {
+			break
+		}
+		if _, ok := p.completed[end][start][0]; !ok {
+			continue
+		}
+		if root := p.tree(start, 0, end); root != nil {
+			return root, nil
+		}
+	}
+
+	// Report how far the parse got for a useful error.
+	furthest := 0
+	for i := range p.order {
+		if len(p.order[i]) > 0 {
+			furthest = i
+		}
+	}
+	return nil, fmt.Errorf("phenotype is not derivable from the grammar: parse fails after %q", phenotype[:furthest])
+}
+
+// Encode turns a derivation tree into codons that map back to it under the
+// grammar's mapping mode. Each choice is given a random degenerate codon, and
+// the genotype is padded to length with random codons. Past maxReproductions
+// the mappers stop reading codons and close the tree with terminating
+// productions, so the tree must do the same.
+func (node GrammarNode) Encode(gr Grammar, length int, width CodonWidth, maxReproductions int, rng *rand.Rand) (Genotype, error) {
+	var genes []uint32
+	expansions := 0
+
+	codonFor := func(rule *Rule, prod int) (uint32, error) {
+		if gr.Mapping == ProbabilisticMapping {
+			return probabilisticCodon(rule, prod, width, rng)
+		}
+		return degenerate(prod, len(rule.Productions), width, rng)
+	}
+
+	// Both depth-first mappers and πGE (always expanding the left-most open
+	// non-terminal) visit non-terminals in pre-order.
+	open := 1
+	var visit func(n *GrammarNode) error
+	visit = func(n *GrammarNode) error {
+		rule := gr.getRule(n.token)
+		if rule == nil {
+			return nil
+		}
+
+		production := rule.Productions[n.production]
+		for i := range n.children {
+			if !production.satisfied(n.children[:i+1], i) {
+				return fmt.Errorf("%s breaks a condition of %s", n.String(), rule.Left)
+			}
+		}
+
+		var budgeted bool
+		if gr.Mapping == PositionIndependentMapping {
+			budgeted = expansions < maxReproductions
+		} else {
+			// mapping.choose reads a codon while offset < maxReproductions
+			budgeted = len(genes) <= maxReproductions
+		}
+		expansions++
+
+		if !budgeted {
+			if n.production != gr.getTerminatingProductionIndex(rule) {
+				return fmt.Errorf("derivation needs more than %d expansions", maxReproductions)
+			}
+		} else {
+			if gr.Mapping == PositionIndependentMapping {
+				order, err := degenerate(0, open, width, rng)
+				if err != nil {
+					return err
+				}
+				genes = append(genes, order)
+			}
+
+			codon, err := codonFor(rule, n.production)
+			if err != nil {
+				return err
+			}
+			genes = append(genes, codon)
+		}
+
+		open--
+		for _, c := range n.children {
+			if gr.getRule(c.token) != nil {
+				open++
+			}
+		}
+
+		for _, c := range n.children {
+			if err := visit(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := visit(&node); err != nil {
+		return Genotype{}, err
+	}
+	if len(genes) > length {
+		return Genotype{}, fmt.Errorf("derivation needs %d codons but the genotype length is %d", len(genes), length)
+	}
+
+	for len(genes) < length {
+		genes = append(genes, width.random(rng))
+	}
+
+	return Genotype{Genes: genes, Width: width}, nil
+}
+
+// degenerate picks a random codon c with c % n == choice.
+func degenerate(choice, n int, width CodonWidth, rng *rand.Rand) (uint32, error) {
+	values := width.Values()
+	if uint64(choice) >= values {
+		return 0, fmt.Errorf("choice %d is out of the %d-bit codon range", choice, width)
+	}
+	k := rng.Uint64N((values-1-uint64(choice))/uint64(n) + 1)
+	return uint32(uint64(choice) + k*uint64(n)), nil
+}
+
+// probabilisticCodon picks a random codon that PGE maps to prod. pick is
+// monotonic in the codon, so the codons choosing prod form one interval.
+func probabilisticCodon(rule *Rule, prod int, width CodonWidth, rng *rand.Rand) (uint32, error) {
+	// Search in uint64, as 2^32 codons overflow a 32-bit int
+	first := func(p int) uint64 {
+		lo, hi := uint64(0), width.Values()
+		for lo < hi {
+			mid := lo + (hi-lo)/2
+			if rule.pick(codonFraction(uint32(mid), width)) >= p {
+				hi = mid
+			} else {
+				lo = mid + 1
+			}
+		}
+		return lo
+	}
+
+	lo, hi := first(prod), first(prod+1)
+	if lo >= hi {
+		return 0, fmt.Errorf("%s production %d has too low a probability to be chosen", rule.Left, prod)
+	}
+	return uint32(lo + rng.Uint64N(hi-lo)), nil
+}
+
+// GenotypeFromPhenotype parses a phenotype and encodes its derivation, so
+// hand-written programs can seed a population.
+func GenotypeFromPhenotype(gr Grammar, phenotype string, length int, width CodonWidth, maxReproductions int, rng *rand.Rand) (Genotype, error) {
+	tree, err := ParsePhenotype(gr, phenotype)
+	if err != nil {
+		return Genotype{}, err
+	}
+
+	g, err := tree.Encode(gr, length, width, maxReproductions, rng)
+	if err != nil {
+		return Genotype{}, err
+	}
+
+	if got, want := g.MapToGrammar(gr, maxReproductions).String(), tree.String(); got != want {
+		return Genotype{}, fmt.Errorf("encoded genotype maps to %q, want %q", got, want)
+	}
+	return g, nil
+}
+
+// NewSeededCreateGenotype hands out the seeds first and then falls back to
+// create. Seeds get create's attributes so ids stay unique.
+func NewSeededCreateGenotype(seeds []Genotype, create func() Genotype) func() Genotype {
+	next := 0
+	return func() Genotype {
+		g := create()
+		if next < len(seeds) {
+			seed := cloneG(seeds[next])
+			g.Genes, g.Width = seed.Genes, seed.Width
+			next++
+		}
+		return g
+	}
+}
@@ -0,0 +1,136 @@
+package genomes_test
+
+import (
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+func TestGenotypeFromPhenotype(t *testing.T) {
+	phenotypes := []string{
+		"a",
+		"0.2 + a",
+		"a * b - 0.5 / a",
+		"b-0.0*  0.3",
+	}
+	modes := []genomes.MappingMode{
+		genomes.StandardMapping,
+		genomes.ProbabilisticMapping,
+		genomes.PositionIndependentMapping,
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, mode := range modes {
+		gr := genomes.NewTestLectureExampleGrammar()
+		gr.Mapping = mode
+		gr.NormaliseProbabilities()
+
+		for _, phenotype := range phenotypes {
+			tree, err := genomes.ParsePhenotype(gr, phenotype)
+			if err != nil {
+				t.Fatalf("mode %d: ParsePhenotype(%q): %v", mode, phenotype, err)
+			}
+
+			g, err := genomes.GenotypeFromPhenotype(gr, phenotype, 50, genomes.Codon8, 20, rng)
+			if err != nil {
+				t.Fatalf("mode %d: GenotypeFromPhenotype(%q): %v", mode, phenotype, err)
+			}
+			if len(g.Genes) != 50 {
+				t.Errorf("mode %d: expected 50 codons, got %d", mode, len(g.Genes))
+			}
+
+			got := g.MapToGrammar(gr, 20).String()
+			if got != tree.String() {
+				t.Errorf("mode %d: %q encoded to a genotype mapping to %q", mode, phenotype, got)
+			}
+		}
+	}
+}
+
+func TestGenotypeFromPhenotypeRoundTrip(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	rng := rand.New(rand.NewPCG(3, 4))
+	create := genomes.NewCreateGenotype(30, rng)
+
+	// The reverse mapping gets a bigger budget: the grammar is ambiguous, so
+	// the recovered derivation may close the tree in a different order.
+	for range 50 {
+		phenotype := create().MapToGrammar(gr, 10).String()
+
+		g, err := genomes.GenotypeFromPhenotype(gr, phenotype, 100, genomes.Codon8, 100, rng)
+		if err != nil {
+			t.Fatalf("GenotypeFromPhenotype(%q): %v", phenotype, err)
+		}
+		if got := g.MapToGrammar(gr, 100).String(); got != phenotype {
+			t.Errorf("Round trip changed phenotype: got %q, want %q", got, phenotype)
+		}
+	}
+}
+
+func TestParsePhenotypeErrors(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+
+	for _, phenotype := range []string{"", "a +", "c", "a + + b"} {
+		if _, err := genomes.ParsePhenotype(gr, phenotype); err == nil {
+			t.Errorf("Expected %q not to parse", phenotype)
+		}
+	}
+}
+
+func TestParsePhenotypeTokenBoundaries(t *testing.T) {
+	gr := genomes.Grammar{
+		Rules: []genomes.Rule{
+			{Left: "<e>", Productions: []genomes.Production{{Elements: []string{"<v>", "<n>"}}}},
+			{Left: "<v>", Productions: []genomes.Production{{Elements: []string{"x"}}, {Elements: []string{"x1"}}}},
+			{Left: "<n>", Productions: []genomes.Production{{Elements: []string{"1"}}, {Elements: []string{"2"}}}},
+		},
+	}
+
+	for _, phenotype := range []string{"x 1", "x1 2"} {
+		tree, err := genomes.ParsePhenotype(gr, phenotype)
+		if err != nil {
+			t.Errorf("ParsePhenotype(%q): %v", phenotype, err)
+		} else if tree.String() != phenotype {
+			t.Errorf("ParsePhenotype(%q) gave %q", phenotype, tree.String())
+		}
+	}
+	// x can't match the start of x1, nor x1 the start of x12
+	for _, phenotype := range []string{"x1", "x12"} {
+		if _, err := genomes.ParsePhenotype(gr, phenotype); err == nil {
+			t.Errorf("Expected %q not to parse", phenotype)
+		}
+	}
+}
+
+func TestGenotypeFromPhenotypeTooLong(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	rng := rand.New(rand.NewPCG(5, 6))
+
+	if _, err := genomes.GenotypeFromPhenotype(gr, "a + a + a + a", 50, genomes.Codon8, 3, rng); err == nil {
+		t.Error("Expected an error when the derivation needs more expansions than allowed")
+	}
+	if _, err := genomes.GenotypeFromPhenotype(gr, "a + a + a + a", 4, genomes.Codon8, 20, rng); err == nil {
+		t.Error("Expected an error when the derivation needs more codons than the genotype holds")
+	}
+}
+
+func TestSeededCreateGenotype(t *testing.T) {
+	rng := rand.New(rand.NewPCG(7, 8))
+	seeds := []genomes.Genotype{{Genes: []uint32{1, 2, 3}}}
+	create := genomes.NewSeededCreateGenotype(seeds, genomes.NewCreateGenotype(3, rng))
+
+	first, second := create(), create()
+	if !slices.Equal(first.Genes, seeds[0].Genes) {
+		t.Errorf("Expected the seed first, got %v", first.Genes)
+	}
+	if first.Attributes["id"] == second.Attributes["id"] {
+		t.Error("Expected seeded and created genotypes to get distinct ids")
+	}
+
+	first.Genes[0] = 9
+	if seeds[0].Genes[0] != 1 {
+		t.Error("Expected the seed to be copied, not shared")
+	}
+}
@@ -0,0 +1,165 @@
+package genomes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func (node GrammarNode) Token() string {
+	return node.token
+}
+
+func (node GrammarNode) Children() []*GrammarNode {
+	return node.children
+}
+
+func (node GrammarNode) IsTerminal() bool {
+	return node.children == nil
+}
+
+// Production is the index of the production that expanded the node, or -1
+// for terminals.
+func (node GrammarNode) Production() int {
+	if node.IsTerminal() {
+		return -1
+	}
+	return node.production
+}
+
+// Walk visits the tree in pre-order. Returning false from visit skips the
+// node's children.
+func (node *GrammarNode) Walk(visit func(n *GrammarNode, depth int) bool) {
+	node.walk(visit, 0)
+}
+
+func (node *GrammarNode) walk(visit func(n *GrammarNode, depth int) bool, depth int) {
+	if !visit(node, depth) {
+		return
+	}
+	for _, child := range node.children {
+		child.walk(visit, depth+1)
+	}
+}
+
+// Valid reports whether every production's conditions were met when the
+// tree was mapped. Fitness functions should score invalid trees -Inf.
+func (node GrammarNode) Valid() bool {
+	valid := true
+	node.Walk(func(n *GrammarNode, _ int) bool {
+		valid = valid && !n.violated
+		return valid
+	})
+	return valid
+}
+
+// Depth is the number of nodes on the longest path from the root to a leaf.
+func (node GrammarNode) Depth() int {
+	depth := 0
+	node.Walk(func(_ *GrammarNode, d int) bool {
+		depth = max(depth, d+1)
+		return true
+	})
+	return depth
+}
+
+// Size is the number of nodes in the tree.
+func (node GrammarNode) Size() int {
+	size := 0
+	node.Walk(func(*GrammarNode, int) bool {
+		size++
+		return true
+	})
+	return size
+}
+
+// NewDerivationSize and NewDerivationDepth measure a genotype by its
+// derivation tree, for bloat control.
+func NewDerivationSize(gr Grammar, maxReproductions int) func(g Genotype) int {
+	return func(g Genotype) int {
+		return g.MapToGrammar(gr, maxReproductions).Size()
+	}
+}
+
+func NewDerivationDepth(gr Grammar, maxReproductions int) func(g Genotype) int {
+	return func(g Genotype) int {
+		return g.MapToGrammar(gr, maxReproductions).Depth()
+	}
+}
+
+type jsonNode struct {
+	Token      string         `json:"token"`
+	Production *int           `json:"production,omitempty"`
+	Children   []*GrammarNode `json:"children,omitempty"`
+}
+
+// MarshalJSON writes terminals as {"token": ...} and non-terminals with the
+// production that expanded them and their children.
+func (node GrammarNode) MarshalJSON() ([]byte, error) {
+	j := jsonNode{Token: node.token}
+	if !node.IsTerminal() {
+		production := node.production
+		j.Production = &production
+		j.Children = node.children
+	}
+
+	// Non-terminals are all angle brackets, so don't HTML-escape them.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(j); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// DOT renders the tree as a Graphviz digraph, with terminals drawn as boxes.
+func (node GrammarNode) DOT() string {
+	var sb strings.Builder
+	sb.WriteString("digraph derivation {\n")
+
+	id := -1
+	var parents []int
+	node.Walk(func(n *GrammarNode, depth int) bool {
+		id++
+
+		shape := "ellipse"
+		if n.IsTerminal() {
+			shape = "box"
+		}
+		fmt.Fprintf(&sb, "  n%d [label=%s, shape=%s];\n", id, strconv.Quote(n.token), shape)
+
+		parents = append(parents[:depth], id)
+		if depth > 0 {
+			fmt.Fprintf(&sb, "  n%d -> n%d;\n", parents[depth-1], id)
+		}
+		return true
+	})
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// TraceStep records one expansion made while mapping a genotype.
+type TraceStep struct {
+	NonTerminal string
+	Production  int
+	// Codon is the position in Genes of the codon that chose the production,
+	// or -1 when max reproductions ran out and a terminating production was
+	// forced.
+	Codon int
+	Value uint32
+	// OrderCodon is the position of the πGE codon that chose which open
+	// non-terminal to expand, or -1.
+	OrderCodon int
+}
+
+// MapToGrammarTrace maps like MapToGrammar and also returns every expansion
+// in the order it was made.
+func (g Genotype) MapToGrammarTrace(gr Grammar, maxReproductions int) (GrammarNode, []TraceStep) {
+	m := mapping{gr: gr, g: g, offset: -1, maxReproductions: maxReproductions, tracing: true}
+	root := m.run(gr.Rules[0].Left)
+	return *root, m.trace
+}
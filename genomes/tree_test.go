@@ -0,0 +1,101 @@
+package genomes_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+func TestTreeInspection(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	// <expr> -> <expr> <op> <expr>, a, +, 0.2
+	tree := genomes.Genotype{Genes: []uint32{0, 1, 1, 0, 0, 1, 0, 2}}.MapToGrammar(gr, 20)
+
+	if tree.String() != "a + 0.2" {
+		t.Fatalf("unexpected phenotype %q", tree.String())
+	}
+	if tree.Token() != "<expr>" || tree.Production() != 0 || tree.IsTerminal() {
+		t.Errorf("unexpected root %s (production %d)", tree.Token(), tree.Production())
+	}
+	if got := len(tree.Children()); got != 3 {
+		t.Errorf("Expected 3 children, got %d", got)
+	}
+	if got := tree.Depth(); got != 5 {
+		t.Errorf("Expected depth 5, got %d", got)
+	}
+	if got := tree.Size(); got != 11 {
+		t.Errorf("Expected size 11, got %d", got)
+	}
+
+	g := genomes.Genotype{Genes: []uint32{0, 1, 1, 0, 0, 1, 0, 2}}
+	if size, depth := genomes.NewDerivationSize(gr, 20)(g), genomes.NewDerivationDepth(gr, 20)(g); size != 11 || depth != 5 {
+		t.Errorf("Expected derivation size 11 and depth 5, got %d and %d", size, depth)
+	}
+
+	var leaves []string
+	tree.Walk(func(n *genomes.GrammarNode, depth int) bool {
+		if n.IsTerminal() {
+			if n.Production() != -1 {
+				t.Errorf("Expected terminal %s to have production -1", n.Token())
+			}
+			leaves = append(leaves, n.Token())
+		}
+		return n.Token() != "<op>"
+	})
+	if got := strings.Join(leaves, " "); got != "a 0.2" {
+		t.Errorf("Expected Walk to skip the <op> subtree, got leaves %q", got)
+	}
+}
+
+func TestTreeExport(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	tree := genomes.Genotype{Genes: []uint32{1, 1, 0}}.MapToGrammar(gr, 20)
+
+	var out strings.Builder
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(tree); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"token":"<expr>","production":1,"children":[{"token":"<var>","production":1,"children":[{"token":"<input>","production":0,"children":[{"token":"a"}]}]}]}` + "\n"
+	if out.String() != want {
+		t.Errorf("Unexpected JSON:\n got %s\nwant %s", out.String(), want)
+	}
+
+	dot := tree.DOT()
+	for _, line := range []string{`n0 [label="<expr>", shape=ellipse];`, `n3 [label="a", shape=box];`, `n2 -> n3;`} {
+		if !strings.Contains(dot, line) {
+			t.Errorf("Expected DOT output to contain %q:\n%s", line, dot)
+		}
+	}
+}
+
+func TestMapToGrammarTrace(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	g := genomes.Genotype{Genes: []uint32{0, 1, 1, 0, 0, 1, 0, 2}}
+
+	tree, trace := g.MapToGrammarTrace(gr, 20)
+	if tree.String() != g.MapToGrammar(gr, 20).String() {
+		t.Errorf("Trace mapping disagrees with MapToGrammar")
+	}
+	if len(trace) != 8 {
+		t.Fatalf("Expected 8 steps, got %d", len(trace))
+	}
+	if s := trace[4]; s.NonTerminal != "<op>" || s.Production != 0 || s.Codon != 4 || s.Value != 0 || s.OrderCodon != -1 {
+		t.Errorf("Unexpected step %+v", s)
+	}
+
+	// Out of reproductions: every remaining choice is forced
+	_, trace = genomes.Genotype{Genes: []uint32{0}}.MapToGrammarTrace(gr, 3)
+	if last := trace[len(trace)-1]; last.Codon != -1 {
+		t.Errorf("Expected the last step to be forced, got %+v", last)
+	}
+
+	gr.Mapping = genomes.PositionIndependentMapping
+	_, trace = genomes.Genotype{Genes: []uint32{0, 1, 0, 1, 0, 0}}.MapToGrammarTrace(gr, 20)
+	if s := trace[1]; s.NonTerminal != "<var>" || s.OrderCodon != 2 || s.Codon != 3 {
+		t.Errorf("Unexpected πGE step %+v", s)
+	}
+}
@@ -0,0 +1,153 @@
+package genomes
+
+import (
+	"math/rand/v2"
+	"slices"
+)
+
+// maxCrossoverAttempts bounds how often cut points are redrawn to keep both
+// children within the length bounds before the parents are returned as is.
+const maxCrossoverAttempts = 10
+
+// LengthBounds limits genome length under the variable-length operators. A
+// zero Max means unbounded.
+type LengthBounds struct {
+	Min, Max int
+}
+
+func (b LengthBounds) allows(length int) bool {
+	return length >= max(b.Min, 1) && (b.Max == 0 || length <= b.Max)
+}
+
+func NewTwoPointCrossoverGenotype(rng *rand.Rand, bounds LengthBounds) func(g1, g2 Genotype) (Genotype, Genotype) {
+	return func(g1, g2 Genotype) (Genotype, Genotype) {
+		return g1.TwoPointCrossoverGenotype(g2, rng, bounds)
+	}
+}
+
+// TwoPointCrossoverGenotype swaps a segment of each parent, with cut points
+// drawn independently per parent so the children's lengths can differ from
+// both parents'.
+func (g Genotype) TwoPointCrossoverGenotype(g2 Genotype, rng *rand.Rand, bounds LengthBounds) (Genotype, Genotype) {
+	if len(g.Genes) == 0 || len(g2.Genes) == 0 {
+		return cloneG(g), cloneG(g2)
+	}
+
+	for range maxCrossoverAttempts {
+		a1, b1 := cutPoints(len(g.Genes), rng)
+		a2, b2 := cutPoints(len(g2.Genes), rng)
+
+		len1 := a1 + (b2 - a2) + len(g.Genes) - b1
+		len2 := a2 + (b1 - a1) + len(g2.Genes) - b2
+		if !bounds.allows(len1) || !bounds.allows(len2) {
+			continue
+		}
+
+		c1 := slices.Concat(g.Genes[:a1], g2.Genes[a2:b2], g.Genes[b1:])
+		c2 := slices.Concat(g2.Genes[:a2], g.Genes[a1:b1], g2.Genes[b2:])
+		return Genotype{Genes: c1, Width: g.Width}, Genotype{Genes: c2, Width: g.Width}
+	}
+
+	return cloneG(g), cloneG(g2)
+}
+
+// cutPoints returns a <= b within [0, n].
+func cutPoints(n int, rng *rand.Rand) (int, int) {
+	a, b := rng.IntN(n+1), rng.IntN(n+1)
+	if a > b {
+		a, b = b, a
+	}
+	return a, b
+}
+
+// LengthMutationRates are the per-genome probabilities of each structural
+// mutation.
+type LengthMutationRates struct {
+	Duplication float64
+	Insertion   float64
+	Deletion    float64
+}
+
+// NewVariableLengthMutateGenotype applies per-gene point mutation followed by
+// codon duplication, insertion and deletion, each kept within bounds.
+func NewVariableLengthMutateGenotype(rng *rand.Rand, perGeneMutationRate float64, rates LengthMutationRates, bounds LengthBounds) func(g Genotype) Genotype {
+	point := NewMutateGenotype(rng, perGeneMutationRate)
+	return func(g Genotype) Genotype {
+		clone := point(g)
+		if rng.Float64() < rates.Duplication {
+			clone = clone.DuplicateCodons(rng, bounds)
+		}
+		if rng.Float64() < rates.Insertion {
+			clone = clone.InsertCodon(rng, bounds)
+		}
+		if rng.Float64() < rates.Deletion {
+			clone = clone.DeleteCodons(rng, bounds)
+		}
+		return clone
+	}
+}
+
+// DuplicateCodons copies a random run of codons, no longer than the bounds
+// allow, and inserts it at a random position.
+func (g Genotype) DuplicateCodons(rng *rand.Rand, bounds LengthBounds) Genotype {
+	room := len(g.Genes)
+	if bounds.Max > 0 {
+		room = min(room, bounds.Max-len(g.Genes))
+	}
+	if room <= 0 {
+		return g
+	}
+	start := rng.IntN(len(g.Genes))
+	end := start + 1 + rng.IntN(min(room, len(g.Genes)-start))
+
+	segment := slices.Clone(g.Genes[start:end])
+	at := rng.IntN(len(g.Genes) + 1)
+	g.Genes = slices.Insert(slices.Clone(g.Genes), at, segment...)
+	return g
+}
+
+// InsertCodon inserts one random codon at a random position.
+func (g Genotype) InsertCodon(rng *rand.Rand, bounds LengthBounds) Genotype {
+	if !bounds.allows(len(g.Genes) + 1) {
+		return g
+	}
+	at := rng.IntN(len(g.Genes) + 1)
+	g.Genes = slices.Insert(slices.Clone(g.Genes), at, g.CodonWidth().random(rng))
+	return g
+}
+
+// DeleteCodons removes a random run of up to a tenth of the codons, no longer
+// than the bounds allow.
+func (g Genotype) DeleteCodons(rng *rand.Rand, bounds LengthBounds) Genotype {
+	longest := len(g.Genes) - max(bounds.Min, 1)
+	if longest <= 0 {
+		return g
+	}
+	n := 1 + rng.IntN(min(longest, max(len(g.Genes)/10, 1)))
+	start := rng.IntN(len(g.Genes) - n + 1)
+	g.Genes = slices.Delete(slices.Clone(g.Genes), start, start+n)
+	return g
+}
+
+// LengthStats summarises the genome lengths of a generation.
+type LengthStats struct {
+	Min  int
+	Max  int
+	Mean float64
+}
+
+func NewLengthStats(genotypes []Genotype) LengthStats {
+	if len(genotypes) == 0 {
+		return LengthStats{}
+	}
+
+	stats := LengthStats{Min: len(genotypes[0].Genes), Max: len(genotypes[0].Genes)}
+	total := 0
+	for _, g := range genotypes {
+		stats.Min = min(stats.Min, len(g.Genes))
+		stats.Max = max(stats.Max, len(g.Genes))
+		total += len(g.Genes)
+	}
+	stats.Mean = float64(total) / float64(len(genotypes))
+	return stats
+}
@@ -0,0 +1,99 @@
+package genomes_test
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+func seq(from, n int) []uint32 {
+	genes := make([]uint32, n)
+	for i := range genes {
+		genes[i] = uint32(from + i)
+	}
+	return genes
+}
+
+func TestTwoPointCrossoverGenotype(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	p1 := genomes.Genotype{Genes: seq(0, 10)}
+	p2 := genomes.Genotype{Genes: seq(100, 30)}
+	bounds := genomes.LengthBounds{Min: 5, Max: 35}
+
+	lengths := map[int]bool{}
+	for range 200 {
+		c1, c2 := p1.TwoPointCrossoverGenotype(p2, rng, bounds)
+
+		if len(c1.Genes)+len(c2.Genes) != 40 {
+			t.Fatalf("Crossover lost codons: %d + %d", len(c1.Genes), len(c2.Genes))
+		}
+		for _, c := range []genomes.Genotype{c1, c2} {
+			if len(c.Genes) < bounds.Min || len(c.Genes) > bounds.Max {
+				t.Fatalf("Child length %d outside bounds %+v", len(c.Genes), bounds)
+			}
+		}
+		lengths[len(c1.Genes)] = true
+	}
+	if len(lengths) < 5 {
+		t.Errorf("Expected child lengths to vary, got %v", lengths)
+	}
+
+	if p1.Genes[0] != 0 || len(p1.Genes) != 10 {
+		t.Errorf("Crossover modified its parent: %v", p1.Genes)
+	}
+}
+
+func TestLengthMutations(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	g := genomes.Genotype{Genes: seq(0, 20)}
+	bounds := genomes.LengthBounds{Min: 18, Max: 25}
+
+	for range 100 {
+		if d := g.DuplicateCodons(rng, bounds); len(d.Genes) < 21 || len(d.Genes) > 25 {
+			t.Fatalf("Duplication gave length %d", len(d.Genes))
+		}
+		if i := g.InsertCodon(rng, bounds); len(i.Genes) != 21 {
+			t.Fatalf("Insertion gave length %d", len(i.Genes))
+		}
+		if d := g.DeleteCodons(rng, bounds); len(d.Genes) < 18 || len(d.Genes) > 19 {
+			t.Fatalf("Deletion gave length %d", len(d.Genes))
+		}
+	}
+
+	if len(g.Genes) != 20 || g.Genes[19] != 19 {
+		t.Errorf("Mutations modified the original genome: %v", g.Genes)
+	}
+
+	full := genomes.Genotype{Genes: seq(0, 25)}
+	if got := full.InsertCodon(rng, bounds); len(got.Genes) != 25 {
+		t.Errorf("Expected insertion to respect the max length, got %d", len(got.Genes))
+	}
+	short := genomes.Genotype{Genes: seq(0, 18)}
+	if got := short.DeleteCodons(rng, bounds); len(got.Genes) != 18 {
+		t.Errorf("Expected deletion to respect the min length, got %d", len(got.Genes))
+	}
+}
+
+func TestVariableLengthMutateGenotype(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	rates := genomes.LengthMutationRates{Duplication: 0.3, Insertion: 0.3, Deletion: 0.3}
+	mutate := genomes.NewVariableLengthMutateGenotype(rng, 0.05, rates, genomes.LengthBounds{Min: 10, Max: 60})
+
+	g := genomes.Genotype{Genes: seq(0, 30)}
+	population := make([]genomes.Genotype, 50)
+	for i := range population {
+		population[i] = g
+		for range 20 {
+			population[i] = mutate(population[i])
+		}
+	}
+
+	stats := genomes.NewLengthStats(population)
+	if stats.Min < 10 || stats.Max > 60 || stats.Min == stats.Max {
+		t.Errorf("Unexpected length stats after mutation: %+v", stats)
+	}
+	if stats.Mean < float64(stats.Min) || stats.Mean > float64(stats.Max) {
+		t.Errorf("Mean length %f outside [%d, %d]", stats.Mean, stats.Min, stats.Max)
+	}
+}
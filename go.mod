@@ -3,16 +3,16 @@ module github.com/danielkennedy1/sieve
 go 1.25.2
 
 require (
+	github.com/buger/goterm v1.0.4
 	github.com/expr-lang/expr v1.17.6
+	github.com/go-echarts/go-echarts/v2 v2.6.7
 	github.com/spf13/viper v1.21.0
 	github.com/stretchr/testify v1.11.1
 )
 
 require (
-	github.com/buger/goterm v1.0.4 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fsnotify/fsnotify v1.9.0 // indirect
-	github.com/go-echarts/go-echarts/v2 v2.6.7 // indirect
 	github.com/go-viper/mapstructure/v2 v2.4.0 // indirect
 	github.com/pelletier/go-toml/v2 v2.2.4 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/danielkennedy1/sieve/genomes"
+	"github.com/danielkennedy1/sieve/problems/grammar"
+)
+
+func runGrammarCommand(args []string) int {
+	fs := flag.NewFlagSet("grammar lint", flag.ContinueOnError)
+	codonBits := fs.Int("codon-bits", 8, "Codon width to check modulo bias for: 8, 16 or 32")
+	fs.Usage = func() {
+		fmt.Println("Usage: sieve grammar lint [-codon-bits n] <file.bnf>")
+	}
+
+	if len(args) == 0 || args[0] != "lint" {
+		fs.Usage()
+		return 2
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	width, err := genomes.ParseCodonWidth(*codonBits)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	gr, err := grammar.ParseFile(fs.Arg(0))
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	report := genomes.AnalyseGrammarWidth(gr, width)
+	fmt.Print(report.String())
+
+	if report.HasErrors() {
+		return 1
+	}
+	return 0
+}
@@ -4,7 +4,6 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"bufio"
 	"math/rand/v2"
 	"slices"
 	"time"
@@ -19,6 +18,16 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "grammar":
+			os.Exit(runGrammarCommand(os.Args[2:]))
+		case "map":
+			os.Exit(runMapCommand(os.Args[2:]))
+		case "regression":
+			os.Exit(runRegressionCommand(os.Args[2:]))
+		}
+	}
 
 	runGA := flag.Bool("ga", false, "Run genetic algorithm")
 	makeChart := flag.Bool("chart", false, "Generate charts from existing data")
@@ -46,6 +55,7 @@ func main() {
 	}
 
 	fmt.Println("No action specified. Use -ga to run genetic algorithm, -chart to generate charts, or -compare to run comparison.")
+	fmt.Println("Use 'grammar lint <file.bnf>' to check a grammar, or 'map <file.bnf> <codons>' to map a genotype.")
 }
 
 func runMarketGE() {
@@ -60,17 +70,42 @@ func runMarketGE() {
 		os.Exit(1)
 	}
 
-	f, err = os.Open(config.BNFFilePath)
+	gr, err := grammar.ParseFile(config.BNFFilePath)
 	if err != nil {
-		fmt.Printf("File not found: %s\n", config.BNFFilePath)
+		fmt.Printf("Error loading grammar: %v\n", err)
 		os.Exit(1)
 	}
-	defer f.Close()
+	gr.BuildRuleMap()
 
 	r := rand.New(rand.NewPCG(0, 0))
-	s := bufio.NewScanner(f)
-	gr := grammar.Parse(*s)
-	gr.BuildRuleMap()
+
+	width, err := genomes.ParseCodonWidth(config.Population.CodonBits)
+	if err != nil {
+		fmt.Printf("Fatal error loading configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	report := genomes.AnalyseGrammarWidth(gr, width)
+	for _, issue := range report.Issues {
+		fmt.Printf("%s: %s\n", config.BNFFilePath, issue)
+	}
+	if report.HasErrors() {
+		os.Exit(1)
+	}
+
+	gr.Mapping, err = genomes.ParseMappingMode(config.Mapping)
+	if err == nil {
+		err = gr.CheckMapping()
+	}
+	if err != nil {
+		fmt.Printf("Fatal error loading configuration: %v\n", err)
+		os.Exit(1)
+	}
+	// Seeds are encoded against the probabilities, so fill in any missing
+	// annotations before anything maps through the grammar
+	if gr.Mapping == genomes.ProbabilisticMapping {
+		gr.NormaliseProbabilities()
+	}
 
 	simulator := &grammar.MarketSimulator{
 		Results: nil,
@@ -95,35 +130,53 @@ func runMarketGE() {
 		Generation: 0,
 	}
 
-	population := ea.NewPopulation(
-		config.Population.Size,
-		config.Population.MutationRate,
-		config.Population.CrossoverRate,
-		config.Population.EliteCount,
-		genomes.NewCreateGenotype(config.Population.GeneLength, r),
-		simulator.NewMarketFitness(),
-		genomes.NewCrossoverGenotype(r),
-		genomes.NewMutateGenotype(r, config.Population.MutationRate),
-		ea.Tournament(config.Population.TournamentSize),
-		func(g genomes.Genotype) string {
-			return string(g.Genes)
-		},
-		config.Population.CacheBoolean,
-	)
-
-	population.BeforeEvaluate = simulator.BeforeGeneration
-	population.AfterEvaluate = simulator.AfterGeneration
+	bloat, err := ea.ParseBloatMethod(config.Bloat.Method)
+	if err != nil {
+		fmt.Printf("Fatal error loading configuration: %v\n", err)
+		os.Exit(1)
+	}
+	sizedSelector := ea.NewBloatControl(bloat, ea.SeededTournament(config.Population.TournamentSize, r), ea.BloatOptions{
+		TournamentSize: config.Population.TournamentSize,
+		TarpeianRate:   config.Bloat.TarpeianRate,
+		Parsimony:      config.Bloat.Parsimony,
+		DepthLimit:     config.Bloat.DepthLimit,
+	}, r)
 
+	var strategy string
+	var fitness float64
 	start := time.Now()
-	population.Evolve(config.Generations)
+	switch config.Representation {
+	case "", "ge":
+		strategy, fitness = evolveGE(config, &gr, width, simulator, bloat, sizedSelector, r)
+	case "cfggp":
+		// Derivation trees are evolved directly, with no codons to map
+		if gr.Mapping != genomes.StandardMapping {
+			fmt.Printf("Fatal error loading configuration: mapping %q does not apply to representation \"cfggp\"\n", config.Mapping)
+			os.Exit(1)
+		}
+		strategy, fitness = evolveCFGGP(config, gr, simulator, bloat, sizedSelector, r)
+	default:
+		fmt.Printf("Fatal error loading configuration: unknown representation %q\n", config.Representation)
+		os.Exit(1)
+	}
 	elapsed := time.Since(start)
 
-	best, fitness := population.Best()
 	fmt.Printf("\n=== Results ===\n")
 	fmt.Printf("Best fitness: $%.2f\n", fitness)
-	fmt.Printf("Best strategy: %s\n", best.MapToGrammar(gr, 100).String())
+	fmt.Printf("Best strategy: %s\n", strategy)
+	if simplified, err := grammar.Simplify(strategy); err == nil && simplified != strategy {
+		fmt.Printf("Simplified: %s\n", simplified)
+	}
 	fmt.Printf("Elapsed time: %s\n", elapsed)
 
+	if gr.Mapping == genomes.ProbabilisticMapping && config.PGE.OutputPath != "" {
+		if err := os.WriteFile(config.PGE.OutputPath, []byte(gr.String()), 0644); err != nil {
+			fmt.Printf("Error exporting learned grammar: %v\n", err)
+		} else {
+			fmt.Printf("Learned grammar exported to %s\n", config.PGE.OutputPath)
+		}
+	}
+
 	err = simulator.History.ExportJSON("market_history.json")
 	if err != nil {
 		fmt.Printf("Error exporting history: %v\n", err)
@@ -157,3 +210,158 @@ func runMarketGE() {
 		}
 	}
 }
+
+// evolveGE evolves codon genotypes mapped through gr, returning the best
+// strategy and its fitness.
+func evolveGE(config *config.Config, gr *genomes.Grammar, width genomes.CodonWidth, simulator *grammar.MarketSimulator, bloat ea.BloatMethod, sizedSelector ea.SizedSelector, r *rand.Rand) (string, float64) {
+	create := genomes.NewCreateGenotypeWidth(config.Population.GeneLength, width, r)
+	if len(config.SeedStrategies) > 0 {
+		seeds := make([]genomes.Genotype, 0, len(config.SeedStrategies))
+		for _, strategy := range config.SeedStrategies {
+			g, err := genomes.GenotypeFromPhenotype(*gr, strategy, config.Population.GeneLength, width, config.MaxReproductions, r)
+			if err != nil {
+				fmt.Printf("Error seeding strategy %q: %v\n", strategy, err)
+				os.Exit(1)
+			}
+			seeds = append(seeds, g)
+		}
+		create = genomes.NewSeededCreateGenotype(seeds, create)
+	}
+
+	crossover := genomes.NewCrossoverGenotype(r)
+	mutate := genomes.NewMutateGenotype(r, config.Population.MutationRate)
+	if config.Population.VariableLength {
+		bounds := genomes.LengthBounds{Min: config.Population.MinGeneLength, Max: config.Population.MaxGeneLength}
+		rates := genomes.LengthMutationRates{
+			Duplication: config.Population.DuplicationRate,
+			Insertion:   config.Population.InsertionRate,
+			Deletion:    config.Population.DeletionRate,
+		}
+		crossover = genomes.NewTwoPointCrossoverGenotype(r, bounds)
+		mutate = genomes.NewVariableLengthMutateGenotype(r, config.Population.MutationRate, rates, bounds)
+	}
+
+	toKey := genomes.Genotype.Key
+	if config.Population.SimplifiedCacheKey {
+		toKey = grammar.NewSimplifiedKey(*gr, config.MaxReproductions)
+	} else if gr.Mapping == genomes.ProbabilisticMapping {
+		// PGE relearns the probabilities each generation, changing what the
+		// same codons map to, so cache by phenotype
+		toKey = func(g genomes.Genotype) string {
+			return g.MapToGrammar(*gr, config.MaxReproductions).String()
+		}
+	}
+
+	population := ea.NewPopulation(
+		config.Population.Size,
+		config.Population.MutationRate,
+		config.Population.CrossoverRate,
+		config.Population.EliteCount,
+		create,
+		simulator.NewMarketFitness(),
+		crossover,
+		mutate,
+		ea.SeededTournament(config.Population.TournamentSize, r),
+		toKey,
+		config.Population.CacheBoolean,
+	)
+
+	population.SizedSelector = sizedSelector
+	population.Size = genomes.NewDerivationSize(*gr, config.MaxReproductions)
+	if bloat.UsesDepth() {
+		population.Size = genomes.NewDerivationDepth(*gr, config.MaxReproductions)
+	}
+
+	population.BeforeEvaluate = simulator.BeforeGeneration
+	population.AfterEvaluate = simulator.AfterGeneration
+
+	var afterEvaluate []func([]genomes.Genotype, []float64)
+	if config.CoverageBest > 0 {
+		coverage := ea.NewCoverage(genomes.NewProductionFeatures(*gr, config.MaxReproductions), config.CoverageBest)
+		afterEvaluate = append(afterEvaluate, func(g []genomes.Genotype, fitnesses []float64) {
+			c := coverage(g, fitnesses)
+			simulator.RecordCoverage(c.Population, c.Best)
+		})
+	}
+	if gr.Mapping == genomes.ProbabilisticMapping {
+		afterEvaluate = append(afterEvaluate, genomes.NewPGEUpdate(gr, config.PGE.LearningRate, config.PGE.BestCount, config.MaxReproductions))
+	}
+	population.AfterEvaluateGenomes = func(g []genomes.Genotype, fitnesses []float64) {
+		for _, hook := range afterEvaluate {
+			hook(g, fitnesses)
+		}
+	}
+
+	population.Evolve(config.Generations)
+
+	best, fitness := population.Best()
+	return best.MapToGrammar(*gr, 100).String(), fitness
+}
+
+// evolveCFGGP evolves derivation trees directly (CFG-GP), returning the best
+// strategy and its fitness.
+func evolveCFGGP(config *config.Config, gr genomes.Grammar, simulator *grammar.MarketSimulator, bloat ea.BloatMethod, sizedSelector ea.SizedSelector, r *rand.Rand) (string, float64) {
+	maxDepth := config.Population.MaxDepth
+
+	create := genomes.NewCreateDerivationTree(gr, maxDepth, r)
+	if len(config.SeedStrategies) > 0 {
+		seeds := make([]*genomes.GrammarNode, 0, len(config.SeedStrategies))
+		for _, strategy := range config.SeedStrategies {
+			tree, err := genomes.ParsePhenotype(gr, strategy)
+			if err != nil {
+				fmt.Printf("Error seeding strategy %q: %v\n", strategy, err)
+				os.Exit(1)
+			}
+			seeds = append(seeds, tree)
+		}
+		create = genomes.NewSeededCreateDerivationTree(seeds, create)
+	}
+
+	toKey := genomes.DerivationTree.String
+	if config.Population.SimplifiedCacheKey {
+		toKey = func(t genomes.DerivationTree) string {
+			if s, err := grammar.Simplify(t.String()); err == nil {
+				return s
+			}
+			return t.String()
+		}
+	}
+
+	population := ea.NewPopulation(
+		config.Population.Size,
+		config.Population.MutationRate,
+		config.Population.CrossoverRate,
+		config.Population.EliteCount,
+		create,
+		simulator.NewTreeMarketFitness(),
+		genomes.NewSubtreeCrossover(gr, maxDepth, r),
+		genomes.NewSubtreeMutation(gr, maxDepth, r),
+		ea.SeededTournament(config.Population.TournamentSize, r),
+		toKey,
+		config.Population.CacheBoolean,
+	)
+
+	population.SizedSelector = sizedSelector
+	population.Size = genomes.DerivationTree.Size
+	if bloat.UsesDepth() {
+		population.Size = genomes.DerivationTree.Depth
+	}
+
+	population.BeforeEvaluate = simulator.BeforeTreeGeneration
+	population.AfterEvaluate = simulator.AfterGeneration
+	if config.CoverageBest > 0 {
+		features := func(t genomes.DerivationTree) []string {
+			return t.ProductionFeatures(gr)
+		}
+		coverage := ea.NewCoverage(features, config.CoverageBest)
+		population.AfterEvaluateGenomes = func(trees []genomes.DerivationTree, fitnesses []float64) {
+			c := coverage(trees, fitnesses)
+			simulator.RecordCoverage(c.Population, c.Best)
+		}
+	}
+
+	population.Evolve(config.Generations)
+
+	best, fitness := population.Best()
+	return best.String(), fitness
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/danielkennedy1/sieve/genomes"
+	"github.com/danielkennedy1/sieve/problems/grammar"
+)
+
+func runMapCommand(args []string) int {
+	fs := flag.NewFlagSet("map", flag.ContinueOnError)
+	maxReproductions := fs.Int("max-reproductions", 200, "Expansions before terminating productions are forced")
+	mappingName := fs.String("mapping", "standard", `Mapping mode: "standard", "pge" or "pige"`)
+	format := fs.String("format", "text", `Tree output format: "text", "json" or "dot"`)
+	codonBits := fs.Int("codon-bits", 8, "Codon width: 8, 16 or 32")
+	fs.Usage = func() {
+		fmt.Println("Usage: sieve map [flags] <file.bnf> <codons>")
+		fmt.Println(`Codons are comma or space separated, e.g. "3,1,4,1,5"`)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return 2
+	}
+
+	gr, err := grammar.ParseFile(fs.Arg(0))
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	gr.Mapping, err = genomes.ParseMappingMode(*mappingName)
+	if err == nil {
+		err = gr.CheckMapping()
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	if gr.Mapping == genomes.ProbabilisticMapping {
+		gr.NormaliseProbabilities()
+	}
+
+	width, err := genomes.ParseCodonWidth(*codonBits)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	genes, err := parseCodons(strings.Join(fs.Args()[1:], " "), width)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	tree, trace := genomes.Genotype{Genes: genes, Width: width}.MapToGrammarTrace(gr, *maxReproductions)
+
+	fmt.Printf("Phenotype: %s\n", tree.String())
+	fmt.Printf("Depth: %d, size: %d, expansions: %d\n\n", tree.Depth(), tree.Size(), len(trace))
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(tree); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	case "dot":
+		fmt.Print(tree.DOT())
+	case "text":
+		tree.Walk(func(n *genomes.GrammarNode, depth int) bool {
+			fmt.Printf("%s%s\n", strings.Repeat("  ", depth), n.Token())
+			return true
+		})
+	default:
+		fmt.Printf("unknown format %q\n", *format)
+		return 2
+	}
+
+	fmt.Println("\nTrace:")
+	for _, step := range trace {
+		fmt.Println(formatStep(gr, step))
+	}
+	return 0
+}
+
+func parseCodons(s string, width genomes.CodonWidth) ([]uint32, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no codons given")
+	}
+
+	genes := make([]uint32, len(fields))
+	for i, f := range fields {
+		v, err := strconv.ParseUint(f, 10, int(width))
+		if err != nil {
+			return nil, fmt.Errorf("invalid codon %q: must be 0-%d", f, width.Values()-1)
+		}
+		genes[i] = uint32(v)
+	}
+	return genes, nil
+}
+
+func formatStep(gr genomes.Grammar, step genomes.TraceStep) string {
+	var source string
+	switch {
+	case step.Codon < 0:
+		source = "forced"
+	case step.OrderCodon >= 0:
+		source = fmt.Sprintf("codons[%d,%d]=%d", step.OrderCodon, step.Codon, step.Value)
+	default:
+		source = fmt.Sprintf("codon[%d]=%d", step.Codon, step.Value)
+	}
+
+	var production string
+	for _, r := range gr.Rules {
+		if r.Left == step.NonTerminal {
+			production = strings.Join(r.Productions[step.Production].Elements, " ")
+			break
+		}
+	}
+	return fmt.Sprintf("%-18s %s ::= %s  (production %d)", source, step.NonTerminal, production, step.Production)
+}
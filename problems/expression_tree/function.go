@@ -6,6 +6,7 @@ import (
 	"math"
 	"strconv"
 
+	"github.com/danielkennedy1/sieve/ea"
 	"github.com/danielkennedy1/sieve/genomes"
 )
 
@@ -86,13 +87,14 @@ func LoadSamples(reader *csv.Reader) ([]Sample, error) {
 //	return math.Sqrt(mean_squared_error)
 //}
 
-func NewRootMeanSquaredError(variables *[]float64, samples *[]Sample) func(e genomes.Expression) float64 {
+// NewRootMeanSquaredError returns the negated RMSE of an expression over
+// samples. It is safe to call from several goroutines.
+func NewRootMeanSquaredError(samples *[]Sample) func(e genomes.Expression) float64 {
 	return func(e genomes.Expression) float64 {
 		total_squared_error := 0.0
 
 		for i := range *samples {
-			(*variables) = (*samples)[i].Variables
-			squared_error := math.Pow((e.GetValue() - (*samples)[i].Output), 2)
+			squared_error := math.Pow((e.Eval((*samples)[i].Variables) - (*samples)[i].Output), 2)
 			total_squared_error += squared_error
 		}
 
@@ -101,3 +103,73 @@ func NewRootMeanSquaredError(variables *[]float64, samples *[]Sample) func(e gen
 		return -math.Sqrt(mean_squared_error)
 	}
 }
+
+// Columns transposes samples so that column i holds x_i of every sample,
+// the layout Program.EvalBatch reads.
+func Columns(samples []Sample) [][]float64 {
+	if len(samples) == 0 {
+		return nil
+	}
+	columns := make([][]float64, len(samples[0].Variables))
+	for i := range columns {
+		columns[i] = make([]float64, len(samples))
+		for j, s := range samples {
+			columns[i][j] = s.Variables[i]
+		}
+	}
+	return columns
+}
+
+// NewCompiledRootMeanSquaredError is NewRootMeanSquaredError with each
+// expression compiled and evaluated over all samples in batches.
+func NewCompiledRootMeanSquaredError(samples *[]Sample) func(e genomes.Expression) float64 {
+	columns := Columns(*samples)
+	return func(e genomes.Expression) float64 {
+		predictions := make([]float64, len(*samples))
+		genomes.Compile(e).EvalBatch(columns, predictions)
+
+		total_squared_error := 0.0
+		for i, p := range predictions {
+			d := p - (*samples)[i].Output
+			total_squared_error += d * d
+		}
+		return -math.Sqrt(total_squared_error / float64(len(*samples)))
+	}
+}
+
+// NewRegressionFitness scores an expression's batched predictions over
+// samples with fitness, e.g. a regression.NewFitness metric.
+func NewRegressionFitness(samples *[]Sample, fitness func(predictions, targets []float64) float64) func(e genomes.Expression) float64 {
+	columns := Columns(*samples)
+	targets := make([]float64, len(*samples))
+	for i, s := range *samples {
+		targets[i] = s.Output
+	}
+	return func(e genomes.Expression) float64 {
+		predictions := make([]float64, len(*samples))
+		genomes.Compile(e).EvalBatch(columns, predictions)
+		return fitness(predictions, targets)
+	}
+}
+
+// NewConstantOptimiser tunes an expression's constants with Nelder–Mead to
+// maximise evaluate, for use as Population.LocalSearch. evaluate must be the
+// population's own fitness function, as the fitness it is passed and the one
+// it returns replace each other. It returns the expression unchanged if it
+// has no constants or none score better.
+func NewConstantOptimiser(evaluate func(e genomes.Expression) float64, maxEvaluations int) func(e genomes.Expression, fitness float64) (genomes.Expression, float64) {
+	return func(e genomes.Expression, fitness float64) (genomes.Expression, float64) {
+		constants := genomes.Constants(e)
+		if len(constants) == 0 {
+			return e, fitness
+		}
+
+		best, value := ea.NelderMead(func(c []float64) float64 {
+			return -evaluate(genomes.WithConstants(e, c))
+		}, constants, maxEvaluations)
+		if -value <= fitness {
+			return e, fitness
+		}
+		return genomes.WithConstants(e, best), -value
+	}
+}
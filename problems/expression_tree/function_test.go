@@ -2,11 +2,15 @@ package expression_tree_test
 
 import (
 	"encoding/csv"
+	"math"
+	"math/rand/v2"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/danielkennedy1/sieve/genomes"
 	"github.com/danielkennedy1/sieve/problems/expression_tree"
+	"github.com/danielkennedy1/sieve/problems/regression"
 )
 
 func TestLoadSamples(t *testing.T) {
@@ -44,22 +48,20 @@ func TestLoadSamples(t *testing.T) {
 }
 
 func TestMeanSquaredError(t *testing.T) {
-	variables := make([]float64, 3)
-
 	// x1 + ( 3 * x2 - x3 / 2 )
 	expr := genomes.NonTerminal{
 		Operator: genomes.Add,
-		Left:     genomes.Variable{Variables: &variables, Index: 0},
+		Left:     genomes.Variable{Index: 0},
 		Right: genomes.NonTerminal{
 			Operator: genomes.Subtract,
 			Left: genomes.NonTerminal{
 				Operator: genomes.Multiply,
 				Left:     genomes.Primitive{Value: 3},
-				Right:    genomes.Variable{Variables: &variables, Index: 1},
+				Right:    genomes.Variable{Index: 1},
 			},
 			Right: genomes.NonTerminal{
 				Operator: genomes.Divide,
-				Left:     genomes.Variable{Variables: &variables, Index: 2},
+				Left:     genomes.Variable{Index: 2},
 				Right:    genomes.Primitive{Value: 2},
 			},
 		},
@@ -72,10 +74,147 @@ func TestMeanSquaredError(t *testing.T) {
 		{[]float64{0, 3, 1}, 8.5},
 	}
 
-	rmseFunc := expression_tree.NewRootMeanSquaredError(&variables, &samples)
+	rmseFunc := expression_tree.NewRootMeanSquaredError(&samples)
 	got := rmseFunc(expr)
 	want := 0.0
 	if got != want {
 		t.Errorf("Got RMSE %f, want %f", got, want)
 	}
 }
+
+// Run with -race: evaluating many expressions over the same samples at once
+// must not share any state.
+func TestRootMeanSquaredErrorParallel(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	constants := []float64{1, 2, 3}
+	samples := make([]expression_tree.Sample, 50)
+	for i := range samples {
+		x0, x1 := r.Float64(), r.Float64()
+		samples[i] = expression_tree.Sample{Variables: []float64{x0, x1}, Output: x0*x1 + 1}
+	}
+	rmse := expression_tree.NewRootMeanSquaredError(&samples)
+
+	exprs := make([]genomes.Expression, 64)
+	want := make([]float64, len(exprs))
+	for i := range exprs {
+		exprs[i] = genomes.RandomFormula(6, &constants, 2, r)
+		want[i] = rmse(exprs[i])
+	}
+
+	got := make([]float64, len(exprs))
+	var wg sync.WaitGroup
+	for i := range exprs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i] = rmse(exprs[i])
+		}()
+	}
+	wg.Wait()
+
+	for i := range exprs {
+		if got[i] != want[i] {
+			t.Errorf("%s: parallel RMSE %f, sequential %f", exprs[i], got[i], want[i])
+		}
+	}
+}
+
+func TestCompiledRootMeanSquaredError(t *testing.T) {
+	samples, exprs := benchmarkData(500, 20)
+	rmse := expression_tree.NewRootMeanSquaredError(&samples)
+	compiled := expression_tree.NewCompiledRootMeanSquaredError(&samples)
+
+	for _, e := range exprs {
+		want, got := rmse(e), compiled(e)
+		if math.Abs(got-want) > 1e-9*math.Max(1, math.Abs(want)) {
+			t.Errorf("%s: compiled RMSE %f, recursive %f", e, got, want)
+		}
+	}
+}
+
+// benchmarkData is n samples of a three variable target and random depth 8
+// expressions to fit it.
+func benchmarkData(n, numExprs int) ([]expression_tree.Sample, []genomes.Expression) {
+	r := rand.New(rand.NewPCG(5, 6))
+	samples := make([]expression_tree.Sample, n)
+	for i := range samples {
+		x := []float64{r.Float64(), r.Float64(), r.Float64()}
+		samples[i] = expression_tree.Sample{Variables: x, Output: x[0]*x[1] - x[2]/2}
+	}
+
+	constants := []float64{0.5, 1, 2, 3}
+	exprs := make([]genomes.Expression, numExprs)
+	for i := range exprs {
+		exprs[i] = genomes.RandomFormula(8, &constants, 3, r)
+	}
+	return samples, exprs
+}
+
+func BenchmarkRootMeanSquaredError(b *testing.B) {
+	samples, exprs := benchmarkData(10000, 20)
+	rmse := expression_tree.NewRootMeanSquaredError(&samples)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rmse(exprs[i%len(exprs)])
+	}
+}
+
+func BenchmarkCompiledRootMeanSquaredError(b *testing.B) {
+	samples, exprs := benchmarkData(10000, 20)
+	rmse := expression_tree.NewCompiledRootMeanSquaredError(&samples)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rmse(exprs[i%len(exprs)])
+	}
+}
+
+func TestConstantOptimiser(t *testing.T) {
+	samples := make([]expression_tree.Sample, 20)
+	for i := range samples {
+		x := float64(i) / 4
+		samples[i] = expression_tree.Sample{Variables: []float64{x}, Output: 2.5*x + 0.7}
+	}
+
+	// 1 * x0 + 1
+	expr := genomes.NonTerminal{
+		Operator: genomes.Add,
+		Left:     genomes.NonTerminal{Operator: genomes.Multiply, Left: genomes.Primitive{Value: 1}, Right: genomes.Variable{Index: 0}},
+		Right:    genomes.Primitive{Value: 1},
+	}
+	evaluate := expression_tree.NewRootMeanSquaredError(&samples)
+	fitness := evaluate(expr)
+
+	optimise := expression_tree.NewConstantOptimiser(evaluate, 500)
+	tuned, tunedFitness := optimise(expr, fitness)
+
+	if tunedFitness < -1e-4 {
+		t.Errorf("expected near-perfect fit, got fitness %f for %s", tunedFitness, tuned)
+	}
+	c := genomes.Constants(tuned)
+	if math.Abs(c[0]-2.5) > 1e-3 || math.Abs(c[1]-0.7) > 1e-3 {
+		t.Errorf("expected constants near [2.5 0.7], got %v", c)
+	}
+
+	// Nothing to tune without constants
+	x := genomes.Variable{Index: 0}
+	if e, f := optimise(x, -1); !e.Compare(x) || f != -1 {
+		t.Errorf("expected %s unchanged, got %s with %f", x, e, f)
+	}
+}
+
+func TestRegressionFitness(t *testing.T) {
+	samples, exprs := benchmarkData(200, 10)
+	rmse := expression_tree.NewRootMeanSquaredError(&samples)
+	fitness := expression_tree.NewRegressionFitness(&samples, regression.NewFitness(regression.RMSE, false))
+	scaled := expression_tree.NewRegressionFitness(&samples, regression.NewFitness(regression.RMSE, true))
+
+	for _, e := range exprs {
+		want, got := rmse(e), fitness(e)
+		if math.Abs(got-want) > 1e-9*math.Max(1, math.Abs(want)) {
+			t.Errorf("%s: RMSE fitness %f, want %f", e, got, want)
+		}
+		if s := scaled(e); s < got-1e-9 {
+			t.Errorf("%s: linear scaling made the fit worse: %f < %f", e, s, got)
+		}
+	}
+}
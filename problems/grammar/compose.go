@@ -0,0 +1,320 @@
+package grammar
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/danielkennedy1/sieve/genomes"
+)
+
+// maxInstantiations bounds template expansion so self-growing templates fail
+// instead of looping forever.
+const maxInstantiations = 10000
+
+type include struct {
+	path      string
+	namespace string
+	tok       token
+}
+
+type loader struct {
+	// loading holds the files currently being loaded, to catch include cycles
+	loading map[string]bool
+}
+
+func newLoader() *loader {
+	return &loader{loading: map[string]bool{}}
+}
+
+// unit is a loaded grammar file with its includes merged in.
+type unit struct {
+	rules []genomes.Rule
+	// types maps rule names (without template parameters) to declared types
+	types map[string]string
+	env   map[string]string
+}
+
+func (l *loader) loadFile(path string) (unit, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return unit{}, err
+	}
+	if l.loading[abs] {
+		return unit{}, fmt.Errorf("include cycle through %s", path)
+	}
+	l.loading[abs] = true
+	defer delete(l.loading, abs)
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return unit{}, err
+	}
+
+	u, err := l.load(string(src), filepath.Dir(path))
+	var perr *ParseError
+	if errors.As(err, &perr) && perr.File == "" {
+		perr.File = path
+	}
+	return u, err
+}
+
+// load parses src and merges in its includes. Rules and declarations in src
+// override included ones of the same name, and later includes override
+// earlier ones.
+func (l *loader) load(src, dir string) (unit, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return unit{}, err
+	}
+
+	p := &parser{tokens: tokens, types: map[string]string{}, env: map[string]string{}}
+	own, err := p.parseGrammar()
+	if err != nil {
+		return unit{}, err
+	}
+
+	included := make([]unit, len(p.includes))
+	for i, inc := range p.includes {
+		u, err := l.loadFile(filepath.Join(dir, inc.path))
+		if err != nil {
+			var perr *ParseError
+			if errors.As(err, &perr) {
+				return unit{}, err
+			}
+			return unit{}, p.errorf(inc.tok, "%%include %q: %v", inc.path, err)
+		}
+		if inc.namespace != "" {
+			u = namespace(u, inc.namespace)
+		}
+		included[i] = u
+	}
+
+	merged := unit{rules: own, types: map[string]string{}, env: map[string]string{}}
+	for i, inc := range included {
+		overridden := map[string]bool{}
+		for _, r := range own {
+			overridden[ruleKey(r.Left)] = true
+		}
+		for _, later := range included[i+1:] {
+			for _, r := range later.rules {
+				overridden[ruleKey(r.Left)] = true
+			}
+		}
+
+		for _, r := range inc.rules {
+			if !overridden[ruleKey(r.Left)] {
+				merged.rules = append(merged.rules, r)
+			}
+		}
+		maps.Copy(merged.types, inc.types)
+		maps.Copy(merged.env, inc.env)
+	}
+	maps.Copy(merged.types, p.types)
+	maps.Copy(merged.env, p.env)
+
+	return merged, nil
+}
+
+// compose instantiates templates and builds the final grammar. The start
+// symbol is the first rule that isn't a template. Grammars that declare
+// types are type checked.
+func compose(u unit) (genomes.Grammar, error) {
+	rules, err := instantiate(u.rules)
+	if err != nil {
+		return genomes.Grammar{}, err
+	}
+	if len(rules) == 0 {
+		return genomes.Grammar{}, &ParseError{Line: 1, Col: 1, Msg: "grammar has no rules"}
+	}
+
+	gr := genomes.Grammar{Rules: rules}
+	if len(u.types) == 0 && len(u.env) == 0 {
+		return gr, nil
+	}
+
+	gr.Types = map[string]string{}
+	for _, r := range rules {
+		if t, ok := u.types[ruleKey(r.Left)]; ok {
+			gr.Types[r.Left] = t
+		}
+	}
+	gr.Env = u.env
+
+	if err := TypeCheck(gr); err != nil {
+		return genomes.Grammar{}, err
+	}
+	return gr, nil
+}
+
+// splitCall splits "<name(a,b)>" into "name" and its arguments. A plain
+// "<name>" has no arguments.
+func splitCall(nt string) (string, []string) {
+	inner := strings.TrimSuffix(strings.TrimPrefix(nt, "<"), ">")
+	open := strings.IndexByte(inner, '(')
+	if open < 0 || !strings.HasSuffix(inner, ")") {
+		return inner, nil
+	}
+
+	var args []string
+	depth, start := 0, open+1
+	for i := open + 1; i < len(inner)-1; i++ {
+		switch inner[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, inner[start:i])
+				start = i + 1
+			}
+		}
+	}
+	args = append(args, inner[start:len(inner)-1])
+
+	return inner[:open], args
+}
+
+func joinCall(name string, args []string) string {
+	if len(args) == 0 {
+		return "<" + name + ">"
+	}
+	return "<" + name + "(" + strings.Join(args, ",") + ")>"
+}
+
+// ruleKey identifies a rule for overriding: templates are keyed by name
+// regardless of their parameter names.
+func ruleKey(left string) string {
+	name, _ := splitCall(left)
+	return name
+}
+
+// mapElement rewrites a production element: non-terminals have their name
+// passed through rename and their arguments rewritten recursively; any other
+// element is passed to terminal.
+func mapElement(e string, rename func(string) string, terminal func(string) string) string {
+	if len(e) == 0 || e[0] != '<' || e[len(e)-1] != '>' {
+		return terminal(e)
+	}
+	name, args := splitCall(e)
+	mapped := make([]string, len(args))
+	for i, a := range args {
+		mapped[i] = mapElement(a, rename, terminal)
+	}
+	return joinCall(rename(name), mapped)
+}
+
+// namespace prefixes every rule defined in u, and every reference to one,
+// with "ns.". References to rules defined elsewhere are left alone so a
+// library can rely on its includer to supply them. Environment variables are
+// shared and keep their names.
+func namespace(u unit, ns string) unit {
+	defined := map[string]bool{}
+	for _, r := range u.rules {
+		defined[ruleKey(r.Left)] = true
+	}
+
+	rename := func(name string) string {
+		if defined[name] {
+			return ns + "." + name
+		}
+		return name
+	}
+	keep := func(e string) string { return e }
+
+	out := unit{rules: make([]genomes.Rule, len(u.rules)), types: map[string]string{}, env: u.env}
+	for i, r := range u.rules {
+		out.rules[i] = genomes.Rule{Left: mapElement(r.Left, rename, keep)}
+		for _, p := range r.Productions {
+			elements := make([]string, len(p.Elements))
+			for j, e := range p.Elements {
+				elements[j] = mapElement(e, rename, keep)
+			}
+			out.rules[i].Productions = append(out.rules[i].Productions, genomes.Production{Elements: elements, Probability: p.Probability, Conditions: p.Conditions})
+		}
+	}
+	for name, t := range u.types {
+		out.types[rename(name)] = t
+	}
+	return out
+}
+
+type template struct {
+	params      []string
+	productions []genomes.Production
+}
+
+// instantiate replaces template definitions with one concrete rule per
+// distinct use, e.g. <compare(<price>,<decimal>)>, substituting arguments
+// for parameters throughout the template's productions.
+func instantiate(rules []genomes.Rule) ([]genomes.Rule, error) {
+	templates := map[string]template{}
+	var out []genomes.Rule
+	for _, r := range rules {
+		name, params := splitCall(r.Left)
+		if len(params) > 0 {
+			templates[name] = template{params: params, productions: r.Productions}
+			continue
+		}
+		out = append(out, r)
+	}
+	if len(templates) == 0 {
+		return out, nil
+	}
+
+	defined := map[string]bool{}
+	for _, r := range out {
+		defined[r.Left] = true
+	}
+
+	for i := 0; i < len(out); i++ {
+		for _, p := range out[i].Productions {
+			for _, e := range p.Elements {
+				name, args := splitCall(e)
+				if len(args) == 0 || defined[e] {
+					continue
+				}
+				t, ok := templates[name]
+				if !ok {
+					continue
+				}
+				if len(args) != len(t.params) {
+					return nil, fmt.Errorf("template <%s> takes %d argument(s), got %d in %s", name, len(t.params), len(args), e)
+				}
+				if len(out) >= maxInstantiations {
+					return nil, fmt.Errorf("template instantiation of %s does not terminate", e)
+				}
+
+				defined[e] = true
+				out = append(out, genomes.Rule{Left: e, Productions: substitute(t, args)})
+			}
+		}
+	}
+
+	return out, nil
+}
+
+func substitute(t template, args []string) []genomes.Production {
+	bind := func(e string) string {
+		if i := slices.Index(t.params, e); i >= 0 {
+			return args[i]
+		}
+		return e
+	}
+	keep := func(name string) string { return name }
+
+	productions := make([]genomes.Production, len(t.productions))
+	for i, p := range t.productions {
+		elements := make([]string, len(p.Elements))
+		for j, e := range p.Elements {
+			elements[j] = mapElement(e, keep, bind)
+		}
+		productions[i] = genomes.Production{Elements: elements, Probability: p.Probability, Conditions: p.Conditions}
+	}
+	return productions
+}
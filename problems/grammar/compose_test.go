@@ -0,0 +1,137 @@
+package grammar_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/problems/grammar"
+)
+
+func writeGrammars(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestIncludeAndOverride(t *testing.T) {
+	dir := writeGrammars(t, map[string]string{
+		"lib/common.bnf": `<op> ::= + | -
+<digit> ::= 0..2`,
+		"lib/extra.bnf": `<op> ::= * | /`,
+		"main.bnf": `%include "lib/common.bnf"
+%include "lib/extra.bnf"   # later includes win
+<expr> ::= <digit> <op> <digit>
+<digit> ::= 7`,
+	})
+
+	gr, err := grammar.ParseFile(filepath.Join(dir, "main.bnf"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if gr.Rules[0].Left != "<expr>" {
+		t.Errorf("Start rule should come from the including file, got %s", gr.Rules[0].Left)
+	}
+
+	tests := map[string][]string{
+		"<op>":    {"*", "/"},
+		"<digit>": {"7"},
+	}
+	for left, want := range tests {
+		if got := elements(gr, left); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", left, got, want)
+		}
+	}
+	if len(gr.Rules) != 3 {
+		t.Errorf("Overridden rules should be dropped, got %d rules:\n%s", len(gr.Rules), gr)
+	}
+}
+
+func TestIncludeNamespace(t *testing.T) {
+	dir := writeGrammars(t, map[string]string{
+		"ind.bnf": `<signal> ::= <level> | <hook>
+<level> ::= 30 | 70`,
+		"main.bnf": `%include "ind.bnf" as rsi
+<s> ::= <rsi.signal> <level>
+<level> ::= low
+<hook> ::= x
+<rsi.level> ::= 50`,
+	})
+
+	gr, err := grammar.ParseFile(filepath.Join(dir, "main.bnf"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := map[string][]string{
+		// <hook> isn't defined by ind.bnf so it is left for the includer
+		"<rsi.signal>": {"<rsi.level>", "<hook>"},
+		"<rsi.level>":  {"50"},
+		"<level>":      {"low"},
+	}
+	for left, want := range tests {
+		if got := elements(gr, left); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", left, got, want)
+		}
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	gr := parseString(t, `<s> ::= <pair(<a>, x)> | <pair(<b>,<pair(<a>,y)>)>
+<pair(L,R)> ::= '(' L , R ')' | [ L ]
+<a> ::= a
+<b> ::= b`)
+
+	tests := map[string][]string{
+		"<pair(<a>,x)>":             {"( <a> , x )", "<pair_opt1(<a>,x)>"},
+		"<pair_opt1(<a>,x)>":        {"<a>", ""},
+		"<pair(<b>,<pair(<a>,y)>)>": {"( <b> , <pair(<a>,y)> )", "<pair_opt1(<b>,<pair(<a>,y)>)>"},
+		"<pair(<a>,y)>":             {"( <a> , y )", "<pair_opt1(<a>,y)>"},
+	}
+	for left, want := range tests {
+		if got := elements(gr, left); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", left, got, want)
+		}
+	}
+	for _, r := range gr.Rules {
+		if strings.Contains(r.Left, "(L,R)") {
+			t.Errorf("Template definition %s should not be a rule", r.Left)
+		}
+	}
+}
+
+func TestCompositionErrors(t *testing.T) {
+	dir := writeGrammars(t, map[string]string{
+		"a.bnf":     "%include \"b.bnf\"\n<a> ::= x",
+		"b.bnf":     "%include \"a.bnf\"\n<b> ::= y",
+		"bad.bnf":   "<b> ::= y )",
+		"uses.bnf":  "<s> ::= x\n%include \"bad.bnf\"",
+		"arity.bnf": "<s> ::= <t(a)>\n<t(X,Y)> ::= X Y",
+		"none.bnf":  "%include \"missing.bnf\"",
+	})
+
+	tests := map[string]string{
+		"a.bnf":     "include cycle",
+		"uses.bnf":  "bad.bnf:1:11: unexpected ')'",
+		"arity.bnf": "template <t> takes 2 argument(s), got 1",
+		"none.bnf":  "none.bnf:1:1: %include \"missing.bnf\"",
+	}
+	for file, want := range tests {
+		_, err := grammar.ParseFile(filepath.Join(dir, file))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got error %v, want it to contain %q", file, err, want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package grammar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNonTerminal
+	tokDefine
+	tokBar
+	tokWord
+	tokString
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokLBrace
+	tokRBrace
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokEOF:
+		return "end of input"
+	case tokNonTerminal:
+		return "non-terminal"
+	case tokDefine:
+		return "'::='"
+	case tokBar:
+		return "'|'"
+	case tokWord:
+		return "terminal"
+	case tokString:
+		return "quoted terminal"
+	case tokLParen:
+		return "'('"
+	case tokRParen:
+		return "')'"
+	case tokLBracket:
+		return "'['"
+	case tokRBracket:
+		return "']'"
+	case tokLBrace:
+		return "'{'"
+	case tokRBrace:
+		return "'}'"
+	default:
+		return "?"
+	}
+}
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+	col  int
+}
+
+// ParseError is a grammar syntax error with its 1-based position.
+type ParseError struct {
+	File string
+	Line int
+	Col  int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("%d:%d: %s", e.Line, e.Col, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Col, e.Msg)
+}
+
+func isMeta(c byte) bool {
+	return strings.IndexByte("|()[]{}'\"", c) >= 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r'
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '-' || c == '.' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// nonTerminalLength returns the length of the non-terminal starting at
+// line[i], or 0 if there isn't one (e.g. the terminal "<="). Template
+// non-terminals carry a parenthesised argument list: <compare(<a>, b)>.
+func nonTerminalLength(line string, i int) int {
+	j := i + 1
+	for j < len(line) && isNameChar(line[j]) {
+		j++
+	}
+	if j == i+1 || j >= len(line) {
+		return 0
+	}
+
+	if line[j] == '(' {
+		depth := 0
+		for ; j < len(line); j++ {
+			if line[j] == '(' {
+				depth++
+			} else if line[j] == ')' {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		j++
+	}
+
+	if j >= len(line) || line[j] != '>' {
+		return 0
+	}
+	return j - i + 1
+}
+
+// lex splits BNF source into tokens. '#' starts a comment that runs to the
+// end of the line; newlines are otherwise insignificant so rules may span
+// several lines.
+func lex(src string) ([]token, error) {
+	var tokens []token
+
+	for lineIdx, line := range strings.Split(src, "\n") {
+		lineNo := lineIdx + 1
+		i := 0
+		for i < len(line) {
+			c := line[i]
+			col := i + 1
+
+			switch {
+			case isSpace(c):
+				i++
+				continue
+			case c == '#':
+				i = len(line)
+				continue
+			case strings.HasPrefix(line[i:], "::="):
+				tokens = append(tokens, token{tokDefine, "::=", lineNo, col})
+				i += 3
+				continue
+			case c == '\'' || c == '"':
+				text, n, err := lexString(line[i:])
+				if err != nil {
+					return nil, &ParseError{Line: lineNo, Col: col, Msg: err.Error()}
+				}
+				tokens = append(tokens, token{tokString, text, lineNo, col})
+				i += n
+				continue
+			case c == '!':
+				// Conditions keep their argument list: !distinct(2,4)
+				if m := conditionToken.FindString(line[i:]); m != "" {
+					tokens = append(tokens, token{tokWord, m, lineNo, col})
+					i += len(m)
+					continue
+				}
+			case c == '<':
+				if n := nonTerminalLength(line, i); n > 0 {
+					text := strings.Join(strings.Fields(line[i:i+n]), "")
+					tokens = append(tokens, token{tokNonTerminal, text, lineNo, col})
+					i += n
+					continue
+				}
+			}
+
+			if kind, ok := metaTokens[c]; ok {
+				tokens = append(tokens, token{kind, string(c), lineNo, col})
+				i++
+				continue
+			}
+
+			j := i
+			for j < len(line) && !isSpace(line[j]) && !isMeta(line[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokWord, line[i:j], lineNo, col})
+			i = j
+		}
+	}
+
+	return tokens, nil
+}
+
+var conditionToken = regexp.MustCompile(`^![a-z]+\([^()]*\)`)
+
+var metaTokens = map[byte]tokenKind{
+	'|': tokBar,
+	'(': tokLParen,
+	')': tokRParen,
+	'[': tokLBracket,
+	']': tokRBracket,
+	'{': tokLBrace,
+	'}': tokRBrace,
+}
+
+// lexString reads a quoted literal at the start of s, returning its
+// unescaped contents and how many bytes it spanned.
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				sb.WriteByte(s[i])
+			}
+		case quote:
+			return sb.String(), i + 1, nil
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted terminal")
+}
@@ -135,31 +135,86 @@ type GenerationSnapshot struct {
 	AvgFitness   float64
 	BestFitness  float64
 	WorstFitness float64
+	GenomeLength genomes.LengthStats
+	// Coverage and BestCoverage are the shares of the population and of its
+	// best individuals whose derivations use each production
+	Coverage     map[string]float64 `json:",omitempty"`
+	BestCoverage map[string]float64 `json:",omitempty"`
 }
 
 func (ms *MarketSimulator) NewMarketFitness() func(g genomes.Genotype) float64 {
 	return func(g genomes.Genotype) float64 {
-		if g.Attributes == nil {
-			return 0
-		}
+		return ms.fitness(g.Attributes)
+	}
 
-		genotypeId := 0
+}
 
-		if idAny, ok := g.Attributes["id"]; ok && idAny != nil {
-			if id, ok := idAny.(int); ok {
-				genotypeId = id
-			}
-		}
+// NewTreeMarketFitness is NewMarketFitness for CFG-GP derivation trees.
+func (ms *MarketSimulator) NewTreeMarketFitness() func(t genomes.DerivationTree) float64 {
+	return func(t genomes.DerivationTree) float64 {
+		return ms.fitness(t.Attributes)
+	}
+}
 
-		return ms.Results[genotypeId].ActiveReturn
+// fitness looks up the result of the participant whose id BeforeGeneration
+// stored in attributes. Strategies whose grammar conditions could not be met
+// score -Inf.
+func (ms *MarketSimulator) fitness(attributes map[string]any) float64 {
+	if attributes == nil {
+		return 0
 	}
+	if invalid, _ := attributes["invalid"].(bool); invalid {
+		return math.Inf(-1)
+	}
+
+	genotypeId := 0
 
+	if idAny, ok := attributes["id"]; ok && idAny != nil {
+		if id, ok := idAny.(int); ok {
+			genotypeId = id
+		}
+	}
+
+	return ms.Results[genotypeId].ActiveReturn
 }
 
 // FIXME: stateHistory takes a copy of all participants because it's a list of state objects, may be worth changing how participants
 // are stored so they're not copied N*rounds*generations (not great)
 
 func (ms *MarketSimulator) BeforeGeneration(genotypes *[]genomes.Genotype) {
+	strategies := make([]string, len(*genotypes))
+	for i, g := range *genotypes {
+		if (*genotypes)[i].Attributes == nil {
+			(*genotypes)[i].Attributes = make(map[string]any)
+		}
+		(*genotypes)[i].Attributes["id"] = i
+		tree := g.MapToGrammar(ms.Config.Grammar, ms.Config.MaxReproductions)
+		(*genotypes)[i].Attributes["invalid"] = !tree.Valid()
+		strategies[i] = tree.String()
+	}
+
+	ms.simulate(strategies)
+	ms.History.Generations[len(ms.History.Generations)-1].GenomeLength = genomes.NewLengthStats(*genotypes)
+}
+
+// BeforeTreeGeneration is BeforeGeneration for CFG-GP derivation trees.
+func (ms *MarketSimulator) BeforeTreeGeneration(trees *[]genomes.DerivationTree) {
+	strategies := make([]string, len(*trees))
+	for i, t := range *trees {
+		if (*trees)[i].Attributes == nil {
+			(*trees)[i].Attributes = make(map[string]any)
+		}
+		(*trees)[i].Attributes["id"] = i
+		(*trees)[i].Attributes["invalid"] = !t.Valid()
+		strategies[i] = t.String()
+	}
+
+	ms.simulate(strategies)
+}
+
+// simulate runs the generation's markets with one participant per strategy
+// and records the results and a history snapshot.
+func (ms *MarketSimulator) simulate(strategies []string) {
 
 	totalBuyVolume := 0
 	totalSellVolume := 0
@@ -173,20 +228,15 @@ func (ms *MarketSimulator) BeforeGeneration(genotypes *[]genomes.Genotype) {
 		RelativeStrengthIndex: 50.0,
 		SimpleMovingAverage:   ms.Config.InitialPrice,
 		AverageTrueRange:      0.0,
-		Participants:          make([]Participant, len(*genotypes)),
+		Participants:          make([]Participant, len(strategies)),
 		PriceHistory:          []float64{ms.Config.InitialPrice},
 		VolumeHistory:         []int{0},
 	}
 
-	for i, g := range *genotypes {
-		if (*genotypes)[i].Attributes == nil {
-			(*genotypes)[i].Attributes = make(map[string]any)
-		}
-		(*genotypes)[i].Attributes["id"] = i
-
+	for i, strategy := range strategies {
 		initialState.Participants[i] = Participant{
 			Id:                 i,
-			Strategy:           g.MapToGrammar(ms.Config.Grammar, ms.Config.MaxReproductions).String(),
+			Strategy:           strategy,
 			Funds:              ms.Config.InitialFunds,
 			Holdings:           ms.Config.InitialHoldings,
 			ExecutedTradeCount: 0,
@@ -298,7 +348,7 @@ func (ms *MarketSimulator) BeforeGeneration(genotypes *[]genomes.Genotype) {
 
 	results := []StrategyResult{}
 
-	for genotypeId := range *genotypes {
+	for genotypeId := range strategies {
 
 		totalSharpe := 0.0
 		results = append(results, StrategyResult{
@@ -389,6 +439,8 @@ func (ms *MarketSimulator) AfterGeneration(fitnesses []float64) {
 	fmt.Println("Survivor count: ", survivorCount)
 	fmt.Println("Highest fitness strategy: ", ms.Results[bestFitnessIdx].Strategy)
 	fmt.Println("Fitness: ", bestFitness)
+	length := ms.History.Generations[idx].GenomeLength
+	fmt.Printf("Genome length: min %d, mean %.1f, max %d\n", length.Min, length.Mean, length.Max)
 
 	slices.Sort(fitnesses)
 
@@ -452,11 +504,21 @@ func (ms *MarketSimulator) AfterGeneration(fitnesses []float64) {
 	ms.Generation++
 }
 
+// RecordCoverage stores the generation's grammar coverage in its snapshot.
+func (ms *MarketSimulator) RecordCoverage(population, best map[string]float64) {
+	idx := len(ms.History.Generations) - 1
+	ms.History.Generations[idx].Coverage = population
+	ms.History.Generations[idx].BestCoverage = best
+
+	fmt.Printf("Grammar coverage: %d of %d productions used, %d by the best\n",
+		len(population), ms.Config.Grammar.ProductionCount(), len(best))
+}
+
 func (ms *MarketSimulator) generateOrder(p Participant, s MarketState, progress float64) Order {
 	if !p.Solvent {
 		return Order{GenotypeID: p.Id, Action: "HOLD", Quantity: 0}
 	}
-	program, err := expr.Compile(p.Strategy)
+	program, err := expr.Compile(p.Strategy, compileOptions(ms.Config.Grammar, "string")...)
 
 	if err != nil {
 		fmt.Println("Error compiling expression for Genotype", p.Id, ":", err)
@@ -2,46 +2,387 @@ package grammar
 
 import (
 	"bufio"
+	"fmt"
+	"math"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/danielkennedy1/sieve/genomes"
 )
 
-func Parse(scanner bufio.Scanner) genomes.Grammar {
-	var grammar genomes.Grammar
-
-	numberRange := regexp.MustCompile(`^(\d+)\.\.(\d+)$`) 
+var (
+	// start..end[:step], e.g. 0..200, 1..10:2 or 0.0..1.0:0.1
+	numberRange = regexp.MustCompile(`^(-?\d+(?:\.\d+)?)\.\.(-?\d+(?:\.\d+)?)(?::(\d+(?:\.\d+)?))?$`)
+	// trailing PGE probability, e.g. <expr> <op> <expr> @0.3
+	probability = regexp.MustCompile(`^@(\d*\.?\d+)$`)
+	// trailing semantic condition, e.g. '(' <expr> <comp> <expr> ')' !distinct(2,4)
+	condition = regexp.MustCompile(`^!([a-z]+)\(([^()]*)\)$`)
+)
 
+// Parse reads a BNF grammar. Besides plain BNF it accepts '#' comments,
+// rules continued on indented or '|'-prefixed lines, quoted terminals,
+// inclusive numeric ranges with an optional step, trailing @probabilities and
+// !conditions, and EBNF groups ( ), optionals [ ] and repetitions { }, which
+// are desugared into generated rules.
+// %include directives are resolved relative to the working directory.
+func Parse(scanner bufio.Scanner) (genomes.Grammar, error) {
+	var sb strings.Builder
 	for scanner.Scan() {
-		sides := strings.Split(scanner.Text(), "::=") 
-		left := strings.Trim(sides[0], " ")
-		right := strings.Split(sides[1], "|")
-		var productions []genomes.Production
-		for _, s := range right {
-			s = strings.Trim(s, " ")
+		sb.WriteString(scanner.Text())
+		sb.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return genomes.Grammar{}, err
+	}
+
+	l := newLoader()
+	u, err := l.load(sb.String(), ".")
+	if err != nil {
+		return genomes.Grammar{}, err
+	}
+	return compose(u)
+}
+
+// ParseFile parses the grammar at path, resolving %include directives
+// relative to the including file.
+func ParseFile(path string) (genomes.Grammar, error) {
+	l := newLoader()
+	u, err := l.loadFile(path)
+	if err != nil {
+		return genomes.Grammar{}, err
+	}
+	return compose(u)
+}
+
+type parser struct {
+	tokens   []token
+	pos      int
+	rules    []genomes.Rule
+	includes []include
+	types    map[string]string
+	env      map[string]string
+	// pending holds the rules desugared from EBNF in the current rule
+	pending []genomes.Rule
+	// generated counts the rules desugared per parent rule, for naming
+	generated map[string]int
+}
+
+func (p *parser) peek(offset int) token {
+	if p.pos+offset < len(p.tokens) {
+		return p.tokens[p.pos+offset]
+	}
+	t := token{kind: tokEOF}
+	if len(p.tokens) > 0 {
+		last := p.tokens[len(p.tokens)-1]
+		t.line, t.col = last.line, last.col+len(last.text)
+	}
+	return t
+}
+
+func (p *parser) next() token {
+	t := p.peek(0)
+	p.pos++
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return &ParseError{Line: t.line, Col: t.col, Msg: fmt.Sprintf(format, args...)}
+}
+
+// atRuleStart reports whether the next tokens are "<name> ::=".
+func (p *parser) atRuleStart() bool {
+	return p.peek(0).kind == tokNonTerminal && p.peek(1).kind == tokDefine
+}
+
+// atDirective reports whether the next token is a %directive at the start of a line.
+func (p *parser) atDirective() bool {
+	t := p.peek(0)
+	return t.kind == tokWord && t.col == 1 && strings.HasPrefix(t.text, "%")
+}
+
+// parseGrammar parses one file's rules, collecting its %include directives
+// for the loader to resolve.
+func (p *parser) parseGrammar() ([]genomes.Rule, error) {
+	p.generated = map[string]int{}
+
+	for p.peek(0).kind != tokEOF {
+		if p.atDirective() {
+			if err := p.parseDirective(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !p.atRuleStart() {
+			t := p.peek(0)
+			return nil, p.errorf(t, "expected rule definition '<name> ::=', got %s %q", t.kind, t.text)
+		}
+
+		left := p.next()
+		p.next()
+
+		p.pending = nil
+		productions, err := p.parseAlternatives(left.text, tokEOF)
+		if err != nil {
+			return nil, err
+		}
+
+		// The rule goes before the ones desugared from it so the first rule
+		// in the file stays the start symbol.
+		p.rules = append(p.rules, genomes.Rule{Left: left.text, Productions: productions})
+		p.rules = append(p.rules, p.pending...)
+	}
 
-			matches := numberRange.FindStringSubmatch(s)
+	return p.rules, nil
+}
 
-			if matches != nil {
+// parseDirective parses `%include "path" [as namespace]`, `%type <name> type`
+// or `%env $NAME type`.
+func (p *parser) parseDirective() error {
+	d := p.next()
+	switch d.text {
+	case "%include":
+		return p.parseInclude(d)
+	case "%type", "%env":
+		return p.parseDeclaration(d)
+	}
+	return p.errorf(d, "unknown directive %s", d.text)
+}
 
-				start, _ := strconv.Atoi(matches[1])
-				end, _ := strconv.Atoi(matches[2])
+func (p *parser) parseInclude(d token) error {
+	path := p.next()
+	if path.kind != tokString || path.line != d.line {
+		return p.errorf(path, "expected quoted path after %%include")
+	}
+	inc := include{path: path.text, tok: d}
 
-				for i := start; i < end; i++ {
-					productions = append(productions, genomes.Production{Elements: []string{strconv.Itoa(i)}})
+	if t := p.peek(0); t.kind == tokWord && t.text == "as" && t.line == d.line {
+		p.next()
+		ns := p.next()
+		if ns.kind != tokWord || ns.line != d.line || nonTerminalLength("<"+ns.text+">", 0) != len(ns.text)+2 {
+			return p.errorf(ns, "expected namespace name after 'as'")
+		}
+		inc.namespace = ns.text
+	}
+
+	if err := p.endDirective(d); err != nil {
+		return err
+	}
+	p.includes = append(p.includes, inc)
+	return nil
+}
+
+func (p *parser) parseDeclaration(d token) error {
+	name := p.next()
+	if d.text == "%type" && (name.kind != tokNonTerminal || name.line != d.line) {
+		return p.errorf(name, "expected non-terminal after %%type")
+	}
+	if d.text == "%env" && (name.kind != tokWord || name.line != d.line) {
+		return p.errorf(name, "expected variable name after %%env")
+	}
+
+	t := p.next()
+	if t.kind != tokWord || t.line != d.line {
+		return p.errorf(t, "expected type after %s", name.text)
+	}
+	if !slices.Contains(types, t.text) {
+		return p.errorf(t, "unknown type %q, want one of %s", t.text, strings.Join(types, ", "))
+	}
+
+	if err := p.endDirective(d); err != nil {
+		return err
+	}
+	if d.text == "%type" {
+		p.types[ruleKey(name.text)] = t.text
+	} else {
+		p.env[name.text] = t.text
+	}
+	return nil
+}
+
+func (p *parser) endDirective(d token) error {
+	if t := p.peek(0); t.kind != tokEOF && t.line == d.line {
+		return p.errorf(t, "unexpected %s %q after %s", t.kind, t.text, d.text)
+	}
+	return nil
+}
+
+// parseAlternatives parses '|'-separated sequences until the closing token
+// (or, at the top level, the start of the next rule).
+func (p *parser) parseAlternatives(left string, closing tokenKind) ([]genomes.Production, error) {
+	var productions []genomes.Production
+
+	for {
+		alt, err := p.parseSequence(left, closing)
+		if err != nil {
+			return nil, err
+		}
+		productions = append(productions, alt...)
+
+		if p.peek(0).kind != tokBar {
+			break
+		}
+		p.next()
+	}
+
+	t := p.peek(0)
+	if closing == tokEOF {
+		if t.kind != tokEOF && !p.atRuleStart() && !p.atDirective() {
+			return nil, p.errorf(t, "unexpected %s %q", t.kind, t.text)
+		}
+	} else if t.kind != closing {
+		return nil, p.errorf(t, "expected %s, got %s %q", closing, t.kind, t.text)
+	}
+
+	return productions, nil
+}
+
+// parseSequence parses one alternative. A lone numeric range expands into
+// one production per value, so a slice is returned.
+func (p *parser) parseSequence(left string, closing tokenKind) ([]genomes.Production, error) {
+	var elements []string
+	var conditions []genomes.Condition
+	var conditionTokens []token
+	prob := 0.0
+	start := p.peek(0)
+
+	for !p.endsSequence(closing) {
+		t := p.next()
+
+		// Continuation lines are indented or start with '|', so anything in
+		// the first column would silently extend the previous rule.
+		if t.col == 1 {
+			if t.kind == tokNonTerminal {
+				return nil, p.errorf(t, "expected '::=' after %s", t.text)
+			}
+			return nil, p.errorf(t, "unexpected %s %q in the first column; indent continuation lines", t.kind, t.text)
+		}
+
+		switch t.kind {
+		case tokNonTerminal:
+			elements = append(elements, t.text)
+		case tokString:
+			if t.text != "" {
+				elements = append(elements, t.text)
+			}
+		case tokWord:
+			if m := probability.FindStringSubmatch(t.text); m != nil {
+				prob, _ = strconv.ParseFloat(m[1], 64)
+				continue
+			}
+			if m := condition.FindStringSubmatch(t.text); m != nil {
+				args := strings.Split(strings.ReplaceAll(m[2], " ", ""), ",")
+				c, err := genomes.ParseCondition(m[1], args)
+				if err != nil {
+					return nil, p.errorf(t, "%v", err)
 				}
+				conditions = append(conditions, c)
+				conditionTokens = append(conditionTokens, t)
 				continue
 			}
+			if m := numberRange.FindStringSubmatch(t.text); m != nil {
+				if len(elements) > 0 || !p.endsSequence(closing) {
+					return nil, p.errorf(t, "range %q must be the only element of its alternative", t.text)
+				}
+				return p.expandRange(m, t)
+			}
+			elements = append(elements, t.text)
+		case tokLParen, tokLBracket, tokLBrace:
+			nt, err := p.parseGroup(left, t)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, nt)
+		default:
+			return nil, p.errorf(t, "unexpected %s %q", t.kind, t.text)
+		}
+	}
 
-			var elements []string
-			for e := range strings.SplitSeq(s, " ") {
-				elements = append(elements, e)
+	if prob < 0 || prob > 1 {
+		return nil, p.errorf(start, "probability %f is outside [0, 1]", prob)
+	}
+	for i, c := range conditions {
+		for _, e := range c.Elements {
+			if e >= len(elements) {
+				return nil, p.errorf(conditionTokens[i], "condition %s refers to element %d of %d", c, e+1, len(elements))
 			}
-			productions = append(productions, genomes.Production{Elements: elements})
 		}
-		grammar.Rules = append(grammar.Rules, genomes.Rule{Left: left, Productions: productions})
 	}
-	return grammar
+
+	return []genomes.Production{{Elements: elements, Probability: prob, Conditions: conditions}}, nil
+}
+
+func (p *parser) endsSequence(closing tokenKind) bool {
+	t := p.peek(0)
+	return t.kind == tokEOF || t.kind == tokBar || t.kind == closing ||
+		(closing == tokEOF && (p.atRuleStart() || p.atDirective()))
+}
+
+// parseGroup desugars ( ), [ ] or { } into a generated rule and returns its name.
+func (p *parser) parseGroup(left string, open token) (string, error) {
+	closing := map[tokenKind]tokenKind{tokLParen: tokRParen, tokLBracket: tokRBracket, tokLBrace: tokRBrace}[open.kind]
+
+	alternatives, err := p.parseAlternatives(left, closing)
+	if err != nil {
+		return "", err
+	}
+	p.next()
+
+	p.generated[left]++
+	suffix := map[tokenKind]string{tokLParen: "grp", tokLBracket: "opt", tokLBrace: "rep"}[open.kind]
+	// Groups inside a template take the template's parameters too, so each
+	// instantiation gets its own copy.
+	base, params := splitCall(left)
+	name := joinCall(fmt.Sprintf("%s_%s%d", base, suffix, p.generated[left]), params)
+
+	switch open.kind {
+	case tokLBracket:
+		alternatives = append(alternatives, genomes.Production{})
+	case tokLBrace:
+		for i := range alternatives {
+			alternatives[i].Elements = append(alternatives[i].Elements, name)
+		}
+		alternatives = append(alternatives, genomes.Production{})
+	}
+
+	p.pending = append(p.pending, genomes.Rule{Left: name, Productions: alternatives})
+	return name, nil
+}
+
+// expandRange turns an inclusive start..end[:step] range into one production
+// per value, formatted with as many decimals as the bounds and step use.
+func (p *parser) expandRange(m []string, t token) ([]genomes.Production, error) {
+	decimals := 0
+	for _, s := range m[1:] {
+		if i := strings.IndexByte(s, '.'); i >= 0 {
+			decimals = max(decimals, len(s)-i-1)
+		}
+	}
+
+	start, _ := strconv.ParseFloat(m[1], 64)
+	end, _ := strconv.ParseFloat(m[2], 64)
+	step := 1.0
+	if decimals > 0 && m[3] == "" {
+		step = math.Pow(10, -float64(decimals))
+	}
+	if m[3] != "" {
+		step, _ = strconv.ParseFloat(m[3], 64)
+	}
+
+	if step <= 0 {
+		return nil, p.errorf(t, "range %q has a non-positive step", t.text)
+	}
+	if start > end {
+		return nil, p.errorf(t, "range %q is empty: start is after end", t.text)
+	}
+
+	var productions []genomes.Production
+	count := int(math.Floor((end-start)/step+1e-9)) + 1
+	for i := range count {
+		value := strconv.FormatFloat(start+float64(i)*step, 'f', decimals, 64)
+		productions = append(productions, genomes.Production{Elements: []string{value}})
+	}
+	return productions, nil
 }
@@ -2,7 +2,7 @@ package grammar_test
 
 import (
 	"bufio"
-	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -10,19 +10,187 @@ import (
 	"github.com/danielkennedy1/sieve/problems/grammar"
 )
 
+func parseString(t *testing.T, s string) genomes.Grammar {
+	t.Helper()
+	gr, err := grammar.Parse(*bufio.NewScanner(strings.NewReader(s)))
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	return gr
+}
+
+func elements(gr genomes.Grammar, left string) []string {
+	var out []string
+	for _, r := range gr.Rules {
+		if r.Left == left {
+			for _, p := range r.Productions {
+				out = append(out, strings.Join(p.Elements, " "))
+			}
+		}
+	}
+	return out
+}
+
 func TestParser(t *testing.T) {
 	want := genomes.NewTestLectureExampleGrammar()
 
-	s := 
-`<expr> ::= <expr> <op> <expr> | <var>
+	s :=
+		`<expr> ::= <expr> <op> <expr> | <var>
 <op> ::= + | - | * | /
 <var> ::= <prc> | <input>
 <input> ::= a | b
 <prc> ::= 0.0 | 0.1 | 0.2 | 0.3 | 0.4 | 0.5`
-	scanner := bufio.NewScanner(strings.NewReader(s))
 
-	got := grammar.Parse(*scanner)
+	got := parseString(t, s)
+
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Parsed grammar differs.\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParserProbabilities(t *testing.T) {
+	s := `<expr> ::= <expr> <op> <expr> @0.3 | <var> @0.7
+<op> ::= + | -`
+
+	got := parseString(t, s)
+
+	expr := got.Rules[0].Productions
+	if len(expr[0].Elements) != 3 || expr[0].Probability != 0.3 || expr[1].Probability != 0.7 {
+		t.Errorf("Probabilities not parsed: %+v", expr)
+	}
+	if got.Rules[1].Productions[0].Probability != 0 {
+		t.Errorf("Unannotated production should have no probability, got %f", got.Rules[1].Productions[0].Probability)
+	}
+}
+
+func TestParserConditions(t *testing.T) {
+	got := parseString(t, `<cmp> ::= '(' <v> > <v> ')' !distinct(2, 4) !sametype(2,4) | <v> !range(1,0,10)
+<v> ::= $PRICE | 5`)
+
+	cmp := got.Rules[0].Productions
+	if len(cmp[0].Elements) != 5 || len(cmp[0].Conditions) != 2 || len(cmp[1].Conditions) != 1 {
+		t.Fatalf("Conditions not parsed: %+v", cmp)
+	}
+	if c := cmp[0].Conditions[0]; c.Kind != genomes.Distinct || !reflect.DeepEqual(c.Elements, []int{1, 3}) {
+		t.Errorf("Unexpected condition %+v", c)
+	}
+	if c := cmp[1].Conditions[0]; c.Kind != genomes.InRange || c.Min != 0 || c.Max != 10 {
+		t.Errorf("Unexpected condition %+v", c)
+	}
+}
+
+func TestParserLayoutAndQuoting(t *testing.T) {
+	s := `
+# Trading strategy
+<strategy> ::= '(' '"' SELL <n> '"' ')'   # quoted parens are terminals
+             | "HOLD | WAIT"
+
+<n> ::= 1..3
+      | 10..20:5
+<w> ::= 0.0..0.3:0.1 | 'it''s' | 'a\'b'
+`
+	got := parseString(t, s)
+
+	tests := map[string][]string{
+		"<strategy>": {`( " SELL <n> " )`, "HOLD | WAIT"},
+		"<n>":        {"1", "2", "3", "10", "15", "20"},
+		"<w>":        {"0.0", "0.1", "0.2", "0.3", "it s", "a'b"},
+	}
+	for left, want := range tests {
+		if got := elements(got, left); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", left, got, want)
+		}
+	}
+}
+
+func TestParserEBNF(t *testing.T) {
+	s := `<call> ::= f '(' [ <arg> { , <arg> } ] ')' | ( g | h ) x
+<arg> ::= a | b`
+
+	got := parseString(t, s)
+
+	if got.Rules[0].Left != "<call>" {
+		t.Fatalf("Start rule should stay first, got %s", got.Rules[0].Left)
+	}
+
+	tests := map[string][]string{
+		"<call>":      {"f ( <call_opt2> )", "<call_grp3> x"},
+		"<call_rep1>": {", <arg> <call_rep1>", ""},
+		"<call_opt2>": {"<arg> <call_rep1>", ""},
+		"<call_grp3>": {"g", "h"},
+	}
+	for left, want := range tests {
+		if got := elements(got, left); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, want %q", left, got, want)
+		}
+	}
+
+	if !genomes.ValidateGrammar(got) {
+		t.Errorf("Desugared grammar should be valid:\n%s", got)
+	}
+
+	gr := got
+	gr.BuildRuleMap()
+	// f, <arg>=a, repeat ", <arg>"=b twice, then stop
+	g := genomes.Genotype{Genes: []uint32{0, 0, 0, 0, 1, 0, 1, 1}}
+	if phenotype := g.MapToGrammar(gr, 20).String(); phenotype != "f ( a , b , b )" {
+		t.Errorf("Got phenotype %q, want %q", phenotype, "f ( a , b , b )")
+	}
+}
+
+func TestParserErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"foo bar\n<a> ::= x", "1:1: expected rule definition"},
+		{"<a> ::= x\n<b> y", "2:1: expected '::=' after <b>"},
+		{"<a> ::= x\ny", "2:1: unexpected terminal \"y\" in the first column"},
+		{"<a> ::= x\n'y'", "2:1: unexpected quoted terminal \"y\" in the first column"},
+		{"<a> ::= ( x | y", "1:16: expected ')'"},
+		{"<a> ::= x )", "1:11: unexpected ')'"},
+		{"<a> ::= 'x", "1:9: unterminated quoted terminal"},
+		{"<a> ::= 5..1", "1:9: range \"5..1\" is empty"},
+		{"<a> ::= x 1..3", "1:11: range \"1..3\" must be the only element"},
+		{"# nothing here", "1:1: grammar has no rules"},
+		{"<a> ::= x y !distinct(1,3)", "1:13: condition !distinct(1,3) refers to element 3 of 2"},
+		{"<a> ::= x !unique(1)", "1:11: unknown condition \"unique\""},
+	}
+
+	for _, tt := range tests {
+		_, err := grammar.Parse(*bufio.NewScanner(strings.NewReader(tt.src)))
+		if err == nil {
+			t.Errorf("Expected error for %q", tt.src)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Got error %q for %q, want it to contain %q", err, tt.src, tt.want)
+		}
+	}
+}
+
+func TestParseDataGrammars(t *testing.T) {
+	for _, path := range []string{"../../data/lecture.bnf", "../../data/market.bnf", "../../data/sensible_market.bnf"} {
+		gr, err := grammar.ParseFile(path)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if report := genomes.AnalyseGrammar(gr); report.HasErrors() {
+			t.Errorf("%s has errors:\n%s", path, report)
+		}
+	}
+}
+
+func TestGrammarStringRoundTrip(t *testing.T) {
+	want := parseString(t, `<s> ::= '(' '"' SELL <n> '"' ')' @0.4 | [ x ] 'a b' @0.6 !distinct(1,2)
+<n> ::= 1..3 | $X
+%type <n> float
+%env $X float`)
+
+	got := parseString(t, want.String())
 
-	fmt.Println(want)
-	fmt.Println(got)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Round trip changed grammar.\ngot:\n%s\nwant:\n%s", got, want)
+	}
 }
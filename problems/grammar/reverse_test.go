@@ -0,0 +1,56 @@
+package grammar_test
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+	"github.com/danielkennedy1/sieve/problems/grammar"
+)
+
+func TestSeedMarketStrategies(t *testing.T) {
+	tests := []struct {
+		file     string
+		strategy string
+	}{
+		{
+			"../../data/sensible_market.bnf",
+			`( ( $PRICE / $FUNDAMENTAL ) > 1.1 ) ? ( " SELL 9 " ) : ( ( $PRICE > $FUNDAMENTAL ) ? ( " BUY 6 " ) : ( " HOLD " ) )`,
+		},
+		{
+			"../../data/market.bnf",
+			`(($RSI >= 70) and ($PRICE <= (1.0 * $FUNDAMENTAL))) ? ("SELL 20") : (($RSI <= 30) ? ("BUY 20") : ("HOLD"))`,
+		},
+	}
+
+	rng := rand.New(rand.NewPCG(0, 0))
+	for _, tt := range tests {
+		gr, err := grammar.ParseFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		g, err := genomes.GenotypeFromPhenotype(gr, tt.strategy, 100, genomes.Codon8, 200, rng)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+
+		tree, _ := genomes.ParsePhenotype(gr, tt.strategy)
+		if got := g.MapToGrammar(gr, 200).String(); got != tree.String() {
+			t.Errorf("%s: seed maps to %q, want %q", tt.file, got, tree.String())
+		}
+	}
+}
+
+func TestSeedBreakingConditions(t *testing.T) {
+	gr, err := grammar.ParseFile("../../data/sensible_market.bnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Comparing a price with itself breaks !distinct in the compare template
+	strategy := `( ( $PRICE / $FUNDAMENTAL ) > 1.1 ) ? ( " SELL 9 " ) : ( ( $PRICE > $PRICE ) ? ( " BUY 6 " ) : ( " HOLD " ) )`
+	if _, err := genomes.GenotypeFromPhenotype(gr, strategy, 100, genomes.Codon8, 200, rand.New(rand.NewPCG(0, 0))); err == nil {
+		t.Error("Expected a strategy breaking a grammar condition to be rejected")
+	}
+}
@@ -0,0 +1,263 @@
+package grammar
+
+import (
+	"math"
+
+	"github.com/danielkennedy1/sieve/genomes"
+	"github.com/expr-lang/expr/ast"
+	exprparser "github.com/expr-lang/expr/parser"
+)
+
+// maxSimplifyPasses bounds how often the rewrite rules are reapplied; each
+// pass can expose more (e.g. reordering lines up duplicate operands).
+const maxSimplifyPasses = 10
+
+// mirrored maps a comparison to the one that holds with operands swapped.
+var mirrored = map[string]string{
+	"<": ">", ">": "<", "<=": ">=", ">=": "<=", "==": "==", "!=": "!=",
+}
+
+// Simplify rewrites a phenotype into a smaller equivalent expr-lang program:
+// constants are folded, comparisons of an operand with itself become true or
+// false, ternaries with a known or repeated condition lose their dead branch,
+// and operands of commutative operators are put in a canonical order, so
+// equivalent strategies simplify to the same string. Phenotypes are assumed
+// free of side effects and NaN.
+func Simplify(phenotype string) (string, error) {
+	tree, err := exprparser.Parse(phenotype)
+	if err != nil {
+		return "", err
+	}
+
+	s := tree.Node.String()
+	for range maxSimplifyPasses {
+		ast.Walk(&tree.Node, simplifier{})
+		next := tree.Node.String()
+		if next == s {
+			break
+		}
+		s = next
+	}
+	return s, nil
+}
+
+// NewSimplifiedKey keys genotypes by their simplified phenotype, so the
+// fitness cache is shared by genotypes deriving equivalent strategies.
+// Phenotypes expr cannot parse are keyed as they are.
+func NewSimplifiedKey(gr genomes.Grammar, maxReproductions int) func(g genomes.Genotype) string {
+	return func(g genomes.Genotype) string {
+		phenotype := g.MapToGrammar(gr, maxReproductions).String()
+		if s, err := Simplify(phenotype); err == nil {
+			return s
+		}
+		return phenotype
+	}
+}
+
+// simplifier rewrites each node after its children, so the rules below only
+// need to look one level down.
+type simplifier struct{}
+
+func (simplifier) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.UnaryNode:
+		*node = simplifyUnary(n)
+	case *ast.BinaryNode:
+		*node = simplifyBinary(n)
+	case *ast.ConditionalNode:
+		*node = simplifyConditional(n)
+	}
+}
+
+func simplifyUnary(n *ast.UnaryNode) ast.Node {
+	switch n.Operator {
+	case "-":
+		if v, isInt, ok := number(n.Node); ok {
+			return numberNode(-v, isInt)
+		}
+	case "not", "!":
+		if b, ok := n.Node.(*ast.BoolNode); ok {
+			return &ast.BoolNode{Value: !b.Value}
+		}
+		if inner, ok := n.Node.(*ast.UnaryNode); ok && (inner.Operator == "not" || inner.Operator == "!") {
+			return inner.Node
+		}
+	}
+	return n
+}
+
+func simplifyBinary(n *ast.BinaryNode) ast.Node {
+	if folded, ok := fold(n); ok {
+		return folded
+	}
+
+	same := n.Left.String() == n.Right.String()
+	switch n.Operator {
+	case "==", ">=", "<=":
+		if same {
+			return &ast.BoolNode{Value: true}
+		}
+	case "!=", ">", "<":
+		if same {
+			return &ast.BoolNode{Value: false}
+		}
+	case "and", "&&", "or", "||":
+		if same {
+			return n.Left
+		}
+		if short, ok := shortCircuit(n); ok {
+			return short
+		}
+	}
+
+	return canonical(n)
+}
+
+// fold evaluates operators whose operands are both literals.
+func fold(n *ast.BinaryNode) (ast.Node, bool) {
+	if l, ok := n.Left.(*ast.BoolNode); ok {
+		if r, ok := n.Right.(*ast.BoolNode); ok {
+			switch n.Operator {
+			case "and", "&&":
+				return &ast.BoolNode{Value: l.Value && r.Value}, true
+			case "or", "||":
+				return &ast.BoolNode{Value: l.Value || r.Value}, true
+			case "==":
+				return &ast.BoolNode{Value: l.Value == r.Value}, true
+			case "!=":
+				return &ast.BoolNode{Value: l.Value != r.Value}, true
+			}
+		}
+		return nil, false
+	}
+
+	l, lInt, ok := number(n.Left)
+	if !ok {
+		return nil, false
+	}
+	r, rInt, ok := number(n.Right)
+	if !ok {
+		return nil, false
+	}
+
+	isInt := lInt && rInt
+	var v float64
+	switch n.Operator {
+	case "+":
+		v = l + r
+	case "-":
+		v = l - r
+	case "*":
+		v = l * r
+	case "/":
+		v, isInt = l/r, false
+	case "<":
+		return &ast.BoolNode{Value: l < r}, true
+	case ">":
+		return &ast.BoolNode{Value: l > r}, true
+	case "<=":
+		return &ast.BoolNode{Value: l <= r}, true
+	case ">=":
+		return &ast.BoolNode{Value: l >= r}, true
+	case "==":
+		return &ast.BoolNode{Value: l == r}, true
+	case "!=":
+		return &ast.BoolNode{Value: l != r}, true
+	default:
+		return nil, false
+	}
+
+	// Leave division by zero and overflow to run time
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return nil, false
+	}
+	return numberNode(v, isInt), true
+}
+
+// shortCircuit drops a boolean literal operand of and/or.
+func shortCircuit(n *ast.BinaryNode) (ast.Node, bool) {
+	and := n.Operator == "and" || n.Operator == "&&"
+	for _, pair := range [][2]ast.Node{{n.Left, n.Right}, {n.Right, n.Left}} {
+		b, ok := pair[0].(*ast.BoolNode)
+		if !ok {
+			continue
+		}
+		if b.Value == and {
+			return pair[1], true
+		}
+		return b, true
+	}
+	return nil, false
+}
+
+// canonical orders the operands of commutative operators and comparisons by
+// their printed form, mirroring comparisons as needed.
+func canonical(n *ast.BinaryNode) ast.Node {
+	l, r := n.Left.String(), n.Right.String()
+	if l <= r {
+		return n
+	}
+
+	op := n.Operator
+	switch op {
+	case "*", "and", "&&", "or", "||":
+	case "+":
+		// + also concatenates strings, which does not commute
+		if hasString(n.Left) || hasString(n.Right) {
+			return n
+		}
+	default:
+		var ok bool
+		if op, ok = mirrored[op]; !ok {
+			return n
+		}
+	}
+	return &ast.BinaryNode{Operator: op, Left: n.Right, Right: n.Left}
+}
+
+func simplifyConditional(n *ast.ConditionalNode) ast.Node {
+	if b, ok := n.Cond.(*ast.BoolNode); ok {
+		if b.Value {
+			return n.Exp1
+		}
+		return n.Exp2
+	}
+
+	// A nested ternary on the same condition always takes the same branch
+	cond := n.Cond.String()
+	if inner, ok := n.Exp1.(*ast.ConditionalNode); ok && inner.Cond.String() == cond {
+		n.Exp1 = inner.Exp1
+	}
+	if inner, ok := n.Exp2.(*ast.ConditionalNode); ok && inner.Cond.String() == cond {
+		n.Exp2 = inner.Exp2
+	}
+
+	if n.Exp1.String() == n.Exp2.String() {
+		return n.Exp1
+	}
+	return n
+}
+
+func number(n ast.Node) (float64, bool, bool) {
+	switch n := n.(type) {
+	case *ast.IntegerNode:
+		return float64(n.Value), true, true
+	case *ast.FloatNode:
+		return n.Value, false, true
+	}
+	return 0, false, false
+}
+
+func numberNode(v float64, isInt bool) ast.Node {
+	if isInt {
+		return &ast.IntegerNode{Value: int(v)}
+	}
+	return &ast.FloatNode{Value: v}
+}
+
+func hasString(n ast.Node) bool {
+	return ast.Find(n, func(n ast.Node) bool {
+		_, ok := n.(*ast.StringNode)
+		return ok
+	}) != nil
+}
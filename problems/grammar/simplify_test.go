@@ -0,0 +1,102 @@
+package grammar_test
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+	"github.com/danielkennedy1/sieve/problems/grammar"
+	"github.com/expr-lang/expr"
+)
+
+func TestSimplify(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"( 1 + 2 * 3 ) > ( $PRICE / 2.5 )", "$PRICE / 2.5 < 7"},
+		{"( $PRICE > $PRICE ) or ( $RSI < 30 )", "$RSI < 30"},
+		{"30 > $RSI", "$RSI < 30"},
+		{"( $PRICE >= $PRICE ) and ( $RSI != $RSI )", "false"},
+		{"not not ( $A and true )", "$A"},
+		{"( $B + $A ) * ( $A + $B )", "($A + $B) * ($A + $B)"},
+		{`" SELL " + $X`, `" SELL " + $X`},
+		{"$PRICE / 0", "$PRICE / 0"},
+		{`( 1 < 2 ) ? ( " BUY 6 " ) : ( " HOLD " )`, `" BUY 6 "`},
+		{`( $RSI < 30 ) ? ( " SELL 9 " ) : ( ( $RSI < 30 ) ? ( " BUY 6 " ) : ( " HOLD " ) )`, `$RSI < 30 ? " SELL 9 " : " HOLD "`},
+		{`( $PRICE > $SMA ) ? ( " HOLD " ) : ( " HOLD " )`, `" HOLD "`},
+	}
+
+	for _, tt := range tests {
+		got, err := grammar.Simplify(tt.in)
+		if err != nil {
+			t.Fatalf("Simplify(%q): %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("Simplify(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	if _, err := grammar.Simplify("( $PRICE >"); err == nil {
+		t.Errorf("Expected an error for an unparseable phenotype")
+	}
+}
+
+func TestSimplifyPreservesMarketStrategies(t *testing.T) {
+	gr, err := grammar.ParseFile("../../data/market.bnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rng := rand.New(rand.NewPCG(5, 6))
+	create := genomes.NewCreateGenotype(100, rng)
+	for range 200 {
+		strategy := create().MapToGrammar(gr, 100).String()
+		simplified, err := grammar.Simplify(strategy)
+		if err != nil {
+			t.Fatalf("Simplify(%q): %v", strategy, err)
+		}
+		if len(simplified) > len(strategy) {
+			t.Errorf("Simplify(%q) grew to %q", strategy, simplified)
+		}
+
+		for range 5 {
+			env := map[string]any{
+				"$PRICE":       rng.Float64() * 200,
+				"$RSI":         rng.Float64() * 100,
+				"$HOLDINGS":    rng.IntN(20),
+				"$PROGRESS":    rng.Float64(),
+				"$FUNDAMENTAL": rng.Float64() * 200,
+				"$SMA":         rng.Float64() * 200,
+				"$ATR":         rng.Float64() * 10,
+				"$VOLUME":      rng.IntN(100),
+				"$CASH":        rng.Float64() * 1000,
+				"$RANDOM":      rng.Float64(),
+			}
+			want, err := expr.Eval(strategy, env)
+			if err != nil {
+				t.Fatalf("Eval(%q): %v", strategy, err)
+			}
+			got, err := expr.Eval(simplified, env)
+			if err != nil {
+				t.Fatalf("Eval(%q): %v", simplified, err)
+			}
+			if got != want {
+				t.Fatalf("%q gave %v but simplified %q gave %v", strategy, want, simplified, got)
+			}
+		}
+	}
+}
+
+func TestSimplifiedKey(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	key := grammar.NewSimplifiedKey(gr, 20)
+
+	// <expr> <op> <expr> with the operands swapped: a + b and b + a
+	g1 := genomes.Genotype{Genes: []uint32{0, 1, 1, 0, 0, 1, 1, 1}}
+	g2 := genomes.Genotype{Genes: []uint32{0, 1, 1, 1, 0, 1, 1, 0}}
+	p1, p2 := g1.MapToGrammar(gr, 20).String(), g2.MapToGrammar(gr, 20).String()
+	if p1 == p2 {
+		t.Fatalf("Expected different phenotypes, got %q twice", p1)
+	}
+	if key(g1) != key(g2) {
+		t.Errorf("Expected %q and %q to share a key, got %q and %q", p1, p2, key(g1), key(g2))
+	}
+}
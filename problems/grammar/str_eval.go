@@ -6,6 +6,7 @@ import (
 	"math"
 
 	"github.com/danielkennedy1/sieve/genomes"
+	"github.com/danielkennedy1/sieve/problems/regression"
 	"github.com/expr-lang/expr"
 )
 
@@ -80,38 +81,120 @@ func GenerateSamples(exprStr string, numSamples int, variables []float64, gr gen
 func NewRMSE(samples []Sample, gr genomes.Grammar, parsimonyPenalty float64, maxReproductions int) func(g genomes.Genotype) float64 {
 
 	return func(g genomes.Genotype) float64 {
-		varMap := genomes.BuildVarMapFromGrammar(gr)
-		exprStr := g.MapToGrammar(gr, maxReproductions).String()
+		tree := g.MapToGrammar(gr, maxReproductions)
+		if !tree.Valid() {
+			return math.Inf(-1)
+		}
+		return rmse(tree.String(), samples, gr, parsimonyPenalty)
+	}
+}
 
-		lengthPenalty := float64(len(exprStr)) * parsimonyPenalty
+// NewTreeRMSE is NewRMSE for CFG-GP derivation trees.
+func NewTreeRMSE(samples []Sample, gr genomes.Grammar, parsimonyPenalty float64) func(t genomes.DerivationTree) float64 {
+	return func(t genomes.DerivationTree) float64 {
+		if !t.Valid() {
+			return math.Inf(-1)
+		}
+		return rmse(t.String(), samples, gr, parsimonyPenalty)
+	}
+}
 
-		program, err := expr.Compile(exprStr, expr.AllowUndefinedVariables())
-		if err != nil {
+// rmse scores a phenotype by its negated root mean squared error over the
+// samples, less the length penalty.
+func rmse(exprStr string, samples []Sample, gr genomes.Grammar, parsimonyPenalty float64) float64 {
+	return score(exprStr, samples, gr, regression.RMSE.Fitness, parsimonyPenalty)
+}
+
+// NewRegressionFitness is NewRMSE scored by fitness, e.g. a
+// regression.NewFitness metric, instead of RMSE.
+func NewRegressionFitness(samples []Sample, gr genomes.Grammar, fitness func(predictions, targets []float64) float64, parsimonyPenalty float64, maxReproductions int) func(g genomes.Genotype) float64 {
+	return func(g genomes.Genotype) float64 {
+		tree := g.MapToGrammar(gr, maxReproductions)
+		if !tree.Valid() {
 			return math.Inf(-1)
 		}
+		return score(tree.String(), samples, gr, fitness, parsimonyPenalty)
+	}
+}
+
+// NewTreeRegressionFitness is NewRegressionFitness for CFG-GP derivation
+// trees.
+func NewTreeRegressionFitness(samples []Sample, gr genomes.Grammar, fitness func(predictions, targets []float64) float64, parsimonyPenalty float64) func(t genomes.DerivationTree) float64 {
+	return func(t genomes.DerivationTree) float64 {
+		if !t.Valid() {
+			return math.Inf(-1)
+		}
+		return score(t.String(), samples, gr, fitness, parsimonyPenalty)
+	}
+}
 
-		total := 0.0
-		env := map[string]interface{}{}
+// score rates a phenotype's predictions over the samples with fitness, less
+// the length penalty. Phenotypes that fail to compile or run, or give NaN,
+// score -Inf.
+func score(exprStr string, samples []Sample, gr genomes.Grammar, fitness func(predictions, targets []float64) float64, parsimonyPenalty float64) float64 {
+	lengthPenalty := float64(len(exprStr)) * parsimonyPenalty
 
-		for _, s := range samples {
-			for name, idx := range varMap {
-				env[name] = s.Variables[idx]
-			}
+	predictions, ok := Predict(exprStr, samples, gr)
+	if !ok {
+		return math.Inf(-1)
+	}
 
-			out, err := expr.Run(program, env)
-			if math.IsNaN(out.(float64)) {
-				return math.Inf(-1)
-			}
-			if err != nil {
-				return math.Inf(-1)
-			}
+	targets := make([]float64, len(samples))
+	for i, s := range samples {
+		targets[i] = s.Output
+	}
+	return fitness(predictions, targets) - lengthPenalty
+}
 
-			diff := out.(float64) - s.Output
-			total += diff * diff
+// mathFunctions are available to symbolic regression phenotypes: the unary
+// expression tree functions, with log and sqrt protected as for trees, and
+// pdiv, division protected likewise.
+var mathFunctions = map[string]any{
+	"pdiv": func(a, b float64) float64 {
+		if b == 0 {
+			return 1
 		}
+		return a / b
+	},
+	"sin":  math.Sin,
+	"cos":  math.Cos,
+	"exp":  math.Exp,
+	"log":  func(x float64) float64 { return genomes.Log.Apply([]float64{x}) },
+	"sqrt": func(x float64) float64 { return genomes.Sqrt.Apply([]float64{x}) },
+	"abs":  math.Abs,
+	"neg":  func(x float64) float64 { return -x },
+}
 
-		rmse := math.Sqrt(total / float64(len(samples)))
+// Predict evaluates a phenotype on each sample, or reports false if it fails
+// to compile or run, or gives NaN.
+func Predict(exprStr string, samples []Sample, gr genomes.Grammar) ([]float64, bool) {
+	varMap := genomes.BuildVarMapFromGrammar(gr)
 
-		return -rmse - lengthPenalty
+	program, err := expr.Compile(exprStr, compileOptions(gr, "float", expr.AllowUndefinedVariables())...)
+	if err != nil {
+		return nil, false
+	}
+
+	predictions := make([]float64, len(samples))
+	env := map[string]interface{}{}
+	for name, f := range mathFunctions {
+		env[name] = f
+	}
+
+	for i, s := range samples {
+		for name, idx := range varMap {
+			env[name] = s.Variables[idx]
+		}
+
+		out, err := expr.Run(program, env)
+		if err != nil {
+			return nil, false
+		}
+		v, ok := out.(float64)
+		if !ok || math.IsNaN(v) {
+			return nil, false
+		}
+		predictions[i] = v
 	}
+	return predictions, true
 }
@@ -1,9 +1,11 @@
 package grammar
 
 import (
+	"math"
 	"testing"
 
 	"github.com/danielkennedy1/sieve/genomes"
+	"github.com/danielkennedy1/sieve/problems/regression"
 )
 
 func TestRMSEfromGrammar(t *testing.T) {
@@ -11,7 +13,7 @@ func TestRMSEfromGrammar(t *testing.T) {
 	grammar := genomes.NewTestLectureExampleGrammar()
 
 	genotype := genomes.Genotype{
-		Genes: []uint8{220, 149, 147, 220, 144, 55, 36, 170},
+		Genes: []uint32{220, 149, 147, 220, 144, 55, 36, 170},
 	}
 	// a + 0.2
 	samples := []Sample{
@@ -30,3 +32,76 @@ func TestRMSEfromGrammar(t *testing.T) {
 		t.Errorf("Got RMSE %f, want %f", got, want)
 	}
 }
+
+func TestTreeRMSE(t *testing.T) {
+	grammar := genomes.NewTestLectureExampleGrammar()
+
+	root, err := genomes.ParsePhenotype(grammar, "a + 0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := []Sample{
+		{Variables: []float64{0, 0}, Output: 0.2},
+		{Variables: []float64{4, 0}, Output: 4.2},
+	}
+
+	got := NewTreeRMSE(samples, grammar, 0.001)(genomes.DerivationTree{Root: root})
+	if want := -0.007; got != want {
+		t.Errorf("Got RMSE %f, want %f", got, want)
+	}
+}
+
+func TestTreeRegressionFitnessLinearScaling(t *testing.T) {
+	grammar := genomes.NewTestLectureExampleGrammar()
+
+	root, err := genomes.ParsePhenotype(grammar, "a + 0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3a + 1 is a + 0.2 scaled by 3 and shifted by 0.4
+	samples := []Sample{
+		{Variables: []float64{0, 0}, Output: 1},
+		{Variables: []float64{4, 0}, Output: 13},
+		{Variables: []float64{2, 0}, Output: 7},
+	}
+	tree := genomes.DerivationTree{Root: root}
+
+	unscaled := NewTreeRegressionFitness(samples, grammar, regression.NewFitness(regression.MAE, false), 0)(tree)
+	if want := -(0.8 + 8.8 + 4.8) / 3; math.Abs(unscaled-want) > 1e-9 {
+		t.Errorf("Got MAE fitness %f, want %f", unscaled, want)
+	}
+
+	scaled := NewTreeRegressionFitness(samples, grammar, regression.NewFitness(regression.MAE, true), 0.001)(tree)
+	if want := -0.007; math.Abs(scaled-want) > 1e-9 {
+		t.Errorf("Got scaled MAE fitness %f, want %f", scaled, want)
+	}
+}
+
+func TestRegressionMathFunctions(t *testing.T) {
+	grammar := genomes.NewTestLectureExampleGrammar()
+	samples := []Sample{
+		{Variables: []float64{0, 0}},
+		{Variables: []float64{2, 0}},
+	}
+	for i := range samples {
+		a := samples[i].Variables[0]
+		samples[i].Output = math.Sin(a) + math.Exp(a) + math.Log(a+1)
+	}
+
+	got := score("sin ( a ) + exp ( a ) + log ( a + 1.0 )", samples, grammar, regression.RMSE.Fitness, 0)
+	if math.Abs(got) > 1e-12 {
+		t.Errorf("Got RMSE fitness %f, want 0", got)
+	}
+	zero := []Sample{{Variables: []float64{0, 0}, Output: 0}}
+	if got := score("log ( a )", zero, grammar, regression.RMSE.Fitness, 0); got != 0 {
+		t.Errorf("log should be protected at 0, got fitness %f", got)
+	}
+	two := []Sample{{Variables: []float64{2, 0}, Output: -2}}
+	if got := score("neg ( abs ( a ) )", two, grammar, regression.RMSE.Fitness, 0); got != 0 {
+		t.Errorf("Got RMSE fitness %f for neg and abs, want 0", got)
+	}
+	one := []Sample{{Variables: []float64{0, 0}, Output: 1}}
+	if got := score("pdiv ( 2.0 , a )", one, grammar, regression.RMSE.Fitness, 0); got != 0 {
+		t.Errorf("pdiv should be 1 dividing by 0, got fitness %f", got)
+	}
+}
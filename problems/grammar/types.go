@@ -0,0 +1,191 @@
+package grammar
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/danielkennedy1/sieve/genomes"
+	"github.com/expr-lang/expr"
+)
+
+// types are the expression types %type and %env can declare.
+var types = []string{"bool", "int", "float", "string"}
+
+// maxTypeCheckVariants bounds how many phenotypes a production may expand to
+// when untyped non-terminals are expanded inline; larger ones are an error.
+const maxTypeCheckVariants = 1000
+
+func zeroValue(t string) any {
+	switch t {
+	case "bool":
+		return false
+	case "int":
+		return 0
+	case "float":
+		return 0.0
+	default:
+		return ""
+	}
+}
+
+func expect(t string) expr.Option {
+	switch t {
+	case "bool":
+		return expr.AsBool()
+	case "int":
+		return expr.AsInt()
+	case "float":
+		return expr.AsFloat64()
+	default:
+		return expr.AsKind(reflect.String)
+	}
+}
+
+// ExprEnv returns an expr environment with the symbolic regression math
+// functions and a zero value of the declared type for each of the grammar's
+// %env variables.
+func ExprEnv(gr genomes.Grammar) map[string]any {
+	env := make(map[string]any, len(mathFunctions)+len(gr.Env))
+	for name, f := range mathFunctions {
+		env[name] = f
+	}
+	for name, t := range gr.Env {
+		env[name] = zeroValue(t)
+	}
+	return env
+}
+
+// compileOptions makes expr.Compile enforce the grammar's declared
+// environment and the phenotype's result type. Grammars without %env
+// declarations get fallback instead.
+func compileOptions(gr genomes.Grammar, result string, fallback ...expr.Option) []expr.Option {
+	if len(gr.Env) == 0 {
+		return fallback
+	}
+	return []expr.Option{expr.Env(ExprEnv(gr)), expect(result)}
+}
+
+// TypeCheck checks that every production of a typed non-terminal compiles
+// to its declared type. Typed non-terminals inside a production stand in as
+// variables of their type; untyped ones are expanded inline, so they must not
+// be recursive.
+func TypeCheck(gr genomes.Grammar) error {
+	rules := make(map[string]*genomes.Rule, len(gr.Rules))
+	for i := range gr.Rules {
+		rules[gr.Rules[i].Left] = &gr.Rules[i]
+	}
+
+	env := ExprEnv(gr)
+	placeholders := map[string]string{}
+	for _, r := range gr.Rules {
+		if t, ok := gr.Types[r.Left]; ok {
+			placeholders[r.Left] = fmt.Sprintf("__typed%d", len(placeholders))
+			env[placeholders[r.Left]] = zeroValue(t)
+		}
+	}
+
+	options := []expr.Option{expr.Env(env)}
+	if len(gr.Env) == 0 {
+		options = append(options, expr.AllowUndefinedVariables())
+	}
+
+	c := typeChecker{rules: rules, placeholders: placeholders, visiting: map[string]bool{}}
+	for _, r := range gr.Rules {
+		t, ok := gr.Types[r.Left]
+		if !ok {
+			continue
+		}
+
+		for i, p := range r.Productions {
+			variants, err := c.expand(p.Elements)
+			if errors.Is(err, errTooManyVariants) {
+				return fmt.Errorf("%s production %d %w", r.Left, i+1, err)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", r.Left, err)
+			}
+			for _, v := range variants {
+				if _, err := expr.Compile(v, append(options, expect(t))...); err != nil {
+					msg, _, _ := strings.Cut(err.Error(), "\n")
+					return fmt.Errorf("%s production %d does not type check as %s: %q: %s", r.Left, i+1, t, v, msg)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+var errTooManyVariants = fmt.Errorf("expands to over %d phenotypes, too many to check exhaustively; declare the types of its non-terminals with %%type", maxTypeCheckVariants)
+
+type typeChecker struct {
+	rules        map[string]*genomes.Rule
+	placeholders map[string]string
+	visiting     map[string]bool
+}
+
+// expand returns the phenotypes a sequence of elements can produce, with
+// typed non-terminals replaced by their placeholders.
+func (c typeChecker) expand(elements []string) ([]string, error) {
+	variants := []string{""}
+	for _, e := range elements {
+		options, err := c.element(e)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(variants)*len(options) > maxTypeCheckVariants {
+			return nil, errTooManyVariants
+		}
+		var next []string
+		for _, v := range variants {
+			for _, o := range options {
+				next = append(next, join(v, o))
+			}
+		}
+		variants = next
+	}
+	return variants, nil
+}
+
+func (c typeChecker) element(e string) ([]string, error) {
+	if placeholder, ok := c.placeholders[e]; ok {
+		return []string{placeholder}, nil
+	}
+	rule, ok := c.rules[e]
+	if !ok {
+		return []string{e}, nil
+	}
+
+	if c.visiting[e] {
+		return nil, fmt.Errorf("%s is recursive; declare its type with %%type", e)
+	}
+	c.visiting[e] = true
+	defer delete(c.visiting, e)
+
+	var options []string
+	for _, p := range rule.Productions {
+		variants, err := c.expand(p.Elements)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, variants...)
+		if len(options) > maxTypeCheckVariants {
+			return nil, errTooManyVariants
+		}
+	}
+	return options, nil
+}
+
+// join mirrors GrammarNode.String: elements separated by single spaces,
+// skipping empty ones.
+func join(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return a + " " + b
+}
@@ -0,0 +1,123 @@
+package grammar_test
+
+import (
+	"bufio"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+	"github.com/danielkennedy1/sieve/problems/grammar"
+)
+
+func TestTypedGrammar(t *testing.T) {
+	gr := parseString(t, `%env $PRICE float
+%env $HOLDINGS int
+%type <strategy> string
+%type <cond> bool
+%type <num> float
+
+<strategy> ::= <cond> ? '"BUY"' : '"SELL"'
+<cond> ::= '(' <cond> <logic> <cond> ')' | '(' <num> <comp> <num> ')'
+<num> ::= $PRICE | $HOLDINGS | 0..2
+<logic> ::= and | or
+<comp> ::= > | <`)
+
+	if gr.Types["<cond>"] != "bool" || gr.Env["$HOLDINGS"] != "int" {
+		t.Errorf("Declarations not parsed: types %v, env %v", gr.Types, gr.Env)
+	}
+
+	env := grammar.ExprEnv(gr)
+	if _, ok := env["$PRICE"].(float64); !ok {
+		t.Errorf("Expected $PRICE to be a float64 in the env, got %T", env["$PRICE"])
+	}
+	if _, ok := env["$HOLDINGS"].(int); !ok {
+		t.Errorf("Expected $HOLDINGS to be an int in the env, got %T", env["$HOLDINGS"])
+	}
+}
+
+func TestTypeCheckErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`%type <cond> bool
+<cond> ::= $PRICE > 1 | $PRICE + 1
+%env $PRICE float`, `<cond> production 2 does not type check as bool: "$PRICE + 1"`},
+		{`%type <s> string
+<s> ::= <cond> ? '"BUY"' : '"SELL"'
+<cond> ::= $RSI > 70
+%env $PRICE float`, `unknown name $RSI`},
+		{`%type <s> float
+<s> ::= <e>
+<e> ::= <e> + 1 | 1`, `<e> is recursive; declare its type with %type`},
+		{`%type <s> float
+<s> ::= <d> + <d> + <d> + <d>
+<d> ::= 0..9`, `<s> production 1 expands to over 1000 phenotypes`},
+		{`%type <s> number
+<s> ::= 1`, `1:11: unknown type "number"`},
+		{`%type s bool
+<s> ::= true`, `1:7: expected non-terminal after %type`},
+		{`%env $PRICE float extra
+<s> ::= $PRICE`, `1:19: unexpected terminal "extra" after %env`},
+	}
+
+	for _, tt := range tests {
+		_, err := grammar.Parse(*bufio.NewScanner(strings.NewReader(tt.src)))
+		if err == nil {
+			t.Errorf("Expected error for %q", tt.src)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Got error %q, want it to contain %q", err, tt.want)
+		}
+	}
+}
+
+func TestTypedIncludes(t *testing.T) {
+	dir := writeGrammars(t, map[string]string{
+		"lib/cmp.bnf": `%env $PRICE float
+%type <cmp> bool
+<cmp> ::= $PRICE > <n>
+<n> ::= 1 | 2`,
+		"main.bnf": `%include "lib/cmp.bnf" as lib
+%type <s> string
+<s> ::= <lib.cmp> ? '"BUY"' : '"HOLD"'`,
+	})
+
+	gr, err := grammar.ParseFile(dir + "/main.bnf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gr.Types["<lib.cmp>"] != "bool" || gr.Env["$PRICE"] != "float" {
+		t.Errorf("Expected namespaced type declarations, got types %v, env %v", gr.Types, gr.Env)
+	}
+}
+
+func TestRMSEEnforcesEnv(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	samples := []grammar.Sample{{Variables: []float64{1, 2}, Output: 1}}
+
+	// <expr> -> <var> -> <input> -> b
+	g := genomes.Genotype{Genes: []uint32{1, 1, 1}}
+
+	if got := grammar.NewRMSE(samples, gr, 0, 100)(g); math.IsInf(got, -1) {
+		t.Fatalf("Expected an untyped grammar to evaluate b, got %f", got)
+	}
+
+	gr.Env = map[string]string{"a": "float"}
+	if got := grammar.NewRMSE(samples, gr, 0, 100)(g); !math.IsInf(got, -1) {
+		t.Errorf("Expected b to be rejected when the env only declares a, got %f", got)
+	}
+}
+
+func TestEnvKeepsMathFunctions(t *testing.T) {
+	gr := genomes.NewTestLectureExampleGrammar()
+	gr.Env = map[string]string{"a": "float", "b": "float"}
+	samples := []grammar.Sample{{Variables: []float64{3, 0}, Output: 1}}
+
+	predictions, ok := grammar.Predict("pdiv ( a , b ) + sin ( b )", samples, gr)
+	if !ok || predictions[0] != 1 {
+		t.Errorf("Expected pdiv and sin under %%env to give 1, got %v (%v)", predictions, ok)
+	}
+}
@@ -0,0 +1,240 @@
+package regression
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+)
+
+// Sample is one input vector and its target. It converts directly to
+// expression_tree.Sample and grammar.Sample.
+type Sample struct {
+	Variables []float64
+	Output    float64
+}
+
+// Sampling describes how a benchmark's inputs are drawn, in the notation of
+// McDermott et al. (2012): U[Min, Max, Count] draws Count points uniformly at
+// random, E[Min, Max, Step] is a grid with spacing Step. Every variable
+// shares the same range.
+type Sampling struct {
+	Min, Max float64
+	Count    int
+	Step     float64
+}
+
+func Uniform(min, max float64, count int) Sampling {
+	return Sampling{Min: min, Max: max, Count: count}
+}
+
+func Grid(min, max, step float64) Sampling {
+	return Sampling{Min: min, Max: max, Step: step}
+}
+
+func (s Sampling) String() string {
+	if s.Step > 0 {
+		return fmt.Sprintf("E[%g, %g, %g]", s.Min, s.Max, s.Step)
+	}
+	return fmt.Sprintf("U[%g, %g, %d]", s.Min, s.Max, s.Count)
+}
+
+// points draws input vectors of numVars variables.
+func (s Sampling) points(numVars int, rng *rand.Rand) [][]float64 {
+	if s.Step <= 0 {
+		points := make([][]float64, s.Count)
+		for i := range points {
+			points[i] = make([]float64, numVars)
+			for j := range points[i] {
+				points[i][j] = s.Min + rng.Float64()*(s.Max-s.Min)
+			}
+		}
+		return points
+	}
+
+	var axis []float64
+	// Half a step of slack so rounding does not drop the last point
+	for i := 0; s.Min+float64(i)*s.Step <= s.Max+s.Step/2; i++ {
+		axis = append(axis, s.Min+float64(i)*s.Step)
+	}
+	points := [][]float64{{}}
+	for range numVars {
+		var next [][]float64
+		for _, p := range points {
+			for _, x := range axis {
+				next = append(next, append(append([]float64{}, p...), x))
+			}
+		}
+		points = next
+	}
+	return points
+}
+
+// Problem is a published symbolic regression benchmark.
+type Problem struct {
+	Name    string
+	NumVars int
+	Target  func(x []float64) float64
+	Train   Sampling
+	// Test is drawn afresh from Train's sampling where the benchmark
+	// publishes no test set
+	Test *Sampling
+}
+
+// Generate draws the training and test samples.
+func (p Problem) Generate(rng *rand.Rand) (train, test []Sample) {
+	testSampling := p.Train
+	if p.Test != nil {
+		testSampling = *p.Test
+	}
+	return p.samples(p.Train, rng), p.samples(testSampling, rng)
+}
+
+func (p Problem) samples(s Sampling, rng *rand.Rand) []Sample {
+	points := s.points(p.NumVars, rng)
+	samples := make([]Sample, len(points))
+	for i, x := range points {
+		samples[i] = Sample{Variables: x, Output: p.Target(x)}
+	}
+	return samples
+}
+
+// Variables names the problem's inputs x0, x1, ...
+func (p Problem) Variables() []string {
+	names := make([]string, p.NumVars)
+	for i := range names {
+		names[i] = fmt.Sprintf("x%d", i)
+	}
+	return names
+}
+
+// BNF is a grammar over the problem's variables for grammatical evolution,
+// built from binary operators such as + and / and unary functions such as
+// sin, either of which may be empty. Division is protected as for expression
+// trees, so / is written pdiv(a, b), which is 1 where b is 0. Its <input>
+// rule lists the variables in index order.
+func (p Problem) BNF(operators, functions []string) string {
+	divide := slices.Contains(operators, "/")
+	operators = slices.DeleteFunc(slices.Clone(operators), func(op string) bool { return op == "/" })
+
+	var b strings.Builder
+	b.WriteString("<expr> ::= ")
+	if len(operators) > 0 {
+		b.WriteString("'(' <expr> <op> <expr> ')' | ")
+	}
+	if divide {
+		b.WriteString("pdiv '(' <expr> ',' <expr> ')' | ")
+	}
+	if len(functions) > 0 {
+		b.WriteString("<func> '(' <expr> ')' | ")
+	}
+	b.WriteString("<var>\n")
+	if len(operators) > 0 {
+		fmt.Fprintf(&b, "<op> ::= %s\n", strings.Join(operators, " | "))
+	}
+	if len(functions) > 0 {
+		fmt.Fprintf(&b, "<func> ::= %s\n", strings.Join(functions, " | "))
+	}
+	fmt.Fprintf(&b, "<var> ::= <input> | <const>\n<input> ::= %s\n<const> ::= 0.5 | 1.0 | 2.0 | 3.0\n",
+		strings.Join(p.Variables(), " | "))
+	return b.String()
+}
+
+func pow(x float64, n int) float64 {
+	return math.Pow(x, float64(n))
+}
+
+// polynomial is x + x^2 + ... + x^degree.
+func polynomial(degree int) func(x []float64) float64 {
+	return func(x []float64) float64 {
+		sum := 0.0
+		for i := 1; i <= degree; i++ {
+			sum += pow(x[0], i)
+		}
+		return sum
+	}
+}
+
+func grid(min, max, step float64) *Sampling {
+	s := Grid(min, max, step)
+	return &s
+}
+
+func uniform(min, max float64, count int) *Sampling {
+	s := Uniform(min, max, count)
+	return &s
+}
+
+// Benchmarks lists the suite: Koza-1..3, Nguyen-1..12, Keijzer-1 and -4,
+// Vladislavleva-1 and -4, and Pagie-1, as defined by McDermott et al.,
+// "Genetic programming needs better benchmarks" (GECCO 2012).
+func Benchmarks() []Problem {
+	return []Problem{
+		{Name: "koza-1", NumVars: 1, Target: polynomial(4), Train: Uniform(-1, 1, 20)},
+		{Name: "koza-2", NumVars: 1, Train: Uniform(-1, 1, 20), Target: func(x []float64) float64 {
+			return pow(x[0], 5) - 2*pow(x[0], 3) + x[0]
+		}},
+		{Name: "koza-3", NumVars: 1, Train: Uniform(-1, 1, 20), Target: func(x []float64) float64 {
+			return pow(x[0], 6) - 2*pow(x[0], 4) + pow(x[0], 2)
+		}},
+		{Name: "nguyen-1", NumVars: 1, Target: polynomial(3), Train: Uniform(-1, 1, 20)},
+		{Name: "nguyen-2", NumVars: 1, Target: polynomial(4), Train: Uniform(-1, 1, 20)},
+		{Name: "nguyen-3", NumVars: 1, Target: polynomial(5), Train: Uniform(-1, 1, 20)},
+		{Name: "nguyen-4", NumVars: 1, Target: polynomial(6), Train: Uniform(-1, 1, 20)},
+		{Name: "nguyen-5", NumVars: 1, Train: Uniform(-1, 1, 20), Target: func(x []float64) float64 {
+			return math.Sin(x[0]*x[0])*math.Cos(x[0]) - 1
+		}},
+		{Name: "nguyen-6", NumVars: 1, Train: Uniform(-1, 1, 20), Target: func(x []float64) float64 {
+			return math.Sin(x[0]) + math.Sin(x[0]+x[0]*x[0])
+		}},
+		{Name: "nguyen-7", NumVars: 1, Train: Uniform(0, 2, 20), Target: func(x []float64) float64 {
+			return math.Log(x[0]+1) + math.Log(x[0]*x[0]+1)
+		}},
+		{Name: "nguyen-8", NumVars: 1, Train: Uniform(0, 4, 20), Target: func(x []float64) float64 {
+			return math.Sqrt(x[0])
+		}},
+		{Name: "nguyen-9", NumVars: 2, Train: Uniform(-1, 1, 100), Target: func(x []float64) float64 {
+			return math.Sin(x[0]) + math.Sin(x[1]*x[1])
+		}},
+		{Name: "nguyen-10", NumVars: 2, Train: Uniform(-1, 1, 100), Target: func(x []float64) float64 {
+			return 2 * math.Sin(x[0]) * math.Cos(x[1])
+		}},
+		{Name: "nguyen-11", NumVars: 2, Train: Uniform(0, 1, 100), Target: func(x []float64) float64 {
+			return math.Pow(x[0], x[1])
+		}},
+		{Name: "nguyen-12", NumVars: 2, Train: Uniform(-1, 1, 20), Target: func(x []float64) float64 {
+			return pow(x[0], 4) - pow(x[0], 3) + x[1]*x[1]/2 - x[1]
+		}},
+		{Name: "keijzer-1", NumVars: 1, Train: Grid(-1, 1, 0.1), Test: grid(-1, 1, 0.001), Target: func(x []float64) float64 {
+			return 0.3 * x[0] * math.Sin(2*math.Pi*x[0])
+		}},
+		{Name: "keijzer-4", NumVars: 1, Train: Grid(0, 10, 0.05), Test: grid(0.05, 10.05, 0.05), Target: func(x []float64) float64 {
+			s, c := math.Sin(x[0]), math.Cos(x[0])
+			return pow(x[0], 3) * math.Exp(-x[0]) * c * s * (s*s*c - 1)
+		}},
+		{Name: "vladislavleva-1", NumVars: 2, Train: Uniform(0.3, 4, 100), Test: grid(-0.2, 4.2, 0.1), Target: func(x []float64) float64 {
+			return math.Exp(-(x[0]-1)*(x[0]-1)) / (1.2 + (x[1]-2.5)*(x[1]-2.5))
+		}},
+		{Name: "vladislavleva-4", NumVars: 5, Train: Uniform(0.05, 6.05, 1024), Test: uniform(-0.25, 6.35, 5000), Target: func(x []float64) float64 {
+			sum := 0.0
+			for _, xi := range x {
+				sum += (xi - 3) * (xi - 3)
+			}
+			return 10 / (5 + sum)
+		}},
+		{Name: "pagie-1", NumVars: 2, Train: Grid(-5, 5, 0.4), Target: func(x []float64) float64 {
+			return 1/(1+math.Pow(x[0], -4)) + 1/(1+math.Pow(x[1], -4))
+		}},
+	}
+}
+
+// Benchmark looks a problem up by name, e.g. "nguyen-7".
+func Benchmark(name string) (Problem, error) {
+	for _, p := range Benchmarks() {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Problem{}, fmt.Errorf("unknown benchmark %q", name)
+}
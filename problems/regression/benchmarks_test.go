@@ -0,0 +1,106 @@
+package regression_test
+
+import (
+	"bufio"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/genomes"
+	"github.com/danielkennedy1/sieve/problems/grammar"
+	"github.com/danielkennedy1/sieve/problems/regression"
+)
+
+func TestBenchmarks(t *testing.T) {
+	problems := regression.Benchmarks()
+	if len(problems) != 20 {
+		t.Errorf("expected 20 benchmarks, got %d", len(problems))
+	}
+
+	seen := map[string]bool{}
+	for _, p := range problems {
+		if seen[p.Name] {
+			t.Errorf("duplicate benchmark %s", p.Name)
+		}
+		seen[p.Name] = true
+
+		train, test := p.Generate(rand.New(rand.NewPCG(1, 1)))
+		for _, s := range append(train, test...) {
+			if len(s.Variables) != p.NumVars {
+				t.Fatalf("%s: sample has %d variables, want %d", p.Name, len(s.Variables), p.NumVars)
+			}
+			if math.IsNaN(s.Output) || math.IsInf(s.Output, 0) {
+				t.Fatalf("%s: target at %v is %f", p.Name, s.Variables, s.Output)
+			}
+			for _, x := range s.Variables {
+				if sampling := p.Train; p.Test == nil && (x < sampling.Min || x > sampling.Max) {
+					t.Fatalf("%s: input %f outside %s", p.Name, x, sampling)
+				}
+			}
+		}
+	}
+}
+
+func TestBenchmarkSampleCounts(t *testing.T) {
+	tests := []struct {
+		name        string
+		train, test int
+	}{
+		{"koza-1", 20, 20},
+		{"nguyen-9", 100, 100},
+		{"keijzer-1", 21, 2001},
+		{"keijzer-4", 201, 201},
+		{"vladislavleva-1", 100, 2025},
+		{"vladislavleva-4", 1024, 5000},
+		{"pagie-1", 676, 676},
+	}
+	for _, tt := range tests {
+		p, err := regression.Benchmark(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		train, test := p.Generate(rand.New(rand.NewPCG(1, 1)))
+		if len(train) != tt.train || len(test) != tt.test {
+			t.Errorf("%s: expected %d train and %d test samples, got %d and %d", tt.name, tt.train, tt.test, len(train), len(test))
+		}
+	}
+
+	if _, err := regression.Benchmark("nguyen-13"); err == nil {
+		t.Error("expected error for unknown benchmark")
+	}
+}
+
+func TestBenchmarkGrammar(t *testing.T) {
+	p, err := regression.Benchmark("nguyen-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gr, err := grammar.Parse(*bufio.NewScanner(strings.NewReader(p.BNF([]string{"+", "*"}, []string{"sin"}))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars := genomes.BuildVarMapFromGrammar(gr)
+	if len(vars) != 2 || vars["x0"] != 0 || vars["x1"] != 1 {
+		t.Errorf("expected x0 and x1 as inputs 0 and 1, got %v", vars)
+	}
+
+	// Without functions there is no <func> rule to reach
+	gr, err = grammar.Parse(*bufio.NewScanner(strings.NewReader(p.BNF([]string{"+"}, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gr.Rules) != 5 || len(gr.Rules[0].Productions) != 2 {
+		t.Errorf("unexpected grammar %v", gr.Rules)
+	}
+
+	// Division is protected, so it is a call rather than an <op>
+	gr, err = grammar.Parse(*bufio.NewScanner(strings.NewReader(p.BNF([]string{"/"}, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gr.Rules) != 4 || len(gr.Rules[0].Productions) != 2 || gr.Rules[0].Productions[0].Elements[0] != "pdiv" {
+		t.Errorf("unexpected grammar %v", gr.Rules)
+	}
+}
@@ -0,0 +1,77 @@
+package regression
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// Split is a dataset shuffled into training, validation and test parts:
+// evolution sees Train, the final model is chosen on Validation and
+// reported on Test.
+type Split[S any] struct {
+	Train, Validation, Test []S
+}
+
+// NewSplit shuffles samples and sets aside the validation and test
+// fractions, the rest being for training. A zero fraction leaves its part
+// empty; it is an error for any other part to round down to no samples.
+func NewSplit[S any](samples []S, validation, test float64, rng *rand.Rand) (Split[S], error) {
+	if validation < 0 || test < 0 || validation+test >= 1 {
+		return Split[S]{}, fmt.Errorf("validation (%v) and test (%v) fractions must leave samples for training", validation, test)
+	}
+
+	nValidation := int(validation * float64(len(samples)))
+	nTest := int(test * float64(len(samples)))
+	nTrain := len(samples) - nValidation - nTest
+	if nTrain == 0 || (validation > 0 && nValidation == 0) || (test > 0 && nTest == 0) {
+		return Split[S]{}, fmt.Errorf("%d samples are too few to split %v/%v/%v", len(samples), 1-validation-test, validation, test)
+	}
+
+	shuffled := slices.Clone(samples)
+	rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	return Split[S]{
+		Train:      shuffled[:nTrain],
+		Validation: shuffled[nTrain : nTrain+nValidation],
+		Test:       shuffled[nTrain+nValidation:],
+	}, nil
+}
+
+// Fold is one round of k-fold cross-validation.
+type Fold[S any] struct {
+	Train, Test []S
+}
+
+// KFold shuffles samples into k folds of near-equal size; fold i tests on
+// the i-th part and trains on the rest.
+func KFold[S any](samples []S, k int, rng *rand.Rand) ([]Fold[S], error) {
+	if k < 2 || k > len(samples) {
+		return nil, fmt.Errorf("k-fold needs 2 <= k <= %d samples, got k = %d", len(samples), k)
+	}
+
+	shuffled := slices.Clone(samples)
+	rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+	folds := make([]Fold[S], k)
+	for i := range folds {
+		start, end := i*len(shuffled)/k, (i+1)*len(shuffled)/k
+		folds[i] = Fold[S]{
+			Train: slices.Concat(shuffled[:start], shuffled[end:]),
+			Test:  shuffled[start:end],
+		}
+	}
+	return folds, nil
+}
+
+// CrossValidate runs run on each fold, e.g. evolving on the fold's training
+// samples and scoring the result on its test samples, and returns the mean
+// and standard deviation of the scores.
+func CrossValidate[S any](folds []Fold[S], run func(train, test []S) float64) (mean, std float64) {
+	scores := make([]float64, len(folds))
+	for i, f := range folds {
+		scores[i] = run(f.Train, f.Test)
+	}
+	mean, variance := meanVariance(scores)
+	return mean, math.Sqrt(variance)
+}
@@ -0,0 +1,94 @@
+package regression_test
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/problems/regression"
+)
+
+func indices(n int) []int {
+	xs := make([]int, n)
+	for i := range xs {
+		xs[i] = i
+	}
+	return xs
+}
+
+func TestNewSplit(t *testing.T) {
+	samples := indices(100)
+	split, err := regression.NewSplit(samples, 0.2, 0.1, rand.New(rand.NewPCG(1, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(split.Train) != 70 || len(split.Validation) != 20 || len(split.Test) != 10 {
+		t.Errorf("expected 70/20/10, got %d/%d/%d", len(split.Train), len(split.Validation), len(split.Test))
+	}
+
+	all := slices.Concat(split.Train, split.Validation, split.Test)
+	if slices.Equal(all, samples) {
+		t.Error("expected samples to be shuffled")
+	}
+	slices.Sort(all)
+	if !slices.Equal(all, samples) {
+		t.Error("split should partition the samples")
+	}
+
+	if _, err := regression.NewSplit(samples, 0.5, 0.5, rand.New(rand.NewPCG(1, 1))); err == nil {
+		t.Error("expected error when nothing is left for training")
+	}
+	if _, err := regression.NewSplit(indices(4), 0.2, 0, rand.New(rand.NewPCG(1, 1))); err == nil {
+		t.Error("expected error when the validation part rounds down to nothing")
+	}
+	split, err = regression.NewSplit(indices(4), 0.25, 0, rand.New(rand.NewPCG(1, 1)))
+	if err != nil || len(split.Train) != 3 || len(split.Validation) != 1 || len(split.Test) != 0 {
+		t.Errorf("expected 3/1/0 without a test part, got %d/%d/%d (%v)", len(split.Train), len(split.Validation), len(split.Test), err)
+	}
+}
+
+func TestKFold(t *testing.T) {
+	samples := indices(23)
+	folds, err := regression.KFold(samples, 5, rand.New(rand.NewPCG(2, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tested []int
+	for _, f := range folds {
+		if n := len(f.Test); n < 4 || n > 5 {
+			t.Errorf("expected 4 or 5 test samples per fold, got %d", n)
+		}
+		if len(f.Train)+len(f.Test) != len(samples) {
+			t.Errorf("fold has %d train and %d test samples", len(f.Train), len(f.Test))
+		}
+		for _, s := range f.Test {
+			if slices.Contains(f.Train, s) {
+				t.Errorf("sample %d both trained and tested on", s)
+			}
+		}
+		tested = append(tested, f.Test...)
+	}
+	slices.Sort(tested)
+	if !slices.Equal(tested, samples) {
+		t.Error("each sample should be tested on exactly once")
+	}
+
+	if _, err := regression.KFold(samples, 1, rand.New(rand.NewPCG(2, 2))); err == nil {
+		t.Error("expected error for k = 1")
+	}
+}
+
+func TestCrossValidate(t *testing.T) {
+	folds, _ := regression.KFold(indices(4), 2, rand.New(rand.NewPCG(3, 3)))
+	scores := []float64{1, 3}
+	next := 0
+	mean, std := regression.CrossValidate(folds, func(train, test []int) float64 {
+		next++
+		return scores[next-1]
+	})
+	if mean != 2 || math.Abs(std-1) > 1e-12 {
+		t.Errorf("expected mean 2 and std 1, got %f and %f", mean, std)
+	}
+}
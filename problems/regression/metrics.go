@@ -0,0 +1,134 @@
+package regression
+
+import (
+	"fmt"
+	"math"
+)
+
+// Metric is an error measure for symbolic regression.
+type Metric int
+
+const (
+	RMSE Metric = iota
+	MSE
+	MAE
+	// R2 is the coefficient of determination
+	R2
+	// NRMSE is RMSE divided by the standard deviation of the targets, or
+	// plain RMSE if they are constant
+	NRMSE
+)
+
+func ParseMetric(name string) (Metric, error) {
+	switch name {
+	case "", "rmse":
+		return RMSE, nil
+	case "mse":
+		return MSE, nil
+	case "mae":
+		return MAE, nil
+	case "r2":
+		return R2, nil
+	case "nrmse":
+		return NRMSE, nil
+	default:
+		return RMSE, fmt.Errorf("unknown regression metric %q", name)
+	}
+}
+
+func (m Metric) String() string {
+	return [...]string{"rmse", "mse", "mae", "r2", "nrmse"}[m]
+}
+
+// Fitness scores predictions against targets with higher being better: the
+// negated error, or R² itself. Non-finite predictions score -Inf.
+func (m Metric) Fitness(predictions, targets []float64) float64 {
+	n := float64(len(targets))
+	var squared, absolute float64
+	for i, p := range predictions {
+		if math.IsNaN(p) || math.IsInf(p, 0) {
+			return math.Inf(-1)
+		}
+		d := p - targets[i]
+		squared += d * d
+		absolute += math.Abs(d)
+	}
+
+	switch m {
+	case MSE:
+		return -squared / n
+	case MAE:
+		return -absolute / n
+	case R2:
+		_, variance := meanVariance(targets)
+		if variance == 0 {
+			// Constant targets: only an exact fit explains them
+			if squared == 0 {
+				return 1
+			}
+			return math.Inf(-1)
+		}
+		return 1 - squared/n/variance
+	case NRMSE:
+		_, variance := meanVariance(targets)
+		if variance == 0 {
+			return -math.Sqrt(squared / n)
+		}
+		return -math.Sqrt(squared / n / variance)
+	default:
+		return -math.Sqrt(squared / n)
+	}
+}
+
+// LinearScaling fits targets ≈ intercept + slope * predictions by least
+// squares (Keijzer 2003), so evolution only has to find the shape of the
+// target rather than its scale and offset.
+func LinearScaling(predictions, targets []float64) (slope, intercept float64) {
+	meanP, varP := meanVariance(predictions)
+	meanT, _ := meanVariance(targets)
+	if varP == 0 {
+		return 0, meanT
+	}
+
+	covariance := 0.0
+	for i, p := range predictions {
+		covariance += (p - meanP) * (targets[i] - meanT)
+	}
+	slope = covariance / float64(len(predictions)) / varP
+	return slope, meanT - slope*meanP
+}
+
+// NewFitness scores predictions with metric, linearly scaling them first if
+// linearScaling is set.
+func NewFitness(metric Metric, linearScaling bool) func(predictions, targets []float64) float64 {
+	if !linearScaling {
+		return metric.Fitness
+	}
+	return func(predictions, targets []float64) float64 {
+		for _, p := range predictions {
+			if math.IsNaN(p) || math.IsInf(p, 0) {
+				return math.Inf(-1)
+			}
+		}
+		slope, intercept := LinearScaling(predictions, targets)
+		scaled := make([]float64, len(predictions))
+		for i, p := range predictions {
+			scaled[i] = intercept + slope*p
+		}
+		return metric.Fitness(scaled, targets)
+	}
+}
+
+func meanVariance(xs []float64) (float64, float64) {
+	mean := 0.0
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+
+	variance := 0.0
+	for _, x := range xs {
+		variance += (x - mean) * (x - mean)
+	}
+	return mean, variance / float64(len(xs))
+}
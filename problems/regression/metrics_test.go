@@ -0,0 +1,74 @@
+package regression_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/danielkennedy1/sieve/problems/regression"
+)
+
+func TestMetrics(t *testing.T) {
+	targets := []float64{1, 2, 3, 4}
+	predictions := []float64{1, 3, 3, 2}
+	// Errors 0, 1, 0, -2: squared sum 5, absolute sum 3, target variance 1.25
+
+	tests := []struct {
+		metric regression.Metric
+		want   float64
+	}{
+		{regression.RMSE, -math.Sqrt(5.0 / 4)},
+		{regression.MSE, -5.0 / 4},
+		{regression.MAE, -3.0 / 4},
+		{regression.R2, 1 - (5.0/4)/1.25},
+		{regression.NRMSE, -math.Sqrt((5.0 / 4) / 1.25)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.metric.String(), func(t *testing.T) {
+			if got := tt.metric.Fitness(predictions, targets); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("got %f, want %f", got, tt.want)
+			}
+		})
+	}
+
+	if got := regression.R2.Fitness(targets, targets); got != 1 {
+		t.Errorf("perfect fit should have R² 1, got %f", got)
+	}
+	if got := regression.RMSE.Fitness([]float64{1, math.NaN(), 3, 4}, targets); !math.IsInf(got, -1) {
+		t.Errorf("NaN prediction should score -Inf, got %f", got)
+	}
+}
+
+func TestParseMetric(t *testing.T) {
+	for _, name := range []string{"rmse", "mse", "mae", "r2", "nrmse"} {
+		m, err := regression.ParseMetric(name)
+		if err != nil || m.String() != name {
+			t.Errorf("%s parsed as %v, %v", name, m, err)
+		}
+	}
+	if _, err := regression.ParseMetric("mape"); err == nil {
+		t.Error("expected error for unknown metric")
+	}
+}
+
+func TestLinearScaling(t *testing.T) {
+	predictions := []float64{0, 1, 2, 3}
+	targets := []float64{-1, 2, 5, 8}
+
+	slope, intercept := regression.LinearScaling(predictions, targets)
+	if math.Abs(slope-3) > 1e-12 || math.Abs(intercept+1) > 1e-12 {
+		t.Errorf("expected slope 3 and intercept -1, got %f and %f", slope, intercept)
+	}
+
+	fitness := regression.NewFitness(regression.RMSE, true)
+	if got := fitness(predictions, targets); math.Abs(got) > 1e-12 {
+		t.Errorf("scaled predictions should fit exactly, got %f", got)
+	}
+
+	// Constant predictions scale to the mean target
+	if slope, intercept := regression.LinearScaling([]float64{2, 2, 2, 2}, targets); slope != 0 || intercept != 3.5 {
+		t.Errorf("expected slope 0 and intercept 3.5, got %f and %f", slope, intercept)
+	}
+	if got := fitness([]float64{math.Inf(1), 1, 2, 3}, targets); !math.IsInf(got, -1) {
+		t.Errorf("infinite prediction should score -Inf, got %f", got)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/danielkennedy1/sieve/benchmark"
+	"github.com/danielkennedy1/sieve/config"
+	"github.com/danielkennedy1/sieve/genomes"
+	"github.com/danielkennedy1/sieve/problems/regression"
+)
+
+func runRegressionCommand(args []string) int {
+	o := benchmark.DefaultRegressionOptions()
+	fs := flag.NewFlagSet("regression", flag.ContinueOnError)
+	fs.IntVar(&o.Seeds, "seeds", o.Seeds, "Runs per problem and pipeline")
+	fs.IntVar(&o.Generations, "generations", o.Generations, "Generations per run")
+	fs.IntVar(&o.PopulationSize, "population", o.PopulationSize, "Population size")
+	fs.Float64Var(&o.ValidationFraction, "validation", o.ValidationFraction, "Fraction of training samples held out to choose each run's model")
+	fs.Float64Var(&o.SuccessThreshold, "threshold", o.SuccessThreshold, "Test RMSE at or below which a run succeeds")
+	configName := fs.String("config", "", "Config setting the metric, linear scaling and, under [tree], the primitives, initialisation and operators")
+	names := fs.String("problems", "", "Comma separated benchmarks to run, e.g. nguyen-1,keijzer-4 (default all)")
+	fs.Usage = func() {
+		fmt.Println("Usage: sieve regression [flags]")
+		fmt.Println("Runs symbolic regression benchmarks with tree GP and GE and reports success rates")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *configName != "" {
+		cfg, err := config.LoadConfig(*configName)
+		if err != nil {
+			fmt.Println(err)
+			return 2
+		}
+		if o.Initialisation, err = genomes.ParseInitialisation(cfg.Tree.Initialisation); err != nil {
+			fmt.Println(err)
+			return 2
+		}
+		if o.Metric, err = regression.ParseMetric(cfg.Metric); err != nil {
+			fmt.Println(err)
+			return 2
+		}
+		o.LinearScaling = cfg.LinearScaling
+		o.Primitives = cfg.Tree.Primitives
+		o.MinDepth, o.DistinctAttempts = cfg.Tree.MinDepth, cfg.Tree.DistinctAttempts
+
+		m := cfg.Tree.Mutation
+		o.TreeMutation = genomes.TreeMutationRates{
+			Point:       m.Point,
+			Subtree:     m.Subtree,
+			Hoist:       m.Hoist,
+			Shrink:      m.Shrink,
+			Permutation: m.Permutation,
+			Constant:    m.Constant,
+		}
+		o.TreeMutationOptions.SwapRate = m.SwapRate
+		o.TreeMutationOptions.SubtreeDepth = m.SubtreeDepth
+		o.TreeMutationOptions.ConstantSigma = m.ConstantSigma
+		o.TreeCrossover = genomes.TreeCrossoverRates(cfg.Tree.Crossover)
+		if erc := cfg.Tree.ERC; erc.Min < erc.Max {
+			o.ERC = &genomes.ERC{Min: erc.Min, Max: erc.Max}
+		}
+		o.LocalSearchEvaluations = cfg.Tree.LocalSearch.Evaluations
+		o.LocalSearchCount = cfg.Tree.LocalSearch.Count
+	}
+
+	problems := regression.Benchmarks()
+	if *names != "" {
+		problems = nil
+		for _, name := range strings.Split(*names, ",") {
+			p, err := regression.Benchmark(strings.TrimSpace(name))
+			if err != nil {
+				fmt.Println(err)
+				return 2
+			}
+			problems = append(problems, p)
+		}
+	}
+
+	results, err := benchmark.RunRegressionSuite(problems, o)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	benchmark.PrintRegressionResults(results)
+	return 0
+}